@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"maps"
 	"os"
@@ -45,6 +46,7 @@ type SlackOptions struct {
 	TitleConfirmation string
 	ApprovedMessage   string
 	RejectedMessage   string
+	CancelledMessage  string
 	WaitingMessage    string
 
 	ReactionDoing    string
@@ -122,8 +124,22 @@ type SlackMessage struct {
 	params              common.ExecuteParams
 	fields              SlackMessageFields
 	formBlockID         string
-	tags                map[string]string // custom tags for message grouping and status tracking
-	submitButtonVisible bool              // tracks actual rendered state of the submit button
+	tags                map[string]string     // custom tags for message grouping and status tracking
+	submitButtonVisible bool                  // tracks actual rendered state of the submit button
+	approvalCallback    common.ApprovalFunc   // set for approvals which are not bound to a command
+	approval            common.Approval       // set while message waits for approval
+	result              *common.MessageResult // what command replied with
+	run                 *common.MessageRun    // shared by messages of the command, cancels it
+}
+
+// SlackApprovalDecision is made with approval buttons or via API, callback and replier are set for buttons only
+type SlackApprovalDecision struct {
+	approved    bool
+	approver    *SlackUser
+	reasons     string
+	description string
+	callback    *slack.InteractionCallback
+	replier     interface{}
 }
 
 type SlackFileResponseFull struct {
@@ -169,6 +185,9 @@ type Slack struct {
 	saveTicker        *time.Ticker
 	stopSave          chan bool
 	userGroups        SlackUserGroups
+	events            *common.MessageEvents
+	policy            *common.Policy
+	channelNames      sync.Map
 
 	formUpdates formUpdatesState
 }
@@ -246,6 +265,7 @@ const (
 	slackApprovalFieldType  = "approval-field"
 	slackApprovalButtonType = "approval-button"
 	slackActionButtonType   = "action-button"
+	slackCancelButtonType   = "cancel-button"
 
 	slackApprovalReasons            = "approval-reasons"
 	slackApprovalDescription        = "approval-description"
@@ -635,6 +655,14 @@ func (sm *SlackMessage) SetParentID(threadTS string) {
 	key.threadTS = threadTS
 }
 
+func (sm *SlackMessage) Context() context.Context {
+	return sm.run.Context()
+}
+
+func (sm *SlackMessage) Hold() func() {
+	return sm.run.Hold()
+}
+
 func (sm *SlackMessage) getKey() *SlackMessageKey {
 
 	if sm.key != nil {
@@ -1062,8 +1090,7 @@ func (s *Slack) TagMessage(channelID, timestamp string, tags map[string]string)
 	return nil
 }
 
-// GetMessageStatus returns the status of a message by its ID (Slack timestamp).
-func (s *Slack) GetMessageStatus(messageID string) (common.MessageStatus, error) {
+func (s *Slack) findMessageByID(messageID string) *SlackMessage {
 	var foundMsg *SlackMessage
 
 	s.messages.Range(func(item *ttlcache.Item[string, *SlackMessage]) bool {
@@ -1074,22 +1101,210 @@ func (s *Slack) GetMessageStatus(messageID string) (common.MessageStatus, error)
 		}
 		return true
 	})
+	return foundMsg
+}
+
+func (s *Slack) messageStatus(m *SlackMessage) common.MessageStatus {
+
+	if m.tags == nil {
+		// No tags set, assume delivered (default for regular messages)
+		return common.MessageStatusDelivered
+	}
+
+	status, ok := m.tags["status"]
+	if !ok {
+		return common.MessageStatusDelivered
+	}
+
+	return common.MessageStatus(status)
+}
+
+// setMessageStatus tags message with status and lets subscribers know about it
+func (s *Slack) setMessageStatus(m *SlackMessage, status common.MessageStatus) {
+
+	if m == nil {
+		return
+	}
+	// cancelled command might still finish, but its status is kept
+	if status != common.MessageStatusCancelled && m.run.Cancelled() {
+		return
+	}
+	if m.tags == nil {
+		m.tags = make(map[string]string)
+	}
+	m.tags["status"] = string(status)
+	s.putMessageToCache(m)
+
+	if m.key != nil {
+		s.events.Publish(common.NewMessageEvent(s.Name(), m.key.timestamp, m.key.channelID, status))
+	}
+}
+
+// GetMessageStatus returns the status of a message by its ID (Slack timestamp).
+func (s *Slack) GetMessageStatus(messageID string) (common.MessageStatus, error) {
 
+	foundMsg := s.findMessageByID(messageID)
 	if foundMsg == nil {
 		return common.MessageStatusNotFound, nil
 	}
+	return s.messageStatus(foundMsg), nil
+}
 
-	if foundMsg.tags == nil {
-		// No tags set, assume delivered (default for regular messages)
-		return common.MessageStatusDelivered, nil
+// GetMessageResult returns status and output of a command by message ID (Slack timestamp).
+// Approval messages have no output, so output of the command they approve is used.
+func (s *Slack) GetMessageResult(messageID string) (*common.MessageResult, error) {
+
+	foundMsg := s.findMessageByID(messageID)
+	if foundMsg == nil {
+		return nil, nil
+	}
+
+	result := foundMsg.result
+	if result == nil && foundMsg.originKey != nil {
+		if mOrigin := s.findMessageInCache(foundMsg.originKey); mOrigin != nil {
+			result = mOrigin.result
+		}
+	}
+
+	r := &common.MessageResult{}
+	if result != nil {
+		*r = *result
+	}
+	r.Command = foundMsg.cmdText
+	r.Status = s.messageStatus(foundMsg)
+	return r, nil
+}
+
+// PendingApprovals returns messages which wait for approval, approvals of commands and of runbook steps
+func (s *Slack) PendingApprovals() []*common.PendingApproval {
+
+	r := []*common.PendingApproval{}
+	s.messages.Range(func(item *ttlcache.Item[string, *SlackMessage]) bool {
+		m := item.Value()
+		if m == nil || m.key == nil || m.approval == nil || s.messageStatus(m) != common.MessageStatusWaitingApproval {
+			return true
+		}
+		r = append(r, &common.PendingApproval{
+			ID:      m.key.timestamp,
+			Channel: m.key.channelID,
+			Command: m.cmdText,
+			Params:  m.params,
+			User:    m.userID(),
+			Reasons: m.approval.Reasons(),
+		})
+		return true
+	})
+	sort.Slice(r, func(i, j int) bool { return r[i].ID < r[j].ID })
+	return r
+}
+
+// Approve makes the same decision as approval buttons do, reason is shown as description
+func (s *Slack) Approve(messageID string, approved bool, user common.User, reason string) error {
+
+	m := s.findMessageByID(messageID)
+	if m == nil {
+		return common.ErrApprovalNotFound
+	}
+	if m.approval == nil || s.messageStatus(m) != common.MessageStatusWaitingApproval {
+		return common.ErrApprovalNotPending
 	}
 
-	status, ok := foundMsg.tags["status"]
+	approver, ok := user.(*SlackUser)
 	if !ok {
-		return common.MessageStatusDelivered, nil
+		approver = &SlackUser{
+			id:       user.ID(),
+			name:     user.Name(),
+			email:    user.Email(),
+			timezone: user.TimeZone(),
+			commands: user.Commands(),
+		}
+	}
+
+	description := ""
+	if !utils.IsEmpty(reason) {
+		description = strings.TrimSpace(fmt.Sprintf("%s %s", s.options.ApprovalDescription, reason))
+	}
+
+	m.caller = approver
+	// response URL of buttons might be expired, message is updated instead
+	m.responseURL = ""
+	s.putMessageToCache(m)
+
+	d := &SlackApprovalDecision{
+		approved:    approved,
+		approver:    approver,
+		description: description,
+	}
+	return s.cacheApprovalDecision(m, d, s.options.ReactionApproval)
+}
+
+// messageRun starts a new run for the command, unless message already has one which isn't cancelled
+func (s *Slack) messageRun(m *SlackMessage) {
+	if m.run == nil || m.run.Cancelled() {
+		m.run = common.NewMessageRun()
+	}
+}
+
+// cancelledMessage replaces approval buttons, there is no user if bot cancels it itself
+func (s *Slack) cancelledMessage(user common.User) string {
+
+	if utils.IsEmpty(s.options.CancelledMessage) {
+		return ""
+	}
+	who := s.Name()
+	if !utils.IsEmpty(user) {
+		who = fmt.Sprintf("<@%s>", user.ID())
+	}
+	r := fmt.Sprintf(s.options.CancelledMessage, who, time.Now().Format("15:04:05"))
+	return fmt.Sprintf(":%s: %s", s.options.ReactionRejected, r)
+}
+
+// cacheCancel cancels command of the message, approval buttons are removed and callback is rejected
+func (s *Slack) cacheCancel(m *SlackMessage, user common.User) error {
+
+	if s.messageStatus(m).Final() && !m.run.Running() {
+		return common.ErrMessageNotCancellable
+	}
+	m.run.Cancel()
+
+	if m.approval != nil {
+		text := s.cancelledMessage(user)
+		_, err := s.replaceApprovalMessage(m, text)
+		if err != nil {
+			s.logger.Error("Slack couldn't remove approval of %s: %s", m.key.String(), err)
+		}
+		m.approval = nil
+
+		f := m.approvalCallback
+		m.approvalCallback = nil
+		if f != nil {
+			f(false, user, text)
+		}
+
+		mInit := s.findInitMessageInCache(m)
+		if mInit != nil {
+			s.addRemoveReactions(mInit.typ, mInit.key, s.options.ReactionFailed, s.options.ReactionApproval)
+		}
 	}
 
-	return common.MessageStatus(status), nil
+	s.setMessageStatus(m, common.MessageStatusCancelled)
+	return nil
+}
+
+// Cancel cancels command which is running or waits for approval, any message of the command can be used.
+// Requester can cancel it, others only approval as they could reject it, there is no user if bot cancels it itself.
+func (s *Slack) Cancel(messageID string, user common.User) error {
+
+	m := s.findMessageByID(messageID)
+	if m == nil {
+		return common.ErrMessageNotFound
+	}
+	if !utils.IsEmpty(user) && user.ID() != m.userID() && m.approval == nil {
+		return common.ErrCancelNotPermitted
+	}
+	// response URL of buttons might be expired, message is updated instead
+	m.responseURL = ""
+	return s.cacheCancel(m, user)
 }
 
 func (s *Slack) FindMessagesByTag(key, value string) map[string]string {
@@ -1310,7 +1525,11 @@ func (s *Slack) buildActionBlocks(actions []common.Action, divider bool) []slack
 		if !utils.IsEmpty(aLabel) {
 			label = aLabel
 		}
-		actionID := s.encodeActionID(blockID, slackActionButtonType, aName)
+		typ := slackActionButtonType
+		if aName == common.CancelActionName {
+			typ = slackCancelButtonType
+		}
+		actionID := s.encodeActionID(blockID, typ, aName)
 		el := slack.NewButtonBlockElement(actionID, "", slack.NewTextBlockObject(slack.PlainTextType, label, false, false))
 
 		style := a.Style()
@@ -1686,6 +1905,32 @@ func (s *Slack) findGroup(groups []slack.UserGroup, userID string, group *regexp
 	return nil
 }
 
+// groupPermission returns group permission which allows command to the user
+func (s *Slack) groupPermission(userID, command string, groups []slack.UserGroup) string {
+
+	permission, err := common.FindPermission(s.options.GroupPermissions, command, func(re *regexp.Regexp) bool {
+		return s.findGroup(groups, userID, re) != nil
+	})
+	if err != nil {
+		s.logger.Error("Slack group permissions error: %s", err)
+		return ""
+	}
+	return permission
+}
+
+// userPermission returns user permission which allows command to the user
+func (s *Slack) userPermission(userID, userName, command string) string {
+
+	permission, err := common.FindPermission(s.options.UserPermissions, command, func(re *regexp.Regexp) bool {
+		return re.MatchString(userID) || re.MatchString(userName)
+	})
+	if err != nil {
+		s.logger.Error("Slack user permissions error: %s", err)
+		return ""
+	}
+	return permission
+}
+
 // .*=^(help|news|app|application|catalog)$,some=^(escalate)$
 func (s *Slack) denyGroupAccess(userID, command string, groups []slack.UserGroup) bool {
 
@@ -1701,33 +1946,7 @@ func (s *Slack) denyGroupAccess(userID, command string, groups []slack.UserGroup
 	if s.auth.UserID == userID {
 		return false
 	}
-
-	permissions := utils.MapGetKeyValues(s.options.GroupPermissions)
-	for group, value := range permissions {
-
-		reCommand, err := regexp.Compile(value)
-		if err != nil {
-			s.logger.Error("Slack command regex error: %s", err)
-			return true
-		}
-
-		mCommand := reCommand.MatchString(command)
-		if !mCommand {
-			continue
-		}
-
-		reGroup, err := regexp.Compile(group)
-		if err != nil {
-			s.logger.Error("Slack group regex error: %s", err)
-			return true
-		}
-
-		mGroup := s.findGroup(groups, userID, reGroup)
-		if mGroup != nil {
-			return false
-		}
-	}
-	return true
+	return utils.IsEmpty(s.groupPermission(userID, command, groups))
 }
 
 // .*=^(help|news|app|application|catalog)$,some=^(escalate)$
@@ -1745,41 +1964,186 @@ func (s *Slack) denyUserAccess(userID, userName string, command string) bool {
 	if s.auth.UserID == userID {
 		return false
 	}
+	return utils.IsEmpty(s.userPermission(userID, userName, command))
+}
 
-	userPermissions := utils.MapGetKeyValues(s.options.UserPermissions)
-	for user, value := range userPermissions {
-
-		reCommand, err := regexp.Compile(value)
-		if err != nil {
-			s.logger.Error("Slack command regex error: %s", err)
-			return true
-		}
+// userGroupNames lists handles and names of groups which user belongs to
+func (s *Slack) userGroupNames(userID string, groups []slack.UserGroup) []string {
 
-		mCommand := reCommand.MatchString(command)
-		if !mCommand {
+	r := []string{}
+	for _, g := range groups {
+		if !utils.Contains(g.Users, userID) {
 			continue
 		}
-
-		reUserID, err := regexp.Compile(user)
-		if err != nil {
-			s.logger.Error("Slack user ID regex error: %s", err)
-			return true
+		if !utils.IsEmpty(g.Handle) {
+			r = append(r, g.Handle)
 		}
-
-		reUserName, err := regexp.Compile(user)
-		if err != nil {
-			s.logger.Error("Slack user name regex error: %s", err)
-			return true
+		if !utils.IsEmpty(g.Name) && g.Name != g.Handle {
+			r = append(r, g.Name)
 		}
+	}
+	return r
+}
 
-		if reUserID.MatchString(userID) || reUserName.MatchString(userName) {
-			return false
-		}
+// channelName is cached, as policy needs it for every command
+func (s *Slack) channelName(channelID string) string {
+
+	if utils.IsEmpty(channelID) {
+		return ""
 	}
-	return true
+	if v, ok := s.channelNames.Load(channelID); ok {
+		return v.(string)
+	}
+	if s.client == nil {
+		return ""
+	}
+
+	ch, err := s.client.SlackClient().GetConversationInfo(&slack.GetConversationInfoInput{ChannelID: channelID})
+	if err != nil {
+		s.logger.Error("Slack couldn't get channel %s: %s", channelID, err)
+		return ""
+	}
+	s.channelNames.Store(channelID, ch.Name)
+	return ch.Name
+}
+
+func (s *Slack) policyRequest(userID, userName, channelID, command string) *common.PolicyRequest {
+	return &common.PolicyRequest{
+		Bot:         s.Name(),
+		UserID:      userID,
+		UserName:    userName,
+		Groups:      s.userGroupNames(userID, s.userGroups.items),
+		Channel:     channelID,
+		ChannelName: s.channelName(channelID),
+		Command:     command,
+	}
+}
+
+// placed checks scopes of policy, they limit channels of commands which need no permissions too
+func (s *Slack) placed(userID, channelID, command string) bool {
+
+	if s.policy == nil || (s.auth != nil && s.auth.UserID == userID) {
+		return true
+	}
+	return s.policy.CheckChannel(&common.PolicyRequest{
+		Bot:         s.Name(),
+		Channel:     channelID,
+		ChannelName: s.channelName(channelID),
+		Command:     command,
+	}) == nil
+}
+
+// policyAllowed is true for bot itself, as it runs commands of schedules and actions
+func (s *Slack) policyAllowed(userID, userName, channelID, command string) bool {
+
+	if s.auth != nil && s.auth.UserID == userID {
+		return true
+	}
+	return s.policy.Allowed(s.policyRequest(userID, userName, channelID, command))
+}
+
+// permitted checks policy in the channel, without policy commands of user are listed by permission regexes
+func (s *Slack) permitted(u *SlackUser, channelID, groupName string) bool {
+
+	if s.policy == nil {
+		return utils.Contains(u.commands, groupName)
+	}
+	return s.policyAllowed(u.id, u.name, channelID, groupName)
+}
+
+// freeze is checked for every command, even for those which the bot executes itself
+func (s *Slack) freeze(cmd common.Command) *common.PolicyFreeze {
+
+	if s.policy == nil || cmd == nil {
+		return nil
+	}
+
+	groupName := cmd.Name()
+	if !utils.IsEmpty(cmd.Group()) {
+		groupName = fmt.Sprintf("%s/%s", cmd.Group(), groupName)
+	}
+	return s.policy.Freeze(groupName, time.Now())
+}
+
+// checkParams applies rules of policy with params, they're known once params are parsed or form is submitted.
+// Freezes which block commands are checked here too, those which need approval are left to approvalNeeded.
+func (s *Slack) checkParams(m *SlackMessage, cmd common.Command, params common.ExecuteParams) error {
+
+	if s.policy == nil {
+		return nil
+	}
+
+	groupName := cmd.Name()
+	if !utils.IsEmpty(cmd.Group()) {
+		groupName = fmt.Sprintf("%s/%s", cmd.Group(), groupName)
+	}
+	if f := s.freeze(cmd); f != nil && f.Action == common.PolicyFreezeBlock {
+		s.logger.Error("Slack command %s from %s is blocked by %s freeze", groupName, m.userID(), f.Name)
+		return fmt.Errorf("%w: %s %s", common.ErrCommandFrozen, groupName, f)
+	}
+
+	if m.user == nil || !cmd.Permissions() {
+		return nil
+	}
+	if s.auth != nil && s.auth.UserID == m.user.id {
+		return nil
+	}
+
+	channelID := ""
+	if m.key != nil {
+		channelID = m.key.channelID
+	}
+	if params == nil {
+		params = make(common.ExecuteParams)
+	}
+
+	req := s.policyRequest(m.user.id, m.user.name, channelID, groupName)
+	req.Params = params
+	d := s.policy.Check(req)
+	if d.Allowed {
+		return nil
+	}
+	s.logger.Error("Slack user %s is not permitted to execute %s with params: %s", m.user.id, groupName, d)
+	return fmt.Errorf("%w: %s %s", common.ErrCommandNotPermitted, groupName, d)
+}
+
+// UserGroups lists groups of the user which are matched by permissions and policy
+func (s *Slack) UserGroups(user common.User) []string {
+
+	if utils.IsEmpty(user) {
+		return []string{}
+	}
+	return s.userGroupNames(user.ID(), s.userGroups.items)
+}
+
+// Explain tells which rule allows or denies command, it checks command as listUserCommands does,
+// so names of users aren't matched by permissions
+func (s *Slack) Explain(user common.User, channel, command string) string {
+
+	if utils.IsEmpty(user) {
+		return "denied, user is unknown"
+	}
+	if s.auth != nil && s.auth.UserID == user.ID() {
+		return "allowed to bot itself"
+	}
+	if s.policy != nil {
+		return s.policy.Check(s.policyRequest(user.ID(), user.Name(), channel, command)).String()
+	}
+
+	groups := s.userGroups.items
+	if s.denyUserAccess(user.ID(), "", command) && s.denyGroupAccess(user.ID(), command, groups) {
+		return "denied, no permission allows it"
+	}
+	if p := s.userPermission(user.ID(), "", command); !utils.IsEmpty(p) {
+		return fmt.Sprintf("allowed by user permission %s", p)
+	}
+	if p := s.groupPermission(user.ID(), command, groups); !utils.IsEmpty(p) {
+		return fmt.Sprintf("allowed by group permission %s", p)
+	}
+	return "allowed, bot isn't authenticated to check permissions"
 }
 
-func (s *Slack) listUserCommands(userID string, groups []slack.UserGroup) []string {
+func (s *Slack) listUserCommands(userID, userName string, groups []slack.UserGroup) []string {
 
 	commands := []string{}
 
@@ -1789,7 +2153,11 @@ func (s *Slack) listUserCommands(userID string, groups []slack.UserGroup) []stri
 			if !utils.IsEmpty(p.Name()) {
 				groupName = p.Name() + "/" + groupName
 			}
-			if s.denyUserAccess(userID, "", groupName) && s.denyGroupAccess(userID, groupName, groups) {
+			if s.policy != nil {
+				if !s.policyAllowed(userID, userName, "", groupName) {
+					continue
+				}
+			} else if s.denyUserAccess(userID, "", groupName) && s.denyGroupAccess(userID, groupName, groups) {
 				continue
 			}
 			commands = append(commands, groupName)
@@ -2085,6 +2453,49 @@ func (s *Slack) UpdateMessage(channel, ID, message string) error {
 	return nil
 }
 
+func (s *Slack) UpdateText(channel, ID, message string) error {
+
+	options := []slack.MsgOption{slack.MsgOptionText(message, false)}
+
+	// known messages keep their blocks (e.g. actions), only the text block is replaced
+	key := &SlackMessageKey{channelID: channel, timestamp: ID}
+	m := s.findMessageInCache(key)
+
+	var blocks []slack.Block
+	if m != nil && len(m.blocks) > 0 {
+
+		text := slack.NewSectionBlock(
+			slack.NewTextBlockObject(slack.MarkdownType, message, false, false),
+			[]*slack.TextBlockObject{}, nil,
+		)
+		replaced := false
+		for _, block := range m.blocks {
+			if !replaced && block.BlockType() == slack.MBTSection {
+				blocks = append(blocks, text)
+				replaced = true
+				continue
+			}
+			blocks = append(blocks, block)
+		}
+		if !replaced {
+			blocks = append([]slack.Block{text}, blocks...)
+		}
+		options = append(options, slack.MsgOptionBlocks(blocks...))
+	}
+
+	_, _, _, err := s.client.SlackClient().UpdateMessage(channel, ID, options...)
+	if err != nil {
+		s.logger.Error("Slack couldn't update text of %s/%s: %s", channel, ID, err)
+		return err
+	}
+
+	if m != nil && len(blocks) > 0 {
+		m.blocks = blocks
+		s.putMessageToCache(m)
+	}
+	return nil
+}
+
 func (s *Slack) textIsCommand(text string) bool {
 
 	prev := ""
@@ -2850,11 +3261,7 @@ func (s *Slack) cacheReplyForm(m *SlackMessage, fields SlackMessageFields, param
 	return nil
 }
 
-func (s *Slack) cacheAskApproval(m *SlackMessage, message, channel string,
-	approvalCmd common.Command, approvalParams common.ExecuteParams, replier *slacker.ResponseReplier) (string, error) {
-
-	approval := approvalCmd.Approval()
-	opts := []slacker.PostOption{}
+func (s *Slack) buildApprovalBlocks(message string, approval common.Approval) []slack.Block {
 
 	blocks := []slack.Block{}
 	blockID := common.UUID()
@@ -2906,8 +3313,20 @@ func (s *Slack) cacheAskApproval(m *SlackMessage, message, channel string,
 	cancel := slack.NewButtonBlockElement(cancelActionID, "", slack.NewTextBlockObject(slack.PlainTextType, s.options.ButtonRejectCaption, false, false))
 	cancel.Style = slack.Style(s.options.ButtonCancelStyle)
 
-	ab := slack.NewActionBlock(blockID, submit, cancel)
+	// requester can withdraw the request
+	withdrawActionID := s.encodeActionID(blockID, slackCancelButtonType, common.CancelActionName)
+	withdraw := slack.NewButtonBlockElement(withdrawActionID, "", slack.NewTextBlockObject(slack.PlainTextType, s.options.ButtonCancelCaption, false, false))
+
+	ab := slack.NewActionBlock(blockID, submit, cancel, withdraw)
 	blocks = append(blocks, ab)
+	return blocks
+}
+
+func (s *Slack) cacheAskApproval(m *SlackMessage, approval common.Approval, message, channel string,
+	approvalCmd common.Command, approvalParams common.ExecuteParams, replier *slacker.ResponseReplier) (string, error) {
+
+	opts := []slacker.PostOption{}
+	blocks := s.buildApprovalBlocks(message, approval)
 
 	var ts string
 	var err error
@@ -2921,6 +3340,10 @@ func (s *Slack) cacheAskApproval(m *SlackMessage, message, channel string,
 		return "", err
 	}
 
+	// approval and command share the run, so it can be cancelled before approval
+	s.messageRun(m)
+	s.putMessageToCache(m)
+
 	mNew := s.cloneMessage(m)
 	mNew.originKey = m.key
 	mNew.key = &SlackMessageKey{
@@ -2930,14 +3353,9 @@ func (s *Slack) cacheAskApproval(m *SlackMessage, message, channel string,
 	mNew.cmd = approvalCmd
 	mNew.params = approvalParams
 	mNew.blocks = blocks
+	mNew.approval = approval
 
-	// Set status tag to waiting_approval
-	if mNew.tags == nil {
-		mNew.tags = make(map[string]string)
-	}
-	mNew.tags["status"] = string(common.MessageStatusWaitingApproval)
-
-	s.putMessageToCache(mNew)
+	s.setMessageStatus(mNew, common.MessageStatusWaitingApproval)
 	return ts, nil
 }
 
@@ -3074,15 +3492,17 @@ func (s *Slack) cachePostUserCommand(m *SlackMessage, callback *slack.Interactio
 		s.putMessageToCache(m)
 	}
 
+	// replies share the run, command is running until it's executed with everything it posts
+	s.messageRun(m)
+	release := m.run.Hold()
+	defer release()
+
 	start := time.Now()
 	executor, message, attachments, actions, err := m.cmd.Execute(s, m, params, action)
 	if err != nil {
 		// Set status tag to failed
-		if m.tags == nil {
-			m.tags = make(map[string]string)
-		}
-		m.tags["status"] = string(common.MessageStatusFailed)
-		s.putMessageToCache(m)
+		m.result = common.NewMessageResult(message, attachments, nil, err)
+		s.setMessageStatus(m, common.MessageStatusFailed)
 		s.replyError(m, replier, err, "", attachments, nil)
 		return s.buildResponse(overwrite, response), err
 	}
@@ -3098,6 +3518,7 @@ func (s *Slack) cachePostUserCommand(m *SlackMessage, callback *slack.Interactio
 
 		k, blks, err := s.reply(m, message, s.getMessageChannel(m), replier, attachments, actions, r, &start, r.error)
 		if err != nil {
+			m.result = common.NewMessageResult(message, attachments, actions, err)
 			s.replyError(m, replier, err, "", attachments, nil)
 			return r, err
 		}
@@ -3131,16 +3552,20 @@ func (s *Slack) cachePostUserCommand(m *SlackMessage, callback *slack.Interactio
 
 	afterErr := executor.After(mNew)
 
-	// Set status tag based on execution result
-	if mNew.tags == nil {
-		mNew.tags = make(map[string]string)
+	// result is kept on both, as callers know origin message only
+	mNew.result = common.NewMessageResult(message, attachments, actions, afterErr)
+	if key != nil {
+		mNew.result.Channel = key.channelID
+		mNew.result.ID = key.timestamp
 	}
+	m.result = mNew.result
+
+	// Set status tag based on execution result
 	if afterErr == nil {
-		mNew.tags["status"] = string(common.MessageStatusDelivered)
+		s.setMessageStatus(mNew, common.MessageStatusDelivered)
 	} else {
-		mNew.tags["status"] = string(common.MessageStatusFailed)
+		s.setMessageStatus(mNew, common.MessageStatusFailed)
 	}
-	s.putMessageToCache(mNew)
 
 	return r, afterErr
 }
@@ -3174,15 +3599,19 @@ func (s *Slack) formNeeded(fields []common.Field, params map[string]interface{})
 	return len(required) > len(arr)
 }
 
-func (s *Slack) approvalNeeded(m *SlackMessage, cmd common.Command, params common.ExecuteParams) (string, string) {
+// approvalNeeded returns approval of the command, freeze escalates it or asks for one if command has no approval
+func (s *Slack) approvalNeeded(m *SlackMessage, cmd common.Command, params common.ExecuteParams) (common.Approval, string, string) {
 
 	if cmd == nil {
-		return "", ""
+		return nil, "", ""
 	}
 
 	approval := cmd.Approval()
+	if f := s.freeze(cmd); f != nil && f.Action == common.PolicyFreezeApproval {
+		approval = f.Approval(approval)
+	}
 	if approval == nil {
-		return "", ""
+		return nil, "", ""
 	}
 
 	chl := approval.Channel(s, m, params)
@@ -3194,9 +3623,9 @@ func (s *Slack) approvalNeeded(m *SlackMessage, cmd common.Command, params commo
 	message := approval.Message(s, m, params)
 	message = strings.TrimSpace(message)
 	if utils.IsEmpty(message) {
-		return "", chl
+		return approval, "", chl
 	}
-	return message, chl
+	return approval, message, chl
 }
 
 func (s *Slack) getFieldsByType(cmd common.Command, types []string) []string {
@@ -3260,7 +3689,7 @@ func (s *Slack) buildSlackUser(user *slack.User) *SlackUser {
 			timezone: user.TZ,
 			isBot:    user.IsBot,
 		}
-		u.commands = s.listUserCommands(user.ID, s.userGroups.items)
+		u.commands = s.listUserCommands(user.ID, user.Name, s.userGroups.items)
 	}
 	return u
 }
@@ -3429,10 +3858,17 @@ func (s *Slack) commandDefinition(cmd common.Command, group string) *slacker.Com
 			groupName = fmt.Sprintf("%s/%s", group, cName)
 		}
 
+		if !s.placed(u.id, key.channelID, groupName) {
+			s.logger.Error("Slack command %s can't be executed in channel %s", groupName, key.channelID)
+			s.removeReaction(m.typ, m.key, s.options.ReactionDoing)
+			s.unsupportedCommandHandler(cc)
+			return
+		}
+
 		if eCmd.Permissions() {
 
 			if def != s.defaultDefinition {
-				if len(u.commands) > 0 && !utils.Contains(u.commands, groupName) {
+				if !s.permitted(u, key.channelID, groupName) {
 					s.logger.Error("Slack user %s is not permitted to execute %s", u.id, groupName)
 					s.removeReaction(m.typ, m.key, s.options.ReactionDoing)
 					s.unsupportedCommandHandler(cc)
@@ -3478,10 +3914,17 @@ func (s *Slack) commandDefinition(cmd common.Command, group string) *slacker.Com
 				wrapperGroupName = fmt.Sprintf("%s/%s", rGroup, rCommand)
 			}
 
+			if !s.placed(u.id, key.channelID, wrapperGroupName) {
+				s.logger.Error("Slack command %s can't be executed in channel %s", wrapperGroupName, key.channelID)
+				s.removeReaction(m.typ, m.key, s.options.ReactionDoing)
+				s.unsupportedCommandHandler(cc)
+				return
+			}
+
 			if wrappedCmd.Permissions() {
 
 				if def != s.defaultDefinition {
-					if len(u.commands) > 0 && !utils.Contains(u.commands, wrapperGroupName) {
+					if !s.permitted(u, key.channelID, wrapperGroupName) {
 						s.logger.Debug("Slack user %s is not permitted to execute %s", m.userID(), wrapperGroupName)
 						s.removeReaction(m.typ, m.key, s.options.ReactionDoing)
 						s.unsupportedCommandHandler(cc)
@@ -3527,10 +3970,16 @@ func (s *Slack) commandDefinition(cmd common.Command, group string) *slacker.Com
 			}
 		}
 
-		message, channel := s.approvalNeeded(m, approvalCmd, approvalParams)
+		if err := s.checkParams(m, approvalCmd, approvalParams); err != nil {
+			s.replyError(m, replier, err, "", nil, nil)
+			s.addRemoveReactions(m.typ, m.key, s.options.ReactionFailed, s.options.ReactionDoing)
+			return
+		}
+
+		approval, message, channel := s.approvalNeeded(m, approvalCmd, approvalParams)
 		if !utils.IsEmpty(message) {
 			s.addRemoveReactions(m.typ, m.key, s.options.ReactionApproval, s.options.ReactionDoing)
-			_, err := s.cacheAskApproval(m, message, channel, approvalCmd, approvalParams, replier)
+			_, err := s.cacheAskApproval(m, approval, message, channel, approvalCmd, approvalParams, replier)
 			if err != nil {
 				s.replyError(m, replier, err, "", nil, nil)
 				s.addRemoveReactions(m.typ, m.key, s.options.ReactionFailed, s.options.ReactionApproval)
@@ -3568,6 +4017,11 @@ func (s *Slack) replaceMessage(m *SlackMessage, blocks []slack.Block) (string, e
 	if m == nil || m.key == nil {
 		return "", nil
 	}
+	// there is no response URL if message isn't replaced by interaction, e.g. approval via API
+	if utils.IsEmpty(m.responseURL) {
+		_, ts, _, err := s.client.SlackClient().UpdateMessage(m.key.channelID, m.key.timestamp, slack.MsgOptionBlocks(blocks...))
+		return ts, err
+	}
 	return s.client.SlackClient().PostEphemeral(m.key.channelID, m.userID(),
 		slack.MsgOptionBlocks(blocks...),
 		slack.MsgOptionReplaceOriginal(m.responseURL),
@@ -3595,7 +4049,7 @@ func (s *Slack) replaceApprovalMessage(m *SlackMessage, message string) (string,
 	return s.replaceMessage(m, blocks)
 }
 
-func (s *Slack) Command(channel, text string, user common.User, parent common.Message, response common.Response) (common.Message, error) {
+func (s *Slack) Command(channel, text string, values common.ExecuteParams, user common.User, parent common.Message, response common.Response) (common.Message, error) {
 
 	channelID := channel
 	threadTS := ""
@@ -3653,16 +4107,38 @@ func (s *Slack) Command(channel, text string, user common.User, parent common.Me
 		groupName = fmt.Sprintf("%s/%s", group, groupName)
 	}
 
-	if !utils.IsEmpty(user) {
-		userID := user.ID()
-		userCommands := user.Commands()
-		if !utils.Contains(userCommands, groupName) {
+	// denials are errors, so API callers know command isn't executed
+	if !s.placed(userID, channelID, groupName) {
+		s.logger.Debug("Slack command %s can't be executed in channel %s", groupName, channelID)
+		return nil, fmt.Errorf("%w: %s in channel %s", common.ErrCommandNotPermitted, groupName, channelID)
+	}
+
+	if mUser != nil {
+		userID := mUser.id
+		if !s.permitted(mUser, channelID, groupName) {
 			s.logger.Debug("Slack command user %s is not permitted to execute %s", userID, groupName)
-			return nil, nil
+			return nil, fmt.Errorf("%w: %s", common.ErrCommandNotPermitted, groupName)
 		}
 	}
 
+	// structured values replace form, so they are checked as form would do
+	if values != nil {
+		if params == nil {
+			params = make(common.ExecuteParams)
+		}
+		maps.Copy(params, values)
+	}
+
 	fields := cmd.Fields(s, parent, params, nil, nil)
+	if values != nil {
+		vParams, err := common.ValidateParams(fields, params)
+		if err != nil {
+			s.logger.Debug("Slack command %s has invalid params: %s", groupName, err)
+			return nil, err
+		}
+		params = vParams
+	}
+
 	if s.formNeeded(fields, params) {
 		s.logger.Debug("Slack command %s has no support for interaction mode", groupName)
 		return nil, nil
@@ -3685,6 +4161,8 @@ func (s *Slack) Command(channel, text string, user common.User, parent common.Me
 		m.key = key
 		m.originKey = mOrigin.key
 		m.fields.copyFrom(fields, true)
+		// status of the command must not change status of origin
+		m.tags = maps.Clone(mOrigin.tags)
 	} else {
 		m = &SlackMessage{
 			slack:       s,
@@ -3704,11 +4182,17 @@ func (s *Slack) Command(channel, text string, user common.User, parent common.Me
 		}
 	}
 
+	if err := s.checkParams(m, cmd, params); err != nil {
+		return nil, err
+	}
+
+	s.messageRun(m)
+	s.setMessageStatus(m, common.MessageStatusPending)
+
 	// Check if approval is needed
-	message, approvalChannel := s.approvalNeeded(m, cmd, params)
+	approval, message, approvalChannel := s.approvalNeeded(m, cmd, params)
 	if !utils.IsEmpty(message) {
-		s.putMessageToCache(m)
-		approvalTS, err := s.cacheAskApproval(m, message, approvalChannel, cmd, params, nil)
+		approvalTS, err := s.cacheAskApproval(m, approval, message, approvalChannel, cmd, params, nil)
 		if err != nil {
 			s.logger.Error("Slack command %s couldn't post approval from %s: %s", groupName, userID, err)
 			return nil, err
@@ -3728,25 +4212,99 @@ func (s *Slack) Command(channel, text string, user common.User, parent common.Me
 	if err != nil {
 		s.logger.Error("Slack command %s couldn't post from %s: %s", groupName, userID, err)
 		// Tag as failed
-		if m.tags == nil {
-			m.tags = make(map[string]string)
-		}
-		m.tags["status"] = string(common.MessageStatusFailed)
-		s.putMessageToCache(m)
+		s.setMessageStatus(m, common.MessageStatusFailed)
 		return m, err
 	}
 
 	// Tag as delivered
-	if m.tags == nil {
-		m.tags = make(map[string]string)
-	}
-	m.tags["status"] = string(common.MessageStatusDelivered)
-	s.putMessageToCache(m)
+	s.setMessageStatus(m, common.MessageStatusDelivered)
 
 	return m, nil
 }
 
 // this method is needed to post custom messages
+// AskApproval is used by approvals which aren't bound to a command, e.g. runbook steps
+func (s *Slack) AskApproval(channel, message string, approval common.Approval, user common.User, parent common.Message, callback common.ApprovalFunc) (string, error) {
+
+	if approval == nil || callback == nil {
+		return "", fmt.Errorf("Slack approval is not defined")
+	}
+
+	channelID := channel
+	threadTS := ""
+
+	var mOrigin *SlackMessage
+	if !utils.IsEmpty(parent) {
+		m, ok := parent.(*SlackMessage)
+		if ok {
+			if m.key == nil {
+				mOrigin = m
+			} else {
+				mOrigin = s.findMessageInCache(m.key)
+			}
+			if mOrigin != nil && mOrigin.key != nil {
+				if utils.IsEmpty(channelID) {
+					channelID = mOrigin.key.channelID
+				}
+				// thread is possible only within the same channel
+				if channelID == mOrigin.key.channelID {
+					threadTS = mOrigin.key.threadTS
+				}
+			}
+		}
+	}
+
+	if utils.IsEmpty(channelID) {
+		return "", fmt.Errorf("Slack approval has no channel")
+	}
+
+	blocks := s.buildApprovalBlocks(message, approval)
+
+	options := []slack.MsgOption{}
+	options = append(options, slack.MsgOptionBlocks(blocks...), slack.MsgOptionDisableLinkUnfurl())
+	if !utils.IsEmpty(threadTS) {
+		options = append(options, slack.MsgOptionTS(threadTS))
+	}
+
+	_, ts, err := s.client.SlackClient().PostMessage(channelID, options...)
+	if err != nil {
+		return "", err
+	}
+
+	key := &SlackMessageKey{
+		channelID: channelID,
+		timestamp: ts,
+		threadTS:  threadTS,
+	}
+
+	var m *SlackMessage
+	if mOrigin != nil {
+		m = s.cloneMessage(mOrigin)
+		m.originKey = mOrigin.key
+	} else {
+		var mUser *SlackUser
+		if u, ok := user.(*SlackUser); ok {
+			mUser = u
+		}
+		m = &SlackMessage{
+			slack:   s,
+			typ:     slackMessageType,
+			user:    mUser,
+			caller:  mUser,
+			visible: true,
+		}
+	}
+	m.key = key
+	m.blocks = blocks
+	m.actions = nil
+	m.approvalCallback = callback
+	m.approval = approval
+	// clone shares tags with origin, so status must not be set there
+	m.tags = nil
+	s.setMessageStatus(m, common.MessageStatusWaitingApproval)
+	return ts, nil
+}
+
 func (s *Slack) PostMessage(channel string, message string, attachments []*common.Attachment, actions []common.Action,
 	user common.User, parent common.Message, response common.Response) (string, error) {
 
@@ -4442,8 +5000,15 @@ func (s *Slack) handleFormButtonReaction(ctx *slacker.InteractionContext, m *Sla
 		m.mergeParams(params, nil)
 		s.putMessageToCache(m)
 
+		if err := s.checkParams(m, m.cmd, m.params); err != nil {
+			s.replyError(m, ctx.Response(), err, "", nil, nil)
+			s.removeMessage(m)
+			s.addRemoveReactions(m.typ, m.originKey, s.options.ReactionFailed, reaction)
+			return false
+		}
+
 		// check approval
-		message, channel := s.approvalNeeded(m, m.cmd, m.params)
+		approval, message, channel := s.approvalNeeded(m, m.cmd, m.params)
 		if !utils.IsEmpty(message) {
 
 			replier := ctx.Response()
@@ -4458,7 +5023,7 @@ func (s *Slack) handleFormButtonReaction(ctx *slacker.InteractionContext, m *Sla
 				}
 			}
 
-			_, err := s.cacheAskApproval(m, message, channel, m.cmd, params, replier)
+			_, err := s.cacheAskApproval(m, approval, message, channel, m.cmd, params, replier)
 			if err != nil {
 				s.replyError(m, replier, err, "", nil, nil)
 				s.addRemoveReactions(m.typ, m.originKey, s.options.ReactionFailed, s.options.ReactionApproval)
@@ -4470,7 +5035,7 @@ func (s *Slack) handleFormButtonReaction(ctx *slacker.InteractionContext, m *Sla
 
 		s.removeMessage(m)
 		s.addRemoveReactions(m.typ, m.originKey, s.options.ReactionDoing, reaction)
-		s.executeCommandAfterApprovalReaction(ctx, m, m.originKey, m.params, s.options.ReactionDoing)
+		s.executeCommandAfterApprovalReaction(ctx.Callback(), ctx.Response(), m, m.originKey, m.params, s.options.ReactionDoing)
 
 	default:
 		s.removeMessage(m)
@@ -4479,9 +5044,9 @@ func (s *Slack) handleFormButtonReaction(ctx *slacker.InteractionContext, m *Sla
 	return true
 }
 
-func (s *Slack) executeCommandAfterApprovalReaction(ctx *slacker.InteractionContext, m *SlackMessage, reactionKey *SlackMessageKey, params common.ExecuteParams, reaction string) bool {
+func (s *Slack) executeCommandAfterApprovalReaction(callback *slack.InteractionCallback, replier interface{}, m *SlackMessage,
+	reactionKey *SlackMessageKey, params common.ExecuteParams, reaction string) bool {
 
-	callback := ctx.Callback()
 	if m.cmd == nil {
 		s.logApprovalFailure(approvalReasonExecuteCmdNil, m, nil, nil)
 		return false
@@ -4489,72 +5054,40 @@ func (s *Slack) executeCommandAfterApprovalReaction(ctx *slacker.InteractionCont
 
 	r := s.buildResponse(false, s.messageResponses(m, false)...)
 
-	_, err := s.cachePostUserCommand(m, callback, ctx.Response(), params, nil, r, false)
+	_, err := s.cachePostUserCommand(m, callback, replier, params, nil, r, false)
 	if err != nil {
 		s.logger.Error("Slack couldn't post from %s: %s", m.userID(), err)
 		s.logApprovalFailure(approvalReasonExecuteFailed, m, nil, err)
 		s.addRemoveReactions(m.typ, reactionKey, s.options.ReactionFailed, reaction)
-		if m.tags == nil {
-			m.tags = make(map[string]string)
-		}
-		m.tags["status"] = string(common.MessageStatusFailed)
-		s.putMessageToCache(m)
+		s.setMessageStatus(m, common.MessageStatusFailed)
 		return false
 	}
 	s.addRemoveReactions(m.typ, reactionKey, s.options.ReactionDone, reaction)
-	if m.tags == nil {
-		m.tags = make(map[string]string)
-	}
-	m.tags["status"] = string(common.MessageStatusDelivered)
-	s.putMessageToCache(m)
+	s.setMessageStatus(m, common.MessageStatusDelivered)
 	return true
 }
 
-func (s *Slack) cacheHandleApprovalButtonReaction(ctx *slacker.InteractionContext, m *SlackMessage, name, reaction string) bool {
-
-	callback := ctx.Callback()
-	mInit := (*SlackMessage)(nil)
-	fail := func(reason string, err error) bool {
-		s.logApprovalFailure(reason, m, mInit, err)
-		if mInit != nil {
-			s.addRemoveReactions(mInit.typ, mInit.key, s.options.ReactionFailed, reaction)
-		}
-		return false
-	}
-
-	if m.cmd == nil {
-		return fail(approvalReasonCmdMissing, nil)
-	}
-
-	approval := m.cmd.Approval()
-	if approval == nil {
-		return fail(approvalReasonApprovalMissing, nil)
-	}
-
-	mInit = s.findInitMessageInCache(m)
-	if mInit == nil {
-		return fail(approvalReasonInitMissing, nil)
-	}
-
-	if !s.options.ApprovalAny && callback.User.ID == m.userID() {
-		return fail(approvalReasonSelfApproval, nil)
+func (d *SlackApprovalDecision) name() string {
+	if d.approved {
+		return slackSubmitAction
 	}
+	return slackCancelAction
+}
 
-	approvedRejected := ""
+func (s *Slack) approvalDecision(name, userID string) string {
 
 	mReaction := common.IfDef(name == slackSubmitAction, s.options.ReactionApproved, s.options.ReactionRejected)
 	mDef := common.IfDef(name == slackSubmitAction, s.options.ApprovedMessage, s.options.RejectedMessage)
-	if !utils.IsEmpty(mDef) {
-		user := fmt.Sprintf("<@%s>", callback.User.ID)
-		approvedRejected = fmt.Sprintf(mDef.(string), user, time.Now().Format("15:04:05"))
-		approvedRejected = fmt.Sprintf(":%s: %s", mReaction, approvedRejected)
+	if utils.IsEmpty(mDef) {
+		return ""
 	}
+	user := fmt.Sprintf("<@%s>", userID)
+	r := fmt.Sprintf(mDef.(string), user, time.Now().Format("15:04:05"))
+	return fmt.Sprintf(":%s: %s", mReaction, r)
+}
 
-	m.responseURL = callback.ResponseURL
-	_, err := s.replaceApprovalMessage(m, approvedRejected)
-	if err != nil {
-		return fail(approvalReasonReplaceFailed, err)
-	}
+// approvalValues returns reasons and description selected by approver
+func (s *Slack) approvalValues(callback *slack.InteractionCallback) (string, string) {
 
 	reasons := ""
 	description := ""
@@ -4592,14 +5125,104 @@ func (s *Slack) cacheHandleApprovalButtonReaction(ctx *slacker.InteractionContex
 	if !utils.IsEmpty(description) {
 		description = strings.TrimSpace(fmt.Sprintf("%s %s", s.options.ApprovalDescription, description))
 	}
+	return reasons, description
+}
+
+// approval with callback has no command to execute, the decision is passed to the callback
+func (s *Slack) cacheApprovalCallback(m *SlackMessage, d *SlackApprovalDecision) error {
+
+	if !s.options.ApprovalAny && d.approver.id == m.userID() {
+		s.logApprovalFailure(approvalReasonSelfApproval, m, nil, nil)
+		return common.ErrApprovalSelf
+	}
+
+	approvedRejected := s.approvalDecision(d.name(), d.approver.id)
+
+	if d.callback != nil {
+		m.responseURL = d.callback.ResponseURL
+	}
+	_, err := s.replaceApprovalMessage(m, approvedRejected)
+	if err != nil {
+		s.logApprovalFailure(approvalReasonReplaceFailed, m, nil, err)
+		return err
+	}
+
+	message := strings.TrimSpace(fmt.Sprintf("%s\n%s", d.reasons, d.description))
+
+	f := m.approvalCallback
+
+	// callback is called once, next clicks are ignored
+	m.approvalCallback = nil
+	m.approval = nil
+	if m.tags == nil {
+		m.tags = make(map[string]string)
+	}
+	status := common.MessageStatusRejected
+	if d.approved {
+		status = common.MessageStatusDelivered
+	}
+	s.setMessageStatus(m, status)
+
+	f(d.approved, d.approver, message)
+	return nil
+}
+
+// cacheApprovalDecision applies decision to the message which waits for approval
+func (s *Slack) cacheApprovalDecision(m *SlackMessage, d *SlackApprovalDecision, reaction string) error {
+
+	mInit := (*SlackMessage)(nil)
+	fail := func(reason string, err error) error {
+		s.logApprovalFailure(reason, m, mInit, err)
+		if mInit != nil {
+			s.addRemoveReactions(mInit.typ, mInit.key, s.options.ReactionFailed, reaction)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", reason, err)
+		}
+		return errors.New(reason)
+	}
+
+	if m.approvalCallback != nil {
+		return s.cacheApprovalCallback(m, d)
+	}
+
+	if m.cmd == nil {
+		return fail(approvalReasonCmdMissing, nil)
+	}
+
+	// freeze might escalate command which has no approval of its own
+	approval := m.approval
+	if approval == nil {
+		return fail(approvalReasonApprovalMissing, nil)
+	}
+
+	mInit = s.findInitMessageInCache(m)
+	if mInit == nil {
+		return fail(approvalReasonInitMissing, nil)
+	}
+
+	if !s.options.ApprovalAny && d.approver.id == m.userID() {
+		return fail(approvalReasonSelfApproval, common.ErrApprovalSelf)
+	}
+
+	approvedRejected := s.approvalDecision(d.name(), d.approver.id)
+
+	if d.callback != nil {
+		m.responseURL = d.callback.ResponseURL
+	}
+	_, err := s.replaceApprovalMessage(m, approvedRejected)
+	if err != nil {
+		return fail(approvalReasonReplaceFailed, err)
+	}
+	m.approval = nil
 
 	message := ""
-	if !utils.IsEmpty(reasons) {
-		message = reasons
+	if !utils.IsEmpty(d.reasons) {
+		message = d.reasons
 	}
 
-	if !utils.IsEmpty(description) {
-		message = fmt.Sprintf("%s\n%s", message, description)
+	if !utils.IsEmpty(d.description) {
+		message = fmt.Sprintf("%s\n%s", message, d.description)
 	}
 
 	if !utils.IsEmpty(approvedRejected) {
@@ -4614,15 +5237,11 @@ func (s *Slack) cacheHandleApprovalButtonReaction(ctx *slacker.InteractionContex
 		visible: approval.Visible(),
 	}
 
-	key, blocks, err := s.reply(mInit, message, "", ctx.Response(), nil, nil, r, nil, false)
+	key, blocks, err := s.reply(mInit, message, "", d.replier, nil, nil, r, nil, false)
 	if err != nil {
-		if name != slackSubmitAction {
+		if !d.approved {
 			// Rejection: notification failed, treat the whole action as failed
-			if m.tags == nil {
-				m.tags = make(map[string]string)
-			}
-			m.tags["status"] = string(common.MessageStatusFailed)
-			s.putMessageToCache(m)
+			s.setMessageStatus(m, common.MessageStatusFailed)
 			return fail(approvalReasonReplyFailed, err)
 		}
 		// Approval: notification to requester failed, but still proceed with execution
@@ -4635,33 +5254,41 @@ func (s *Slack) cacheHandleApprovalButtonReaction(ctx *slacker.InteractionContex
 	mNew.blocks = blocks
 	s.putMessageToCache(mNew)
 
-	if name == slackSubmitAction {
+	if d.approved {
 		mParent := s.findParentMessageInCache(m)
 		if mParent == nil {
 			return fail(approvalReasonParentMissing, nil)
 		}
-		success := s.executeCommandAfterApprovalReaction(ctx, mInit, mInit.key, mParent.params, reaction)
-		if m.tags == nil {
-			m.tags = make(map[string]string)
-		}
+		success := s.executeCommandAfterApprovalReaction(d.callback, d.replier, mInit, mInit.key, mParent.params, reaction)
 		if success {
-			m.tags["status"] = string(common.MessageStatusDelivered)
+			s.setMessageStatus(m, common.MessageStatusDelivered)
 		} else {
-			m.tags["status"] = string(common.MessageStatusFailed)
+			s.setMessageStatus(m, common.MessageStatusFailed)
 		}
-		s.putMessageToCache(m)
-		return success
+		return nil
 	}
 
 	// Approval was rejected
-	if m.tags == nil {
-		m.tags = make(map[string]string)
-	}
-	m.tags["status"] = string(common.MessageStatusRejected)
-	s.putMessageToCache(m)
+	s.setMessageStatus(m, common.MessageStatusRejected)
 
 	s.addRemoveReactions(mInit.typ, mInit.key, s.options.ReactionFailed, reaction)
-	return false
+	return nil
+}
+
+func (s *Slack) cacheHandleApprovalButtonReaction(ctx *slacker.InteractionContext, m *SlackMessage, name, reaction string) bool {
+
+	callback := ctx.Callback()
+	reasons, description := s.approvalValues(callback)
+
+	d := &SlackApprovalDecision{
+		approved:    name == slackSubmitAction,
+		approver:    s.buildSlackUser(&callback.User),
+		reasons:     reasons,
+		description: description,
+		callback:    callback,
+		replier:     ctx.Response(),
+	}
+	return s.cacheApprovalDecision(m, d, reaction) == nil
 }
 
 func (s *Slack) cacheHandleActionButton(ctx *slacker.InteractionContext, m *SlackMessage, name string) bool {
@@ -4703,6 +5330,26 @@ func (s *Slack) cacheHandleActionButton(ctx *slacker.InteractionContext, m *Slac
 	return true
 }
 
+// only requester can cancel the command with the button, others can reject approval
+func (s *Slack) cacheHandleCancelButton(ctx *slacker.InteractionContext, m *SlackMessage) bool {
+
+	callback := ctx.Callback()
+	user := s.buildSlackUser(&callback.User)
+
+	if user.id != m.userID() {
+		s.logger.Debug("Slack user %s can't cancel command of %s", user.id, m.userID())
+		return false
+	}
+
+	m.responseURL = callback.ResponseURL
+	err := s.cacheCancel(m, user)
+	if err != nil {
+		s.logger.Error("Slack couldn't cancel %s: %s", m.key.String(), err)
+		return false
+	}
+	return true
+}
+
 func (s *Slack) handleBlockActions(ctx *slacker.InteractionContext) {
 
 	callback := ctx.Callback()
@@ -4756,6 +5403,8 @@ func (s *Slack) handleBlockActions(ctx *slacker.InteractionContext) {
 		s.cacheHandleApprovalButtonReaction(ctx, mCache, name, s.options.ReactionApproval)
 	case slackActionButtonType:
 		s.cacheHandleActionButton(ctx, mCache, name)
+	case slackCancelButtonType:
+		s.cacheHandleCancelButton(ctx, mCache)
 	}
 }
 
@@ -5276,7 +5925,7 @@ func (t *Slack) saveCache() error {
 	return nil
 }
 
-func NewSlack(options SlackOptions, observability *common.Observability, processors *common.Processors) *Slack {
+func NewSlack(options SlackOptions, observability *common.Observability, processors *common.Processors, events *common.MessageEvents, policy *common.Policy) *Slack {
 
 	ttl := 1 * 60 * 60 * time.Second
 	if !utils.IsEmpty(options.CacheTTL) {
@@ -5303,6 +5952,10 @@ func NewSlack(options SlackOptions, observability *common.Observability, process
 	messageTagsOpts := []ttlcache.Option[string, []string]{ttlcache.WithTTL[string, []string](ttlTags)}
 	messageTags := ttlcache.New[string, []string](messageTagsOpts...)
 
+	if policy != nil && (!utils.IsEmpty(options.GroupPermissions) || !utils.IsEmpty(options.UserPermissions)) {
+		observability.Logs().Warn("Slack permissions are ignored as policy is used")
+	}
+
 	// Create slack instance first so we can use it in FromSlackMessageCache
 	slack := &Slack{
 		options:          options,
@@ -5312,6 +5965,8 @@ func NewSlack(options SlackOptions, observability *common.Observability, process
 		messages:         messages,
 		messageTags:      messageTags,
 		taggedMessageTTL: ttlTags,
+		events:           events,
+		policy:           policy,
 		formUpdates: formUpdatesState{
 			pending:   make(map[string]*PendingFormUpdate),
 			revisions: make(map[string]int64),
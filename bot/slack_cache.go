@@ -29,10 +29,11 @@ func cacheEntryAge(key string, cachedAt time.Time, now time.Time) time.Duration
 // It contains only the essential fields needed for caching and is designed for easy serialization.
 type SlackMessageCache struct {
 	// Basic identification
-	Type        string `json:"type"`
-	CommandText string `json:"command_text,omitempty"`
-	CommandName string `json:"command_name,omitempty"`
-	WrapperName string `json:"wrapper_name,omitempty"`
+	Type         string `json:"type"`
+	CommandText  string `json:"command_text,omitempty"`
+	CommandName  string `json:"command_name,omitempty"`
+	CommandGroup string `json:"command_group,omitempty"`
+	WrapperName  string `json:"wrapper_name,omitempty"`
 
 	// Keys
 	OriginChannelID string `json:"origin_channel_id,omitempty"`
@@ -88,6 +89,7 @@ func ToSlackMessageCache(sm *SlackMessage) (*SlackMessageCache, error) {
 	// Command and wrapper names
 	if sm.cmd != nil {
 		cache.CommandName = sm.cmd.Name()
+		cache.CommandGroup = sm.cmd.Group()
 	}
 	if sm.wrapper != nil {
 		cache.WrapperName = sm.wrapper.Name()
@@ -231,7 +233,7 @@ func FromSlackMessageCache(cache *SlackMessageCache, slack *Slack) (*SlackMessag
 
 	// Command and wrapper references need to be looked up from processors
 	if cache.CommandName != "" && slack.processors != nil {
-		sm.cmd = slack.processors.FindCommand("", cache.CommandName)
+		sm.cmd = slack.processors.FindCommand(cache.CommandGroup, cache.CommandName)
 	}
 
 	if cache.WrapperName != "" && slack.processors != nil {
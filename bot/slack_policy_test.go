@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/devopsext/chatops/common"
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/jellydator/ttlcache/v3"
+)
+
+func TestSlackPolicyScopes(t *testing.T) {
+
+	policy, err := common.NewPolicy(`
+roles:
+  - name: everyone
+    rules:
+      - allow: ["*"]
+bindings:
+  - role: everyone
+    users: ["*"]
+scopes:
+  - commands: ["prod/*"]
+    channels: ["#ops-prod"]
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s := &Slack{policy: policy}
+	s.channelNames.Store("C1", "ops-prod")
+	s.channelNames.Store("C2", "random")
+	u := &SlackUser{id: "U1", name: "john"}
+
+	if !s.placed(u.id, "C1", "prod/deploy") || !s.permitted(u, "C1", "prod/deploy") {
+		t.Error("prod command must be executed in ops-prod")
+	}
+	if s.placed(u.id, "C2", "prod/deploy") || s.permitted(u, "C2", "prod/deploy") {
+		t.Error("prod command must not be executed out of ops-prod")
+	}
+	if !s.placed(u.id, "D1", "help") {
+		t.Error("help must be executed everywhere")
+	}
+}
+
+func TestSlackPolicyFreezes(t *testing.T) {
+
+	policy, err := common.NewPolicy(`
+freezes:
+  - name: holidays
+    commands: [deploy]
+  - name: weekend
+    commands: [restart]
+    action: approval
+    channel: C-approvals
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s := &Slack{policy: policy, logger: sreCommon.NewLogs()}
+	m := &SlackMessage{key: &SlackMessageKey{channelID: "C1"}, user: &SlackUser{id: "U1", name: "john", timezone: "Europe/Berlin"}}
+
+	if err := s.checkParams(m, &MockCommand{name: "deploy"}, nil); !errors.Is(err, common.ErrCommandFrozen) {
+		t.Errorf("deploy must be blocked by freeze, got %v", err)
+	}
+	if err := s.checkParams(m, &MockCommand{name: "restart"}, nil); err != nil {
+		t.Errorf("restart must not be blocked, got %v", err)
+	}
+
+	approval, message, channel := s.approvalNeeded(m, &MockCommand{name: "restart"}, nil)
+	if approval == nil || !strings.Contains(message, "weekend") || channel != "C-approvals" {
+		t.Errorf("restart must need escalated approval, got %q in %s", message, channel)
+	}
+	if approval, _, _ := s.approvalNeeded(m, &MockCommand{name: "help"}, nil); approval != nil {
+		t.Error("help must not need approval")
+	}
+}
+
+func TestSlackPolicyFreezeApproval(t *testing.T) {
+
+	policy, err := common.NewPolicy(`
+freezes:
+  - name: weekend
+    commands: [restart]
+    action: approval
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s := &Slack{
+		policy:      policy,
+		logger:      sreCommon.NewLogs(),
+		messages:    ttlcache.New[string, *SlackMessage](),
+		messageTags: ttlcache.New[string, []string](),
+	}
+	user := &SlackUser{id: "U1", name: "john"}
+	cmd := &MockCommand{name: "restart"}
+	m := &SlackMessage{key: &SlackMessageKey{channelID: "C1", timestamp: "1"}, typ: slackSlachCommand, user: user, cmd: cmd}
+
+	approval, _, _ := s.approvalNeeded(m, cmd, nil)
+	if approval == nil || cmd.Approval() != nil {
+		t.Fatal("restart without approval must be escalated by freeze")
+	}
+
+	// approval message as it's sent for escalated command
+	m.approval = approval
+	s.setMessageStatus(m, common.MessageStatusWaitingApproval)
+	s.putMessageToCache(m)
+
+	// decision is checked up to requester, as approving it further calls Slack API
+	if err := s.Approve("1", true, user, ""); !errors.Is(err, common.ErrApprovalSelf) {
+		t.Errorf("escalated approval must be decided by other user, got %v", err)
+	}
+	if s.messageStatus(m) != common.MessageStatusWaitingApproval || m.approval == nil {
+		t.Error("escalated approval must still wait for decision")
+	}
+}
@@ -1,70 +1,1691 @@
 package bot
 
 import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/devopsext/chatops/common"
 	sreCommon "github.com/devopsext/sre/common"
 	"github.com/devopsext/utils"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/jellydator/ttlcache/v3"
 	"github.com/jinzhu/copier"
 )
 
 type TelegramOptions struct {
-	BotToken string
-	Debug    bool
-	Timeout  int
-	Offset   int
+	BotToken        string
+	Debug           bool
+	Timeout         int
+	Offset          int
+	UserPermissions string
+	CacheTTL        string
+	ErrorPrefix     string
+	Divider         string
+	ApprovalAny     bool
+}
+
+type TelegramMessageKey struct {
+	chatID    string
+	messageID string
+	replyToID string
+}
+
+type TelegramUser struct {
+	id       string
+	name     string
+	timezone string
+	commands []string
+	isBot    bool
+}
+
+type TelegramChannel struct {
+	id string
+}
+
+type TelegramMessage struct {
+	telegram *Telegram
+	cmdText  string
+	cmd      common.Command
+	group    string
+	key      *TelegramMessageKey
+	user     *TelegramUser
+	caller   *TelegramUser
+	visible  bool
+	text     string
+	actions  []common.Action
+	params   common.ExecuteParams
+	tags     map[string]string
+	approval common.ApprovalFunc
+	result   *common.MessageResult
+	run      *common.MessageRun // shared by messages of the command, cancels it
 }
 
 type Telegram struct {
-	options    TelegramOptions
-	processors *common.Processors
-	bot        *tgbotapi.BotAPI
-	logger     sreCommon.Logger
-	//metricer sre.MetricsCounter
+	options     TelegramOptions
+	processors  *common.Processors
+	bot         *tgbotapi.BotAPI
+	logger      sreCommon.Logger
+	meter       sreCommon.Meter
+	messages    *ttlcache.Cache[string, *TelegramMessage]
+	messageTags *ttlcache.Cache[string, []string]
+	tagMutex    sync.RWMutex
+	// buttons, API and cancel can decide approval at the same time
+	approvalMutex sync.Mutex
+	users         sync.Map
+	events        *common.MessageEvents
+	policy        *common.Policy
+}
+
+const (
+	telegramActionType    = "action"
+	telegramApprovalType  = "approval"
+	telegramCancelType    = "cancel"
+	telegramApprove       = "approve"
+	telegramReject        = "reject"
+	telegramMaxDataLength = 64
+	telegramMaxTextLength = 4096
+)
+
+// TelegramUser
+
+func (tu *TelegramUser) ID() string {
+	return tu.id
+}
+
+func (tu *TelegramUser) Name() string {
+	return tu.name
+}
+
+func (tu *TelegramUser) Email() string {
+	return ""
+}
+
+func (tu *TelegramUser) TimeZone() string {
+	return tu.timezone
+}
+
+func (tu *TelegramUser) Commands() []string {
+	return tu.commands
+}
+
+func (tu *TelegramUser) IsBot() bool {
+	return tu.isBot
+}
+
+// TelegramChannel
+
+func (tc *TelegramChannel) ID() string {
+	return tc.id
+}
+
+// TelegramMessageKey
+
+func (tmk *TelegramMessageKey) String() string {
+	return fmt.Sprintf("%s/%s", tmk.chatID, tmk.messageID)
+}
+
+// TelegramMessage
+
+func (tm *TelegramMessage) ID() string {
+	if tm.key == nil {
+		return ""
+	}
+	return tm.key.messageID
+}
+
+func (tm *TelegramMessage) Visible() bool {
+	return tm.visible
+}
+
+func (tm *TelegramMessage) User() common.User {
+	return tm.user
+}
+
+func (tm *TelegramMessage) Caller() common.User {
+	return tm.caller
+}
+
+func (tm *TelegramMessage) Channel() common.Channel {
+	if tm.key == nil {
+		return nil
+	}
+	return &TelegramChannel{id: tm.key.chatID}
+}
+
+func (tm *TelegramMessage) ParentID() string {
+	if tm.key == nil {
+		return ""
+	}
+	return tm.key.replyToID
+}
+
+func (tm *TelegramMessage) Context() context.Context {
+	return tm.run.Context()
+}
+
+func (tm *TelegramMessage) Hold() func() {
+	return tm.run.Hold()
+}
+
+func (tm *TelegramMessage) SetParentID(threadTS string) {
+	if tm.key == nil {
+		return
+	}
+	tm.key.replyToID = threadTS
+}
+
+// Telegram
+
+func (t *Telegram) Name() string {
+	return "Telegram"
+}
+
+func (t *Telegram) parseChatID(chatID string) (int64, error) {
+
+	id, err := strconv.ParseInt(strings.TrimSpace(chatID), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Telegram invalid chat ID %s: %s", chatID, err)
+	}
+	return id, nil
+}
+
+// API calls generate message IDs which are not real Telegram IDs, so ignore them
+func (t *Telegram) parseMessageID(messageID string) int {
+
+	id, err := strconv.Atoi(strings.TrimSpace(messageID))
+	if err != nil {
+		return 0
+	}
+	return id
+}
+
+func (t *Telegram) buildKey(m *tgbotapi.Message) *TelegramMessageKey {
+
+	key := &TelegramMessageKey{
+		chatID:    strconv.FormatInt(m.Chat.ID, 10),
+		messageID: strconv.Itoa(m.MessageID),
+	}
+	if m.ReplyToMessage != nil {
+		key.replyToID = strconv.Itoa(m.ReplyToMessage.MessageID)
+	}
+	return key
+}
+
+func (t *Telegram) findMessageInCache(key *TelegramMessageKey) *TelegramMessage {
+
+	if key == nil {
+		return nil
+	}
+	item := t.messages.Get(key.String())
+	if item == nil {
+		return nil
+	}
+	return item.Value()
+}
+
+func (t *Telegram) cloneMessage(m *TelegramMessage) *TelegramMessage {
+
+	if m == nil {
+		return nil
+	}
+	r := &TelegramMessage{}
+	err := copier.Copy(r, m)
+	if err != nil {
+		t.logger.Error("Telegram message copy error: %s", err)
+		return nil
+	}
+	return r
+}
+
+func (t *Telegram) putMessageToCache(m *TelegramMessage) {
+
+	if m == nil || m.key == nil {
+		return
+	}
+	keyStr := m.key.String()
+	t.messages.Set(keyStr, m, ttlcache.DefaultTTL)
+
+	if len(m.tags) == 0 {
+		return
+	}
+
+	t.tagMutex.Lock()
+	defer t.tagMutex.Unlock()
+
+	for k, v := range m.tags {
+		tagKey := fmt.Sprintf("%s:%s", k, v)
+		keys := []string{}
+		item := t.messageTags.Get(tagKey)
+		if item != nil {
+			keys = item.Value()
+		}
+		if utils.Contains(keys, keyStr) {
+			continue
+		}
+		keys = append(keys, keyStr)
+		t.messageTags.Set(tagKey, keys, ttlcache.DefaultTTL)
+	}
+}
+
+func (t *Telegram) setMessageStatus(m *TelegramMessage, status common.MessageStatus) {
+
+	if m == nil {
+		return
+	}
+	// cancelled command might still finish, but its status is kept
+	if status != common.MessageStatusCancelled && m.run.Cancelled() {
+		return
+	}
+	if m.tags == nil {
+		m.tags = make(map[string]string)
+	}
+	m.tags["status"] = string(status)
+	t.putMessageToCache(m)
+
+	if m.key != nil {
+		t.events.Publish(common.NewMessageEvent(t.Name(), m.key.messageID, m.key.chatID, status))
+	}
+}
+
+// userPermission returns user permission which allows command to the user
+func (t *Telegram) userPermission(userID, userName, command string) string {
+
+	permission, err := common.FindPermission(t.options.UserPermissions, command, func(re *regexp.Regexp) bool {
+		return re.MatchString(userID) || re.MatchString(userName)
+	})
+	if err != nil {
+		t.logger.Error("Telegram user permissions error: %s", err)
+		return ""
+	}
+	return permission
+}
+
+func (t *Telegram) denyUserAccess(userID, userName, command string) bool {
+
+	if utils.IsEmpty(t.options.UserPermissions) {
+		return true
+	}
+	return utils.IsEmpty(t.userPermission(userID, userName, command))
+}
+
+// UserGroups is empty, as Telegram has no groups of users
+func (t *Telegram) UserGroups(user common.User) []string {
+	return []string{}
+}
+
+// Explain tells which rule allows or denies command
+func (t *Telegram) Explain(user common.User, chatID, command string) string {
+
+	if utils.IsEmpty(user) {
+		return "denied, user is unknown"
+	}
+	if t.policy != nil {
+		return t.policy.Check(t.policyRequest(user.ID(), user.Name(), chatID, command, nil)).String()
+	}
+	if p := t.userPermission(user.ID(), user.Name(), command); !utils.IsEmpty(p) {
+		return fmt.Sprintf("allowed by user permission %s", p)
+	}
+	return "denied, no permission allows it"
+}
+
+// policyRequest has params, as Telegram has no forms and params are known with command
+func (t *Telegram) policyRequest(userID, userName, chatID, command string, params common.ExecuteParams) *common.PolicyRequest {
+	return &common.PolicyRequest{
+		Bot:      t.Name(),
+		UserID:   userID,
+		UserName: userName,
+		Channel:  chatID,
+		Command:  command,
+		Params:   params,
+	}
+}
+
+func (t *Telegram) listUserCommands(userID, userName string) []string {
+
+	commands := []string{}
+
+	for _, p := range t.processors.Items() {
+		for _, c := range p.Commands() {
+			groupName := c.Name()
+			if !utils.IsEmpty(p.Name()) {
+				groupName = p.Name() + "/" + groupName
+			}
+			if t.policy != nil {
+				if !t.policy.Allowed(t.policyRequest(userID, userName, "", groupName, nil)) {
+					continue
+				}
+			} else if t.denyUserAccess(userID, userName, groupName) {
+				continue
+			}
+			commands = append(commands, groupName)
+		}
+	}
+
+	// add fake command to check by length
+	if len(commands) == 0 {
+		commands = append(commands, common.UUID())
+	}
+	return commands
+}
+
+func (t *Telegram) buildUser(user *tgbotapi.User) *TelegramUser {
+
+	if user == nil {
+		return nil
+	}
+
+	id := strconv.Itoa(user.ID)
+	name := user.UserName
+	if utils.IsEmpty(name) {
+		name = strings.TrimSpace(fmt.Sprintf("%s %s", user.FirstName, user.LastName))
+	}
+
+	u := &TelegramUser{
+		id:    id,
+		name:  name,
+		isBot: user.IsBot,
+	}
+	u.commands = t.listUserCommands(u.id, u.name)
+
+	t.users.Store(id, u)
+	if !utils.IsEmpty(user.UserName) {
+		t.users.Store(strings.ToLower(user.UserName), u)
+	}
+	return u
+}
+
+// LookupUser finds a user by ID or username, Telegram has no API to look up arbitrary users,
+// so only users seen by the bot are known by username
+func (t *Telegram) LookupUser(identifier string) common.User {
+
+	identifier = strings.TrimPrefix(strings.TrimSpace(identifier), "@")
+	if utils.IsEmpty(identifier) {
+		return nil
+	}
+
+	if v, ok := t.users.Load(strings.ToLower(identifier)); ok {
+		return v.(*TelegramUser)
+	}
+
+	if _, err := strconv.Atoi(identifier); err != nil {
+		t.logger.Error("Telegram LookupUser: unknown user %s", identifier)
+		return nil
+	}
+
+	u := &TelegramUser{
+		id:   identifier,
+		name: identifier,
+	}
+	u.commands = t.listUserCommands(u.id, u.name)
+	return u
+}
+
+func (t *Telegram) matchParam(text, param string) map[string]string {
+
+	r := make(map[string]string)
+	re, err := regexp.Compile(param)
+	if err != nil {
+		t.logger.Error("Telegram param regex error: %s", err)
+		return r
+	}
+	match := re.FindStringSubmatch(text)
+	if len(match) == 0 {
+		return r
+	}
+
+	for i, name := range re.SubexpNames() {
+		if i != 0 && name != "" {
+			r[name] = match[i]
+		}
+	}
+	return r
+}
+
+// group command param1 param2
+// command param1 param2
+func (t *Telegram) findParams(text string) (common.ExecuteParams, common.Command, string) {
+
+	ep := make(common.ExecuteParams)
+
+	delim := " "
+	arr := strings.Fields(text)
+	if len(arr) == 0 {
+		return ep, nil, ""
+	}
+
+	group := arr[0]
+	name := ""
+	params := ""
+
+	if len(arr) > 1 {
+		name = arr[1]
+	}
+	if len(arr) > 2 {
+		params = strings.Join(arr[2:], delim)
+	}
+
+	cmd := t.processors.FindCommand(group, name)
+	if cmd == nil {
+		name = group
+		group = ""
+		params = strings.Join(arr[1:], delim)
+		cmd = t.processors.FindCommand(group, name)
+	}
+
+	if cmd == nil {
+		return ep, nil, ""
+	}
+
+	if !utils.IsEmpty(params) {
+		for _, p := range cmd.Params() {
+			for k, v := range t.matchParam(params, p) {
+				ep[k] = v
+			}
+			if len(ep) > 0 {
+				break
+			}
+		}
+	}
+	return ep, cmd, group
+}
+
+func (t *Telegram) updateCounters(group, command, userID string) {
+
+	labels := make(map[string]string)
+	if !utils.IsEmpty(group) {
+		labels["group"] = group
+	}
+	if !utils.IsEmpty(command) {
+		labels["command"] = command
+	}
+	labels["user_id"] = userID
+
+	t.meter.Counter("commands", "received", "Count of all received commands", labels, "telegram", "bot").Inc()
+}
+
+func (t *Telegram) encodeActionData(typ, name string) string {
+
+	data := fmt.Sprintf("%s|%s", typ, name)
+	if len(data) <= telegramMaxDataLength {
+		return data
+	}
+	// limit is in bytes, but runes must not be split
+	n := 0
+	for i, r := range data {
+		if i+utf8.RuneLen(r) > telegramMaxDataLength {
+			break
+		}
+		n = i + utf8.RuneLen(r)
+	}
+	return data[:n]
+}
+
+func (t *Telegram) decodeActionData(data string) (string, string) {
+
+	arr := strings.SplitN(data, "|", 2)
+	if len(arr) != 2 {
+		return "", data
+	}
+	return arr[0], arr[1]
+}
+
+func (t *Telegram) buildKeyboard(actions []common.Action) *tgbotapi.InlineKeyboardMarkup {
+
+	buttons := []tgbotapi.InlineKeyboardButton{}
+	for _, a := range actions {
+
+		name := a.Name()
+		if utils.IsEmpty(name) {
+			continue
+		}
+		label := name
+		if !utils.IsEmpty(a.Label()) {
+			label = a.Label()
+		}
+		typ := telegramActionType
+		if name == common.CancelActionName {
+			typ = telegramCancelType
+		}
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(label, t.encodeActionData(typ, name)))
+	}
+
+	if len(buttons) == 0 {
+		return nil
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(buttons...))
+	return &markup
+}
+
+func (t *Telegram) buildApprovalKeyboard() *tgbotapi.InlineKeyboardMarkup {
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Approve", t.encodeActionData(telegramApprovalType, telegramApprove)),
+		tgbotapi.NewInlineKeyboardButtonData("Reject", t.encodeActionData(telegramApprovalType, telegramReject)),
+		tgbotapi.NewInlineKeyboardButtonData("Cancel", t.encodeActionData(telegramCancelType, common.CancelActionName)),
+	))
+	return &markup
+}
+
+func (t *Telegram) limitText(text string) string {
+
+	r := []rune(text)
+	if len(r) <= telegramMaxTextLength {
+		return text
+	}
+	return string(r[:telegramMaxTextLength-3]) + "..."
+}
+
+func (t *Telegram) sendTyping(chatID int64) {
+
+	_, err := t.bot.Send(tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping))
+	if err != nil {
+		t.logger.Debug("Telegram couldn't send typing to %d: %s", chatID, err)
+	}
+}
+
+func (t *Telegram) sendAttachments(chatID int64, replyTo int, attachments []*common.Attachment) error {
+
+	for _, a := range attachments {
+
+		if a == nil {
+			continue
+		}
+
+		name := a.Title
+		if utils.IsEmpty(name) {
+			name = common.UUID()
+		}
+		file := tgbotapi.FileBytes{Name: name, Bytes: a.Data}
+
+		var c tgbotapi.Chattable
+		switch a.Type {
+		case common.AttachmentTypeImage:
+			photo := tgbotapi.NewPhotoUpload(chatID, file)
+			photo.Caption = a.Text
+			photo.ReplyToMessageID = replyTo
+			c = photo
+		case common.AttachmentTypeFile:
+			doc := tgbotapi.NewDocumentUpload(chatID, file)
+			doc.Caption = a.Text
+			doc.ReplyToMessageID = replyTo
+			c = doc
+		default:
+			text := string(a.Data)
+			if utils.IsEmpty(text) {
+				text = a.Text
+			}
+			if !utils.IsEmpty(a.Title) {
+				text = fmt.Sprintf("%s\n%s", a.Title, text)
+			}
+			if utils.IsEmpty(text) {
+				continue
+			}
+			msg := tgbotapi.NewMessage(chatID, t.limitText(text))
+			msg.ReplyToMessageID = replyTo
+			msg.DisableWebPagePreview = true
+			c = msg
+		}
+
+		_, err := t.bot.Send(c)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Telegram) send(chatID, replyTo, text string, attachments []*common.Attachment, actions []common.Action) (*TelegramMessageKey, error) {
+
+	id, err := t.parseChatID(chatID)
+	if err != nil {
+		return nil, err
+	}
+	replyToID := t.parseMessageID(replyTo)
+
+	if utils.IsEmpty(text) && len(attachments) == 0 {
+		return nil, nil
+	}
+
+	if utils.IsEmpty(text) {
+		return nil, t.sendAttachments(id, replyToID, attachments)
+	}
+
+	msg := tgbotapi.NewMessage(id, t.limitText(text))
+	msg.ReplyToMessageID = replyToID
+	msg.DisableWebPagePreview = true
+
+	keyboard := t.buildKeyboard(actions)
+	if keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+
+	sent, err := t.bot.Send(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.sendAttachments(id, sent.MessageID, attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &TelegramMessageKey{
+		chatID:    chatID,
+		messageID: strconv.Itoa(sent.MessageID),
+		replyToID: replyTo,
+	}
+	return key, nil
+}
+
+func (t *Telegram) replyError(m *TelegramMessage, err error) {
+
+	if m == nil || m.key == nil || err == nil {
+		return
+	}
+	text := err.Error()
+	if !utils.IsEmpty(t.options.ErrorPrefix) {
+		text = fmt.Sprintf("%s %s", t.options.ErrorPrefix, text)
+	}
+	_, err = t.send(m.key.chatID, m.key.messageID, text, nil, nil)
+	if err != nil {
+		t.logger.Error("Telegram couldn't reply error to %s: %s", m.key.String(), err)
+	}
+}
+
+func (t *Telegram) mergeActions(one []common.Action, two []common.Action) []common.Action {
+
+	r := []common.Action{}
+	names := []string{}
+	for _, a := range append(one, two...) {
+		if a == nil || utils.Contains(names, a.Name()) {
+			continue
+		}
+		names = append(names, a.Name())
+		r = append(r, a)
+	}
+	return r
+}
+
+// messageRun starts a new run for the command, unless message already has one which isn't cancelled
+func (t *Telegram) messageRun(m *TelegramMessage) {
+	if m.run == nil || m.run.Cancelled() {
+		m.run = common.NewMessageRun()
+	}
+}
+
+func (t *Telegram) cachePostUserCommand(m *TelegramMessage, params common.ExecuteParams, action common.Action) error {
+
+	// replies share the run, command is running until it's executed with everything it posts
+	t.messageRun(m)
+	release := m.run.Hold()
+	defer release()
+
+	executor, message, attachments, actions, err := m.cmd.Execute(t, m, params, action)
+	if err != nil {
+		m.result = common.NewMessageResult(message, attachments, nil, err)
+		t.setMessageStatus(m, common.MessageStatusFailed)
+		t.replyError(m, err)
+		return err
+	}
+	if action == nil {
+		actions = t.mergeActions(actions, m.cmd.Actions())
+	}
+
+	key, err := t.send(m.key.chatID, m.key.messageID, message, attachments, actions)
+	if err != nil {
+		m.result = common.NewMessageResult(message, attachments, actions, err)
+		t.setMessageStatus(m, common.MessageStatusFailed)
+		t.replyError(m, err)
+		return err
+	}
+
+	mNew := t.cloneMessage(m)
+	if key != nil {
+		mNew.key = key
+	}
+	mNew.text = message
+	mNew.actions = actions
+	mNew.params = params
+
+	if m.cmd.TrackMessages() && key != nil {
+		if mNew.tags == nil {
+			mNew.tags = make(map[string]string)
+		}
+		mNew.tags["cmd"] = m.cmd.Name()
+	}
+	t.putMessageToCache(mNew)
+
+	afterErr := executor.After(mNew)
+
+	// result is kept on both, as callers know origin message only
+	mNew.result = common.NewMessageResult(message, attachments, actions, afterErr)
+	if key != nil {
+		mNew.result.Channel = key.chatID
+		mNew.result.ID = key.messageID
+	}
+	m.result = mNew.result
+	if afterErr != nil {
+		t.setMessageStatus(mNew, common.MessageStatusFailed)
+		return afterErr
+	}
+	t.setMessageStatus(mNew, common.MessageStatusDelivered)
+	return nil
+}
+
+// allowed checks policy in the chat, params are nil until they're known.
+// Without policy commands of user are listed by permission regexes.
+func (t *Telegram) allowed(u *TelegramUser, chatID, groupName string, params common.ExecuteParams) bool {
+
+	if t.policy == nil {
+		return utils.Contains(u.commands, groupName)
+	}
+	return t.policy.Allowed(t.policyRequest(u.id, u.name, chatID, groupName, params))
+}
+
+// permitted checks scopes of policy for commands which need no permissions too
+func (t *Telegram) permitted(u *TelegramUser, cmd common.Command, chatID, groupName string, params common.ExecuteParams) bool {
+
+	if u == nil || !cmd.Permissions() {
+		return t.policy == nil || t.policy.CheckChannel(t.policyRequest("", "", chatID, groupName, nil)) == nil
+	}
+	if params == nil {
+		params = make(common.ExecuteParams)
+	}
+	return t.allowed(u, chatID, groupName, params)
+}
+
+// frozen returns freeze of the command, any freeze blocks it as approvals aren't supported
+func (t *Telegram) frozen(groupName string) *common.PolicyFreeze {
+
+	if t.policy == nil {
+		return nil
+	}
+	return t.policy.Freeze(groupName, time.Now())
+}
+
+func (t *Telegram) processMessage(m *tgbotapi.Message) {
+
+	u := t.buildUser(m.From)
+	if u == nil {
+		t.logger.Error("Telegram couldn't process command from unknown user")
+		return
+	}
+
+	text := strings.TrimSpace(fmt.Sprintf("%s %s", m.Command(), m.CommandArguments()))
+	params, cmd, group := t.findParams(text)
+	if cmd == nil {
+		t.logger.Debug("Telegram command not found for text: %s", text)
+		return
+	}
+
+	groupName := cmd.Name()
+	if !utils.IsEmpty(group) {
+		groupName = fmt.Sprintf("%s/%s", group, groupName)
+	}
+	t.updateCounters(group, cmd.Name(), u.id)
+
+	msg := &TelegramMessage{
+		telegram: t,
+		cmdText:  text,
+		cmd:      cmd,
+		group:    group,
+		key:      t.buildKey(m),
+		user:     u,
+		caller:   u,
+		visible:  true,
+		text:     m.Text,
+		params:   params,
+	}
+	t.putMessageToCache(msg)
+
+	if !t.permitted(u, cmd, msg.key.chatID, groupName, params) {
+		t.logger.Error("Telegram user %s is not permitted to execute %s", u.id, groupName)
+		t.replyError(msg, fmt.Errorf("you are not permitted to execute %s", groupName))
+		return
+	}
+
+	if f := t.frozen(groupName); f != nil {
+		t.logger.Error("Telegram command %s from %s is blocked by %s freeze", groupName, u.id, f.Name)
+		t.replyError(msg, fmt.Errorf("%s: %s", groupName, f))
+		return
+	}
+
+	fields := cmd.Fields(t, msg, params, nil, nil)
+	if t.formNeeded(fields, params) {
+		t.replyError(msg, fmt.Errorf("command %s requires a form which is not supported, please provide all required params", groupName))
+		return
+	}
+
+	if cmd.Approval() != nil {
+		t.replyError(msg, fmt.Errorf("command %s requires approval which is not supported", groupName))
+		return
+	}
+
+	t.sendTyping(m.Chat.ID)
+
+	err := t.cachePostUserCommand(msg, params, nil)
+	if err != nil {
+		t.logger.Error("Telegram couldn't post from %s: %s", u.id, err)
+	}
+}
+
+func (t *Telegram) processCallback(q *tgbotapi.CallbackQuery) {
+
+	defer func() {
+		_, err := t.bot.AnswerCallbackQuery(tgbotapi.NewCallback(q.ID, ""))
+		if err != nil {
+			t.logger.Debug("Telegram couldn't answer callback %s: %s", q.ID, err)
+		}
+	}()
+
+	typ, name := t.decodeActionData(q.Data)
+	switch typ {
+	case telegramApprovalType:
+		t.processApproval(q, name)
+		return
+	case telegramCancelType:
+		t.processCancel(q)
+		return
+	}
+	if typ != telegramActionType {
+		t.logger.Debug("Telegram callback type %s is not supported", typ)
+		return
+	}
+
+	m := t.findMessageInCache(t.buildKey(q.Message))
+	if m == nil || m.cmd == nil {
+		t.logger.Error("Telegram callback message %d is not found in cache", q.Message.MessageID)
+		return
+	}
+
+	var action common.Action
+	for _, a := range m.actions {
+		if a.Name() == name {
+			action = a
+			break
+		}
+	}
+	if action == nil {
+		t.logger.Error("Telegram action %s is not defined.", name)
+		return
+	}
+
+	u := t.buildUser(q.From)
+	groupName := m.cmd.Name()
+	if !utils.IsEmpty(m.group) {
+		groupName = fmt.Sprintf("%s/%s", m.group, groupName)
+	}
+	if !t.permitted(u, m.cmd, m.key.chatID, groupName, m.params) {
+		t.logger.Error("Telegram user %s is not permitted to execute %s", u.id, groupName)
+		return
+	}
+
+	mAction := t.cloneMessage(m)
+	mAction.caller = u
+
+	err := t.cachePostUserCommand(mAction, m.params, action)
+	if err != nil {
+		t.logger.Error("Telegram couldn't post action %s from %s: %s", name, u.id, err)
+	}
+}
+
+func (t *Telegram) processApproval(q *tgbotapi.CallbackQuery, name string) {
+
+	m := t.findMessageInCache(t.buildKey(q.Message))
+	if m == nil || !t.waitsApproval(m) {
+		t.logger.Error("Telegram approval message %d is not found in cache", q.Message.MessageID)
+		return
+	}
+
+	u := t.buildUser(q.From)
+	if u == nil {
+		return
+	}
+
+	err := t.approve(m, name == telegramApprove, u, "")
+	if err != nil {
+		t.logger.Error("Telegram user %s couldn't approve %s: %s", u.id, m.key.String(), err)
+	}
+}
+
+// only requester can cancel the command with the button
+func (t *Telegram) processCancel(q *tgbotapi.CallbackQuery) {
+
+	m := t.findMessageInCache(t.buildKey(q.Message))
+	if m == nil {
+		t.logger.Error("Telegram cancel message %d is not found in cache", q.Message.MessageID)
+		return
+	}
+
+	u := t.buildUser(q.From)
+	if u == nil || m.user == nil || m.user.id != u.id {
+		t.logger.Debug("Telegram user can't cancel command of %s", m.key.String())
+		return
+	}
+
+	err := t.cancel(m, u)
+	if err != nil {
+		t.logger.Error("Telegram user %s couldn't cancel %s: %s", u.id, m.key.String(), err)
+	}
+}
+
+// replaceApproval edits message without markup, so approval buttons are removed
+func (t *Telegram) replaceApproval(m *TelegramMessage, text string) {
+
+	chatID, err := t.parseChatID(m.key.chatID)
+	if err != nil {
+		t.logger.Error("Telegram couldn't update approval message %s: %s", m.key.String(), err)
+		return
+	}
+	edit := tgbotapi.NewEditMessageText(chatID, t.parseMessageID(m.key.messageID), t.limitText(text))
+	_, err = t.bot.Send(edit)
+	if err != nil {
+		t.logger.Error("Telegram couldn't update approval message %s: %s", m.key.String(), err)
+	}
 }
 
-func (t *Telegram) Name() string {
-	return "Telegram"
+func (t *Telegram) waitsApproval(m *TelegramMessage) bool {
+
+	t.approvalMutex.Lock()
+	defer t.approvalMutex.Unlock()
+	return m.approval != nil
 }
 
-func (t *Telegram) sendTyping(m *tgbotapi.Message) {
+// takeApproval swaps callback of the message out, so only one decision gets it
+func (t *Telegram) takeApproval(m *TelegramMessage) common.ApprovalFunc {
 
-	t.bot.Send(tgbotapi.NewChatAction(m.Chat.ID, tgbotapi.ChatTyping))
+	t.approvalMutex.Lock()
+	defer t.approvalMutex.Unlock()
+	callback := m.approval
+	m.approval = nil
+	return callback
 }
 
-func (t *Telegram) sendMessage(m *tgbotapi.Message, text string) {
+// cancel cancels command of the message, approval is rejected on behalf of the user
+func (t *Telegram) cancel(m *TelegramMessage, u *TelegramUser) error {
+
+	if t.messageStatus(m).Final() && !m.run.Running() {
+		return common.ErrMessageNotCancellable
+	}
+	m.run.Cancel()
+
+	if callback := t.takeApproval(m); callback != nil {
+		text := fmt.Sprintf("%s\n\nCancelled", m.text)
+		if u != nil {
+			text = fmt.Sprintf("%s by %s", text, u.name)
+		}
+		t.replaceApproval(m, text)
+		m.text = text
 
-	if !utils.IsEmpty(text) {
-		response := tgbotapi.NewMessage(m.Chat.ID, text)
-		t.bot.Send(response)
+		var approver common.User
+		if u != nil {
+			approver = u
+		}
+		callback(false, approver, "")
 	}
+
+	t.setMessageStatus(m, common.MessageStatusCancelled)
+	return nil
 }
 
-/*
-func (t *Telegram) processMessage(m *tgbotapi.Message) {
+// Cancel cancels command which is running or waits for approval
+func (t *Telegram) Cancel(messageID string, user common.User) error {
+
+	m := t.findMessageByID(messageID)
+	if m == nil {
+		return common.ErrMessageNotFound
+	}
+
+	var u *TelegramUser
+	if !utils.IsEmpty(user) {
+		tu, ok := user.(*TelegramUser)
+		if !ok {
+			tu = &TelegramUser{
+				id:       user.ID(),
+				name:     user.Name(),
+				timezone: user.TimeZone(),
+				commands: user.Commands(),
+			}
+		}
+		u = tu
+	}
+	// requester can cancel the command, others only approval as they could reject it
+	if u != nil && !t.waitsApproval(m) && (m.user == nil || m.user.id != u.id) {
+		return common.ErrCancelNotPermitted
+	}
+	return t.cancel(m, u)
+}
+
+// approve applies decision of buttons or API, reason is passed to the callback
+func (t *Telegram) approve(m *TelegramMessage, approved bool, u *TelegramUser, reason string) error {
+
+	if !t.options.ApprovalAny && m.user != nil && m.user.id == u.id {
+		return common.ErrApprovalSelf
+	}
+
+	// callback is called once, next clicks are ignored
+	callback := t.takeApproval(m)
+	if callback == nil {
+		return common.ErrApprovalNotPending
+	}
+
+	decision := "Rejected"
+	status := common.MessageStatusRejected
+	if approved {
+		decision = "Approved"
+		status = common.MessageStatusDelivered
+	}
+
+	text := fmt.Sprintf("%s\n\n%s by %s", m.text, decision, u.name)
+	if !utils.IsEmpty(reason) {
+		text = fmt.Sprintf("%s: %s", text, reason)
+	}
+
+	t.replaceApproval(m, text)
+	m.text = text
+	t.setMessageStatus(m, status)
+
+	callback(approved, u, reason)
+	return nil
+}
+
+// PendingApprovals returns messages which wait for approval, Telegram has approvals of runbook steps only
+func (t *Telegram) PendingApprovals() []*common.PendingApproval {
 
-		command := m.Command()
-		executor := t.processors.Executor(command)
-		if executor == nil {
-			t.logger.Debug("Command %s is not found", command)
-			return
+	r := []*common.PendingApproval{}
+	t.messages.Range(func(item *ttlcache.Item[string, *TelegramMessage]) bool {
+		m := item.Value()
+		if m == nil || m.key == nil || !t.waitsApproval(m) {
+			return true
+		}
+		p := &common.PendingApproval{
+			ID:      m.key.messageID,
+			Channel: m.key.chatID,
+			Command: m.cmdText,
+			Params:  m.params,
 		}
+		if m.user != nil {
+			p.User = m.user.id
+		}
+		r = append(r, p)
+		return true
+	})
+	sort.Slice(r, func(i, j int) bool { return t.parseMessageID(r[i].ID) < t.parseMessageID(r[j].ID) })
+	return r
+}
+
+// Approve makes the same decision as approval buttons do
+func (t *Telegram) Approve(messageID string, approved bool, user common.User, reason string) error {
+
+	m := t.findMessageByID(messageID)
+	if m == nil {
+		return common.ErrApprovalNotFound
+	}
+	if !t.waitsApproval(m) {
+		return common.ErrApprovalNotPending
+	}
 
-		t.sendTyping(m)
+	u, ok := user.(*TelegramUser)
+	if !ok {
+		u = &TelegramUser{
+			id:       user.ID(),
+			name:     user.Name(),
+			timezone: user.TimeZone(),
+			commands: user.Commands(),
+		}
+	}
+	return t.approve(m, approved, u, reason)
+}
 
-		_, err := executor.Execute(t, command, "", m.CommandArguments(), func(text string) bool {
+func (t *Telegram) formNeeded(fields []common.Field, params common.ExecuteParams) bool {
 
-			t.sendMessage(m, text)
+	for _, f := range fields {
+		if !f.Required() {
+			continue
+		}
+		if params == nil || utils.IsEmpty(params[f.Name()]) {
 			return true
-		})
+		}
+	}
+	return false
+}
+
+// Command executes a command on behalf of the user, commands with approvals are not supported,
+// commands with forms are supported if values of their fields are set
+func (t *Telegram) Command(channel, text string, values common.ExecuteParams, user common.User, parent common.Message, response common.Response) (common.Message, error) {
+
+	chatID := channel
+	replyToID := ""
+
+	if !utils.IsEmpty(parent) {
+		if utils.IsEmpty(chatID) && parent.Channel() != nil {
+			chatID = parent.Channel().ID()
+		}
+		replyToID = parent.ID()
+	}
+
+	if utils.IsEmpty(chatID) {
+		return nil, fmt.Errorf("Telegram command %s has no chat", text)
+	}
+
+	params, cmd, group := t.findParams(text)
+	if cmd == nil {
+		t.logger.Debug("Telegram command not found for text: %s", text)
+		return nil, nil
+	}
+
+	groupName := cmd.Name()
+	if !utils.IsEmpty(group) {
+		groupName = fmt.Sprintf("%s/%s", group, groupName)
+	}
+
+	var u *TelegramUser
+	userID := "unknown"
+	if !utils.IsEmpty(user) {
+		tu, ok := user.(*TelegramUser)
+		if ok {
+			u = tu
+		} else {
+			u = &TelegramUser{
+				id:       user.ID(),
+				name:     user.Name(),
+				timezone: user.TimeZone(),
+				commands: user.Commands(),
+			}
+		}
+		userID = u.id
+	}
+
+	if values != nil {
+		if params == nil {
+			params = make(common.ExecuteParams)
+		}
+		maps.Copy(params, values)
+	}
 
+	fields := cmd.Fields(t, parent, params, nil, nil)
+	if values != nil {
+		vParams, err := common.ValidateParams(fields, params)
 		if err != nil {
-			t.logger.Error(err)
+			t.logger.Debug("Telegram command %s has invalid params: %s", groupName, err)
+			return nil, err
+		}
+		params = vParams
+	}
+
+	if t.formNeeded(fields, params) {
+		t.logger.Debug("Telegram command %s has no support for interaction mode", groupName)
+		return nil, nil
+	}
+
+	// params are known now, so it's checked as command from chat is
+	if !t.permitted(u, cmd, chatID, groupName, params) {
+		t.logger.Debug("Telegram command user %s is not permitted to execute %s", userID, groupName)
+		return nil, fmt.Errorf("%w: %s", common.ErrCommandNotPermitted, groupName)
+	}
+
+	if f := t.frozen(groupName); f != nil {
+		t.logger.Debug("Telegram command %s is blocked by %s freeze", groupName, f.Name)
+		return nil, fmt.Errorf("%w: %s %s", common.ErrCommandFrozen, groupName, f)
+	}
+
+	if cmd.Approval() != nil {
+		t.logger.Debug("Telegram command %s has no support for approvals", groupName)
+		return nil, nil
+	}
+
+	m := &TelegramMessage{
+		telegram: t,
+		cmdText:  text,
+		cmd:      cmd,
+		group:    group,
+		key: &TelegramMessageKey{
+			chatID:    chatID,
+			messageID: fmt.Sprintf("%s-%s", userID, common.UUID()),
+			replyToID: replyToID,
+		},
+		user:    u,
+		caller:  u,
+		visible: response == nil || response.Visible(),
+		params:  params,
+	}
+	// nested commands are cancelled with their parent
+	if tp, ok := parent.(*TelegramMessage); ok && !utils.IsEmpty(tp) {
+		m.run = tp.run
+	}
+	t.messageRun(m)
+	t.setMessageStatus(m, common.MessageStatusPending)
+
+	err := t.cachePostUserCommand(m, params, nil)
+	if err != nil {
+		t.logger.Error("Telegram command %s couldn't post from %s: %s", groupName, userID, err)
+		t.setMessageStatus(m, common.MessageStatusFailed)
+		return m, err
+	}
+	t.setMessageStatus(m, common.MessageStatusDelivered)
+	return m, nil
+}
+
+func (t *Telegram) findMessageByID(messageID string) *TelegramMessage {
+
+	var found *TelegramMessage
+	t.messages.Range(func(item *ttlcache.Item[string, *TelegramMessage]) bool {
+		m := item.Value()
+		if m != nil && m.key != nil && m.key.messageID == messageID {
+			found = m
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+func (t *Telegram) messageStatus(m *TelegramMessage) common.MessageStatus {
+
+	status, ok := m.tags["status"]
+	if !ok {
+		return common.MessageStatusDelivered
+	}
+	return common.MessageStatus(status)
+}
+
+// GetMessageStatus returns the status of a message by its ID.
+func (t *Telegram) GetMessageStatus(messageID string) (common.MessageStatus, error) {
+
+	found := t.findMessageByID(messageID)
+	if found == nil {
+		return common.MessageStatusNotFound, nil
+	}
+	return t.messageStatus(found), nil
+}
+
+// GetMessageResult returns status and output of a command by its message ID.
+func (t *Telegram) GetMessageResult(messageID string) (*common.MessageResult, error) {
+
+	found := t.findMessageByID(messageID)
+	if found == nil {
+		return nil, nil
+	}
+
+	r := &common.MessageResult{}
+	if found.result != nil {
+		*r = *found.result
+	}
+	r.Command = found.cmdText
+	r.Status = t.messageStatus(found)
+	return r, nil
+}
+
+// Telegram bots can't react on messages with the API version we use
+func (t *Telegram) AddReaction(channel, ID, name string) error {
+	t.logger.Debug("Telegram reactions are not supported: %s/%s %s", channel, ID, name)
+	return nil
+}
+
+func (t *Telegram) RemoveReaction(channel, ID, name string) error {
+	t.logger.Debug("Telegram reactions are not supported: %s/%s %s", channel, ID, name)
+	return nil
+}
+
+func (t *Telegram) updateActions(channel, ID string, update func(actions []common.Action) []common.Action) error {
+
+	key := &TelegramMessageKey{chatID: channel, messageID: ID}
+	m := t.findMessageInCache(key)
+	if m == nil {
+		return fmt.Errorf("Telegram message %s is not found", key.String())
+	}
+
+	chatID, err := t.parseChatID(channel)
+	if err != nil {
+		return err
+	}
+
+	m.actions = update(m.actions)
+
+	markup := tgbotapi.NewInlineKeyboardMarkup()
+	keyboard := t.buildKeyboard(m.actions)
+	if keyboard != nil {
+		markup = *keyboard
+	}
+
+	_, err = t.bot.Send(tgbotapi.NewEditMessageReplyMarkup(chatID, t.parseMessageID(ID), markup))
+	if err != nil {
+		t.logger.Error("Telegram couldn't update actions of %s: %s", key.String(), err)
+		return err
+	}
+	t.putMessageToCache(m)
+	return nil
+}
+
+func (t *Telegram) AddAction(channel, ID string, action common.Action) error {
+	return t.AddActions(channel, ID, []common.Action{action})
+}
+
+func (t *Telegram) AddActions(channel, ID string, actions []common.Action) error {
+
+	return t.updateActions(channel, ID, func(old []common.Action) []common.Action {
+		return t.mergeActions(old, actions)
+	})
+}
+
+func (t *Telegram) RemoveAction(channel, ID, name string) error {
+
+	return t.updateActions(channel, ID, func(old []common.Action) []common.Action {
+		r := []common.Action{}
+		for _, a := range old {
+			if a.Name() != name {
+				r = append(r, a)
+			}
+		}
+		return r
+	})
+}
+
+func (t *Telegram) ClearActions(channel, ID string) error {
+
+	return t.updateActions(channel, ID, func(old []common.Action) []common.Action {
+		return []common.Action{}
+	})
+}
+
+// this method is needed to post custom messages
+func (t *Telegram) PostMessage(channel string, message string, attachments []*common.Attachment, actions []common.Action,
+	user common.User, parent common.Message, response common.Response) (string, error) {
+
+	chatID := channel
+	replyToID := ""
+
+	var mOrigin *TelegramMessage
+	if !utils.IsEmpty(parent) {
+		if m, ok := parent.(*TelegramMessage); ok {
+			mOrigin = m
+		}
+		if utils.IsEmpty(chatID) && parent.Channel() != nil {
+			chatID = parent.Channel().ID()
+		}
+		replyToID = parent.ID()
+	}
+
+	key, err := t.send(chatID, replyToID, message, attachments, actions)
+	if err != nil {
+		return "", err
+	}
+	if key == nil {
+		return "", nil
+	}
+
+	var m *TelegramMessage
+	if mOrigin != nil {
+		m = t.cloneMessage(mOrigin)
+		m.key = key
+		m.tags = nil
+		if mOrigin.cmd != nil && mOrigin.cmd.TrackMessages() {
+			m.tags = map[string]string{"cmd": mOrigin.cmd.Name()}
+		}
+	} else {
+		var u *TelegramUser
+		if tu, ok := user.(*TelegramUser); ok {
+			u = tu
+		}
+		m = &TelegramMessage{
+			telegram: t,
+			key:      key,
+			user:     u,
+			caller:   u,
+			visible:  true,
+		}
+	}
+	m.text = message
+	m.actions = actions
+	t.putMessageToCache(m)
+
+	return key.messageID, nil
+}
+
+// approval reasons and description are not supported by Telegram
+func (t *Telegram) AskApproval(channel, message string, approval common.Approval, user common.User, parent common.Message, callback common.ApprovalFunc) (string, error) {
+
+	if approval == nil || callback == nil {
+		return "", fmt.Errorf("Telegram approval is not defined")
+	}
+
+	chatID := channel
+	replyToID := ""
+
+	var mOrigin *TelegramMessage
+	if !utils.IsEmpty(parent) {
+		if m, ok := parent.(*TelegramMessage); ok {
+			mOrigin = m
+		}
+		if utils.IsEmpty(chatID) && parent.Channel() != nil {
+			chatID = parent.Channel().ID()
+		}
+		if parent.Channel() != nil && parent.Channel().ID() == chatID {
+			replyToID = parent.ID()
+		}
+	}
+
+	id, err := t.parseChatID(chatID)
+	if err != nil {
+		return "", err
+	}
+
+	msg := tgbotapi.NewMessage(id, t.limitText(message))
+	msg.ReplyToMessageID = t.parseMessageID(replyToID)
+	msg.DisableWebPagePreview = true
+	msg.ReplyMarkup = t.buildApprovalKeyboard()
+
+	sent, err := t.bot.Send(msg)
+	if err != nil {
+		return "", err
+	}
+
+	key := &TelegramMessageKey{
+		chatID:    chatID,
+		messageID: strconv.Itoa(sent.MessageID),
+		replyToID: replyToID,
+	}
+
+	var m *TelegramMessage
+	if mOrigin != nil {
+		m = t.cloneMessage(mOrigin)
+	} else {
+		var u *TelegramUser
+		if tu, ok := user.(*TelegramUser); ok {
+			u = tu
+		}
+		m = &TelegramMessage{
+			telegram: t,
+			user:     u,
+			caller:   u,
+			visible:  true,
+		}
+	}
+	m.key = key
+	m.text = message
+	m.actions = nil
+	m.approval = callback
+	m.tags = map[string]string{"status": string(common.MessageStatusWaitingApproval)}
+	t.putMessageToCache(m)
+
+	return key.messageID, nil
+}
+
+func (t *Telegram) DeleteMessage(channel, ID string) error {
+
+	chatID, err := t.parseChatID(channel)
+	if err != nil {
+		return err
+	}
+
+	_, err = t.bot.DeleteMessage(tgbotapi.NewDeleteMessage(chatID, t.parseMessageID(ID)))
+	if err != nil {
+		t.logger.Error("Telegram couldn't delete message %s/%s: %s", channel, ID, err)
+		return err
+	}
+	t.messages.Delete((&TelegramMessageKey{chatID: channel, messageID: ID}).String())
+	return nil
+}
+
+// Telegram bots can't read chat history, so only messages known by the bot are returned
+func (t *Telegram) ReadMessage(channel, ID, threadID string) (string, error) {
+
+	m := t.findMessageInCache(&TelegramMessageKey{chatID: channel, messageID: ID})
+	if m == nil {
+		return "", fmt.Errorf("Telegram message %s/%s is not found", channel, ID)
+	}
+	return m.text, nil
+}
+
+func (t *Telegram) ReadThread(channel, threadID string) ([]string, error) {
+
+	type item struct {
+		id   int
+		text string
+	}
+	items := []item{}
+
+	t.messages.Range(func(i *ttlcache.Item[string, *TelegramMessage]) bool {
+		m := i.Value()
+		if m == nil || m.key == nil || m.key.chatID != channel {
+			return true
+		}
+		if m.key.messageID == threadID || m.key.replyToID == threadID {
+			items = append(items, item{id: t.parseMessageID(m.key.messageID), text: m.text})
+		}
+		return true
+	})
+
+	if len(items) == 0 {
+		return nil, fmt.Errorf("Telegram thread %s/%s is not found", channel, threadID)
+	}
+
+	// message IDs are sequential within a chat
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].id < items[j].id
+	})
+
+	r := []string{}
+	for _, i := range items {
+		r = append(r, i.text)
+	}
+	return r, nil
+}
+
+func (t *Telegram) UpdateMessage(channel, ID, message string) error {
+
+	chatID, err := t.parseChatID(channel)
+	if err != nil {
+		return err
+	}
+
+	key := &TelegramMessageKey{chatID: channel, messageID: ID}
+	edit := tgbotapi.NewEditMessageText(chatID, t.parseMessageID(ID), t.limitText(message))
+
+	// keep actions, otherwise Telegram removes the keyboard
+	m := t.findMessageInCache(key)
+	if m != nil {
+		edit.ReplyMarkup = t.buildKeyboard(m.actions)
+	}
+
+	_, err = t.bot.Send(edit)
+	if err != nil {
+		t.logger.Error("Telegram couldn't update message %s: %s", key.String(), err)
+		return err
+	}
+
+	if m != nil {
+		m.text = message
+		t.putMessageToCache(m)
+	}
+	return nil
+}
+
+// TagMessage adds tags to an existing message in cache
+func (t *Telegram) TagMessage(channel, ID string, tags map[string]string) error {
+
+	key := &TelegramMessageKey{chatID: channel, messageID: ID}
+	m := t.findMessageInCache(key)
+	if m == nil {
+		return fmt.Errorf("message not found: %s", key.String())
+	}
+
+	if m.tags == nil {
+		m.tags = make(map[string]string)
+	}
+	for k, v := range tags {
+		m.tags[k] = v
+	}
+	t.putMessageToCache(m)
+	return nil
+}
+
+func (t *Telegram) FindMessagesByTag(key, value string) map[string]string {
+
+	r := make(map[string]string)
+
+	t.tagMutex.RLock()
+	item := t.messageTags.Get(fmt.Sprintf("%s:%s", key, value))
+	t.tagMutex.RUnlock()
+
+	if item == nil {
+		return r
+	}
+
+	for _, keyStr := range item.Value() {
+		parts := strings.SplitN(keyStr, "/", 2)
+		if len(parts) != 2 {
+			continue
 		}
+		m := t.findMessageInCache(&TelegramMessageKey{chatID: parts[0], messageID: parts[1]})
+		if m != nil && m.tags[key] == value {
+			r[keyStr] = parts[1]
+		}
+	}
+	return r
+}
+
+func (t *Telegram) SendImage(channelID, threadTS string, fileContent []byte, filename, initialComment string) error {
+
+	chatID, err := t.parseChatID(channelID)
+	if err != nil {
+		return err
+	}
+
+	photo := tgbotapi.NewPhotoUpload(chatID, tgbotapi.FileBytes{Name: filename, Bytes: fileContent})
+	photo.Caption = initialComment
+	photo.ReplyToMessageID = t.parseMessageID(threadTS)
+
+	_, err = t.bot.Send(photo)
+	if err != nil {
+		t.logger.Error("Telegram couldn't send image to %s: %s", channelID, err)
+		return err
 	}
-*/
+	return nil
+}
+
+// Telegram has no dividers, so a configured text line is posted instead
+func (t *Telegram) AddDivider(channel, ID string) error {
+
+	if utils.IsEmpty(channel) || utils.IsEmpty(t.options.Divider) {
+		return nil
+	}
+	_, err := t.send(channel, ID, t.options.Divider, nil, nil)
+	if err != nil {
+		t.logger.Error("Telegram couldn't add divider to %s: %s", channel, err)
+		return err
+	}
+	return nil
+}
+
 func (t *Telegram) start() {
 
 	bot, err := tgbotapi.NewBotAPI(t.options.BotToken)
@@ -75,6 +1696,8 @@ func (t *Telegram) start() {
 	bot.Debug = t.options.Debug
 	t.bot = bot
 
+	t.logger.Info("Telegram bot %s is connected", bot.Self.UserName)
+
 	u := tgbotapi.NewUpdate(t.options.Offset)
 	u.Timeout = t.options.Timeout
 
@@ -88,7 +1711,12 @@ func (t *Telegram) start() {
 
 	for update := range updates {
 		if update.Message != nil && update.Message.IsCommand() {
-			t.logger.Debug("Message: [%s] %s", update.Message.From.UserName, update.Message.Text)
+
+			from := ""
+			if update.Message.From != nil {
+				from = update.Message.From.UserName
+			}
+			t.logger.Debug("Message: [%s] %s", from, update.Message.Text)
 
 			m := tgbotapi.Message{}
 			copier.Copy(&m, update.Message)
@@ -96,13 +1724,20 @@ func (t *Telegram) start() {
 			wg.Add(1)
 			go func(m *tgbotapi.Message) {
 				defer wg.Done()
-				//t.processMessage(update.Message)
+				t.processMessage(m)
 			}(&m)
 		}
 		if update.CallbackQuery != nil && update.CallbackQuery.Message != nil {
-			t.logger.Debug("Callback: [%s] %s", update.CallbackQuery.Message.From.UserName, update.CallbackQuery.Message.Text)
+			t.logger.Debug("Callback: [%s] %s", update.CallbackQuery.From.UserName, update.CallbackQuery.Data)
+
+			wg.Add(1)
+			go func(q *tgbotapi.CallbackQuery) {
+				defer wg.Done()
+				t.processCallback(q)
+			}(update.CallbackQuery)
 		}
 	}
+	wg.Wait()
 }
 
 func (t *Telegram) Start(wg *sync.WaitGroup) {
@@ -123,16 +1758,48 @@ func (t *Telegram) Start(wg *sync.WaitGroup) {
 
 // Stop gracefully shuts down the Telegram bot
 func (t *Telegram) Stop() {
+
 	t.logger.Info("Stopping Telegram bot...")
-	// Add any cleanup code here if needed in the future
+	if t.bot != nil {
+		t.bot.StopReceivingUpdates()
+	}
+	t.messages.Stop()
+	t.messageTags.Stop()
 }
 
-func NewTelegram(options TelegramOptions, observability *common.Observability, processors *common.Processors) *Telegram {
+func NewTelegram(options TelegramOptions, observability *common.Observability, processors *common.Processors, events *common.MessageEvents, policy *common.Policy) *Telegram {
+
+	if utils.IsEmpty(options.BotToken) {
+		return nil
+	}
+
+	ttl := 1 * 60 * 60 * time.Second
+	if !utils.IsEmpty(options.CacheTTL) {
+		if newTTL, err := time.ParseDuration(options.CacheTTL); err == nil {
+			ttl = newTTL
+		} else {
+			observability.Logs().Error("Telegram couldn't parse cache TTL %s: %s", options.CacheTTL, err)
+		}
+	}
+
+	if policy != nil && !utils.IsEmpty(options.UserPermissions) {
+		observability.Logs().Warn("Telegram permissions are ignored as policy is used")
+	}
+
+	messages := ttlcache.New[string, *TelegramMessage](ttlcache.WithTTL[string, *TelegramMessage](ttl))
+	messageTags := ttlcache.New[string, []string](ttlcache.WithTTL[string, []string](ttl))
+
+	go messages.Start()
+	go messageTags.Start()
 
 	return &Telegram{
-		options:    options,
-		processors: processors,
-		logger:     observability.Logs(),
-		//metrics: observability.Metrics().Counter(),
+		options:     options,
+		processors:  processors,
+		logger:      observability.Logs(),
+		meter:       observability.Metrics(),
+		messages:    messages,
+		messageTags: messageTags,
+		events:      events,
+		policy:      policy,
 	}
 }
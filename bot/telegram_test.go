@@ -0,0 +1,331 @@
+package bot
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/devopsext/chatops/common"
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/jellydator/ttlcache/v3"
+	"github.com/stretchr/testify/require"
+)
+
+// mockProcessor implements common.Processor for testing
+type mockProcessor struct {
+	name     string
+	commands []common.Command
+}
+
+func (p *mockProcessor) Name() string               { return p.name }
+func (p *mockProcessor) Commands() []common.Command { return p.commands }
+
+func testTelegram() *Telegram {
+
+	processors := common.NewProcessors()
+	processors.Add(&mockProcessor{name: "k8s", commands: []common.Command{&MockCommand{name: "pods"}}})
+	processors.Add(&mockProcessor{name: "", commands: []common.Command{&MockCommand{name: "help"}}})
+
+	return &Telegram{
+		processors:  processors,
+		messages:    ttlcache.New[string, *TelegramMessage](),
+		messageTags: ttlcache.New[string, []string](),
+	}
+}
+
+func TestTelegramFindParams(t *testing.T) {
+
+	tg := testTelegram()
+
+	tests := []struct {
+		name    string
+		text    string
+		command string
+		group   string
+	}{
+		{name: "group command", text: "k8s pods namespace", command: "pods", group: "k8s"},
+		{name: "root command", text: "help me", command: "help", group: ""},
+		{name: "unknown command", text: "unknown pods", command: "", group: ""},
+		{name: "empty text", text: "  ", command: "", group: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, cmd, group := tg.findParams(tt.text)
+			if tt.command == "" {
+				require.Nil(t, cmd)
+				return
+			}
+			require.NotNil(t, cmd)
+			require.Equal(t, tt.command, cmd.Name())
+			require.Equal(t, tt.group, group)
+		})
+	}
+}
+
+func TestTelegramActionData(t *testing.T) {
+
+	tg := testTelegram()
+
+	data := tg.encodeActionData(telegramActionType, "restart")
+	typ, name := tg.decodeActionData(data)
+	require.Equal(t, telegramActionType, typ)
+	require.Equal(t, "restart", name)
+
+	long := tg.encodeActionData(telegramActionType, string(make([]byte, 100)))
+	require.LessOrEqual(t, len(long), telegramMaxDataLength)
+
+	runes := tg.encodeActionData(telegramActionType, strings.Repeat("ё", 40))
+	require.LessOrEqual(t, len(runes), telegramMaxDataLength)
+	require.True(t, utf8.ValidString(runes), "rune must not be split")
+}
+
+func TestTelegramTagMessage(t *testing.T) {
+
+	tg := testTelegram()
+
+	m := &TelegramMessage{key: &TelegramMessageKey{chatID: "-100", messageID: "42"}}
+	tg.putMessageToCache(m)
+
+	require.Error(t, tg.TagMessage("-100", "43", map[string]string{"alert": "a1"}))
+	require.NoError(t, tg.TagMessage("-100", "42", map[string]string{"alert": "a1"}))
+
+	found := tg.FindMessagesByTag("alert", "a1")
+	require.Equal(t, map[string]string{"-100/42": "42"}, found)
+
+	status, err := tg.GetMessageStatus("42")
+	require.NoError(t, err)
+	require.Equal(t, common.MessageStatusDelivered, status)
+
+	tg.setMessageStatus(m, common.MessageStatusFailed)
+	status, err = tg.GetMessageStatus("42")
+	require.NoError(t, err)
+	require.Equal(t, common.MessageStatusFailed, status)
+}
+
+func TestTelegramMessageResult(t *testing.T) {
+
+	tg := testTelegram()
+
+	result, err := tg.GetMessageResult("42")
+	require.NoError(t, err)
+	require.Nil(t, result)
+
+	m := &TelegramMessage{key: &TelegramMessageKey{chatID: "-100", messageID: "42"}}
+	m.result = common.NewMessageResult("done", nil, nil, nil)
+	tg.setMessageStatus(m, common.MessageStatusFailed)
+
+	result, err = tg.GetMessageResult("42")
+	require.NoError(t, err)
+	require.Equal(t, common.MessageStatusFailed, result.Status)
+	require.Equal(t, "done", result.Text)
+	require.Empty(t, result.Error)
+}
+
+func TestTelegramApprovals(t *testing.T) {
+
+	tg := testTelegram()
+
+	m := &TelegramMessage{
+		key:      &TelegramMessageKey{chatID: "-100", messageID: "42"},
+		user:     &TelegramUser{id: "1"},
+		cmdText:  "runbook deploy",
+		approval: func(approved bool, approver common.User, reasons string) {},
+	}
+	tg.putMessageToCache(m)
+	tg.putMessageToCache(&TelegramMessage{key: &TelegramMessageKey{chatID: "-100", messageID: "43"}})
+
+	approvals := tg.PendingApprovals()
+	require.Len(t, approvals, 1)
+	require.Equal(t, &common.PendingApproval{ID: "42", Channel: "-100", Command: "runbook deploy", User: "1"}, approvals[0])
+
+	user := common.NewGenericUser("1", "requester", "UTC", nil)
+	require.ErrorIs(t, tg.Approve("41", true, user, ""), common.ErrApprovalNotFound)
+	require.ErrorIs(t, tg.Approve("43", true, user, ""), common.ErrApprovalNotPending)
+	require.ErrorIs(t, tg.Approve("42", true, user, ""), common.ErrApprovalSelf)
+}
+
+func TestTelegramApprovalDecidedOnce(t *testing.T) {
+
+	tg := testTelegram()
+	tg.logger = sreCommon.NewLogs()
+
+	var calls atomic.Int32
+	// chat isn't real, so approval message isn't updated
+	m := &TelegramMessage{
+		key:      &TelegramMessageKey{chatID: "chat", messageID: "44"},
+		user:     &TelegramUser{id: "1"},
+		approval: func(approved bool, approver common.User, reasons string) { calls.Add(1) },
+	}
+	tg.putMessageToCache(m)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// buttons and API decide at the same time
+			errs <- tg.approve(m, i%2 == 0, &TelegramUser{id: "2", name: "approver"}, "")
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	decided := 0
+	for err := range errs {
+		if err == nil {
+			decided++
+			continue
+		}
+		require.ErrorIs(t, err, common.ErrApprovalNotPending)
+	}
+	require.Equal(t, 1, decided)
+	require.Equal(t, int32(1), calls.Load(), "callback must be called once")
+	require.ErrorIs(t, tg.approve(m, true, &TelegramUser{id: "2"}, ""), common.ErrApprovalNotPending)
+}
+
+func TestTelegramCancel(t *testing.T) {
+
+	tg := testTelegram()
+
+	run := common.NewMessageRun()
+	release := run.Hold()
+	defer release()
+
+	running := &TelegramMessage{key: &TelegramMessageKey{chatID: "-100", messageID: "51"}, user: &TelegramUser{id: "1"}, run: run}
+	tg.setMessageStatus(running, common.MessageStatusPending)
+	delivered := &TelegramMessage{key: &TelegramMessageKey{chatID: "-100", messageID: "52"}}
+	tg.setMessageStatus(delivered, common.MessageStatusDelivered)
+
+	require.ErrorIs(t, tg.Cancel("50", nil), common.ErrMessageNotFound)
+	require.ErrorIs(t, tg.Cancel("52", nil), common.ErrMessageNotCancellable)
+	// only requester can cancel running command
+	require.ErrorIs(t, tg.Cancel("51", common.NewGenericUser("2", "other", "UTC", nil)), common.ErrCancelNotPermitted)
+	require.False(t, run.Cancelled())
+	require.NoError(t, tg.Cancel("51", common.NewGenericUser("1", "requester", "UTC", nil)))
+	require.True(t, run.Cancelled())
+
+	// command which finishes after it's cancelled doesn't change the status
+	tg.setMessageStatus(running, common.MessageStatusDelivered)
+	status, err := tg.GetMessageStatus("51")
+	require.NoError(t, err)
+	require.Equal(t, common.MessageStatusCancelled, status)
+	require.ErrorIs(t, tg.Cancel("51", nil), common.ErrMessageNotCancellable)
+}
+
+func TestTelegramPolicy(t *testing.T) {
+
+	tg := testTelegram()
+	policy, err := common.NewPolicy(`
+roles:
+  - name: viewer
+    rules:
+      - allow: [help]
+  - name: ops
+    rules:
+      - allow: ["k8s/*"]
+bindings:
+  - role: viewer
+    users: ["*"]
+  - role: ops
+    channels: ["-100"]
+`)
+	require.NoError(t, err)
+	tg.policy = policy
+
+	u := &TelegramUser{id: "1", name: "john"}
+	u.commands = tg.listUserCommands(u.id, u.name)
+	require.Equal(t, []string{"help"}, u.commands)
+
+	require.True(t, tg.allowed(u, "-100", "k8s/pods", nil), "role of chat must be given")
+	require.False(t, tg.allowed(u, "-200", "k8s/pods", nil))
+}
+
+func TestTelegramPolicyScopes(t *testing.T) {
+
+	tg := testTelegram()
+	policy, err := common.NewPolicy(`
+scopes:
+  - commands: ["k8s/*"]
+    channels: ["-100"]
+`)
+	require.NoError(t, err)
+	tg.policy = policy
+
+	cmd := &MockCommand{name: "pods"}
+	require.True(t, tg.permitted(nil, cmd, "-100", "k8s/pods", nil))
+	require.False(t, tg.permitted(nil, cmd, "-200", "k8s/pods", nil), "scope must be checked for commands without permissions")
+	require.True(t, tg.permitted(nil, cmd, "-200", "help", nil))
+}
+
+func TestTelegramPolicyParams(t *testing.T) {
+
+	tg := testTelegram()
+	policy, err := common.NewPolicy(`
+roles:
+  - name: dev
+    rules:
+      - allow: ["k8s/*"]
+        when:
+          params:
+            namespace: [dev]
+bindings:
+  - role: dev
+    users: ["*"]
+`)
+	require.NoError(t, err)
+	tg.policy = policy
+
+	u := &TelegramUser{id: "1", name: "john"}
+	u.commands = tg.listUserCommands(u.id, u.name)
+	require.Contains(t, u.commands, "k8s/pods", "command must be listed before params are known")
+
+	cmd := &MockCommand{name: "pods"}
+	require.True(t, tg.allowed(u, "-100", "k8s/pods", common.ExecuteParams{"namespace": "dev"}))
+	require.False(t, tg.allowed(u, "-100", "k8s/pods", common.ExecuteParams{"namespace": "prod"}))
+	require.False(t, tg.allowed(u, "-100", "k8s/pods", common.ExecuteParams{}), "params without namespace must not be allowed")
+	require.True(t, tg.permitted(u, cmd, "-100", "k8s/pods", nil), "command without permissions is checked for channel only")
+}
+
+func TestTelegramPolicyFreezes(t *testing.T) {
+
+	tg := testTelegram()
+	policy, err := common.NewPolicy(`
+freezes:
+  - name: holidays
+    commands: ["k8s/*"]
+    action: approval
+`)
+	require.NoError(t, err)
+	tg.policy = policy
+
+	require.NotNil(t, tg.frozen("k8s/pods"), "freeze with approval must block as approvals aren't supported")
+	require.Nil(t, tg.frozen("help"))
+}
+
+func TestTelegramExplain(t *testing.T) {
+
+	tg := testTelegram()
+	tg.options.UserPermissions = "john=^k8s/.*$"
+	u := &TelegramUser{id: "1", name: "john"}
+
+	require.Equal(t, "allowed by user permission john=^k8s/.*$", tg.Explain(u, "-100", "k8s/pods"))
+	require.Equal(t, "denied, no permission allows it", tg.Explain(u, "-100", "help"))
+
+	policy, err := common.NewPolicy(`
+roles:
+  - name: viewer
+    rules:
+      - deny: ["k8s/*"]
+bindings:
+  - role: viewer
+    users: [john]
+`)
+	require.NoError(t, err)
+	tg.policy = policy
+	require.Equal(t, "denied by role viewer, rule deny k8s/*", tg.Explain(u, "-100", "k8s/pods"))
+	require.Empty(t, tg.UserGroups(u))
+}
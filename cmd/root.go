@@ -40,18 +40,28 @@ var mainWG sync.WaitGroup
 type RootOptions struct {
 	Logs    []string
 	Metrics []string
+	Policy  string
 }
 
 var httpServerInstance *server.HttpServer
 
 var httpServerOptions = server.HttpServerOptions{
-	Listen:      envGet("HTTP_SERVER_LISTEN", ":8081").(string),
-	AllowedCmds: strings.Split(envGet("HTTP_SERVER_ALLOWED_CMDS", "release").(string), ","),
+	Listen:        envGet("HTTP_SERVER_LISTEN", ":8081").(string),
+	AllowedCmds:   strings.Split(envGet("HTTP_SERVER_ALLOWED_CMDS", "release").(string), ","),
+	Identities:    envGet("HTTP_SERVER_IDENTITIES", "").(string),
+	CallbackHosts: strings.Split(envGet("HTTP_SERVER_CALLBACK_HOSTS", "").(string), ","),
+	ReplayWindow:  envGet("HTTP_SERVER_REPLAY_WINDOW", "5m").(string),
+	TLSCert:       envGet("HTTP_SERVER_TLS_CERT", "").(string),
+	TLSKey:        envGet("HTTP_SERVER_TLS_KEY", "").(string),
+	TLSClientCA:   envGet("HTTP_SERVER_TLS_CLIENT_CA", "").(string),
+	Alertmanager:  envGet("HTTP_SERVER_ALERTMANAGER", "").(string),
+	Hooks:         envGet("HTTP_SERVER_HOOKS", "").(string),
 }
 
 var rootOptions = RootOptions{
 	Logs:    strings.Split(envGet("LOGS", "stdout").(string), ","),
 	Metrics: strings.Split(envGet("METRICS", "prometheus").(string), ","),
+	Policy:  envGet("POLICY", "").(string),
 }
 
 var stdoutOptions = sreProvider.StdoutOptions{
@@ -74,6 +84,21 @@ var telegramOptions = bot.TelegramOptions{
 	Debug:    envGet("TELEGRAM_DEBUG", false).(bool),
 	Timeout:  envGet("TELEGRAM_TIMEOUT", 60).(int),
 	Offset:   envGet("TELEGRAM_OFFSET", 0).(int),
+
+	UserPermissions: envGet("TELEGRAM_USER_PERMISSIONS", "").(string),
+	CacheTTL:        envGet("TELEGRAM_CACHE_TTL", "1h").(string),
+	ErrorPrefix:     envGet("TELEGRAM_ERROR_PREFIX", "❌").(string),
+	Divider:         envGet("TELEGRAM_DIVIDER", "——————————").(string),
+	ApprovalAny:     envGet("TELEGRAM_APPROVAL_ANY", false).(bool),
+}
+
+var runbooksOptions = processor.RunbooksOptions{
+	Name:  envGet("RUNBOOKS_NAME", "runbook").(string),
+	Limit: envGet("RUNBOOKS_LIMIT", 10).(int),
+}
+
+var whoamiOptions = processor.WhoamiOptions{
+	Command: envGet("WHOAMI_COMMAND", "whoami").(string),
 }
 
 var slackOptions = bot.SlackOptions{
@@ -96,9 +121,10 @@ var slackOptions = bot.SlackOptions{
 	ErrorColor:        envGet("SLACK_ERROR_COLOR", "#ff0000").(string),
 	TitleConfirmation: envGet("SLACK_TITLE_CONFIRMATION", "Confirmation").(string),
 
-	ApprovedMessage: envGet("SLACK_APPROVED_MESSAGE", "approved").(string),
-	RejectedMessage: envGet("SLACK_REJECTED_MESSAGE", "rejected").(string),
-	WaitingMessage:  envGet("SLACK_WAITING_MESSAGE", "waiting for approval").(string),
+	ApprovedMessage:  envGet("SLACK_APPROVED_MESSAGE", "approved").(string),
+	RejectedMessage:  envGet("SLACK_REJECTED_MESSAGE", "rejected").(string),
+	CancelledMessage: envGet("SLACK_CANCELLED_MESSAGE", "cancelled by %s at %s").(string),
+	WaitingMessage:   envGet("SLACK_WAITING_MESSAGE", "waiting for approval").(string),
 
 	ReactionDoing:    envGet("SLACK_REACTION_DOING", "spinner").(string),
 	ReactionDone:     envGet("SLACK_REACTION_DONE", "white_check_mark").(string),
@@ -129,12 +155,14 @@ var slackOptions = bot.SlackOptions{
 }
 
 var defaultOptions = processor.DefaultOptions{
-	CommandsDir:  envGet("DEFAULT_COMMANDS_DIR", "").(string),
-	TemplatesDir: envGet("DEFAULT_TEMPLATES_DIR", "").(string),
-	RunbooksDir:  envGet("DEFAULT_RUNBOOKS_DIR", "").(string),
-	CommandExt:   envGet("DEFAULT_COMMAND_EXT", ".tpl").(string),
-	ConfigExt:    envGet("DEFAULT_CONFIG_EXT", ".yml").(string),
-	Error:        envGet("DEFAULT_ERROR", "Couldn't execute command").(string),
+	CommandsDir:          envGet("DEFAULT_COMMANDS_DIR", "").(string),
+	TemplatesDir:         envGet("DEFAULT_TEMPLATES_DIR", "").(string),
+	RunbooksDir:          envGet("DEFAULT_RUNBOOKS_DIR", "").(string),
+	RunbookRunsDir:       envGet("DEFAULT_RUNBOOK_RUNS_DIR", "").(string),
+	RunbookRunsRetention: envGet("DEFAULT_RUNBOOK_RUNS_RETENTION", "168h").(string),
+	CommandExt:           envGet("DEFAULT_COMMAND_EXT", ".tpl").(string),
+	ConfigExt:            envGet("DEFAULT_CONFIG_EXT", ".yml").(string),
+	Error:                envGet("DEFAULT_ERROR", "Couldn't execute command").(string),
 }
 
 func envGet(s string, def interface{}) interface{} {
@@ -168,7 +196,21 @@ func interceptSyscall() {
 	}()
 }
 
-func buildDefaultProcessors(options processor.DefaultOptions, obs *common.Observability, processors *common.Processors) error {
+func buildRunbookStore(options processor.DefaultOptions) (*common.RunbookStore, error) {
+
+	var retention time.Duration
+	if !utils.IsEmpty(options.RunbookRunsRetention) {
+		d, err := time.ParseDuration(options.RunbookRunsRetention)
+		if err != nil {
+			return nil, err
+		}
+		retention = d
+	}
+	return common.NewRunbookStore(options.RunbookRunsDir, retention)
+}
+
+func buildDefaultProcessors(options processor.DefaultOptions, obs *common.Observability, processors *common.Processors,
+	runs *common.RunbookStore) error {
 
 	logger := obs.Logs()
 	first, err := os.ReadDir(options.CommandsDir)
@@ -201,7 +243,7 @@ func buildDefaultProcessors(options processor.DefaultOptions, obs *common.Observ
 				return err
 			}
 
-			dirProcessor := processor.NewDefault(name1, options, obs, processors)
+			dirProcessor := processor.NewDefault(name1, options, obs, processors, runs)
 			if utils.IsEmpty(dirProcessor) {
 				logger.Error("No default dir processor %s", name1)
 				return err
@@ -228,7 +270,7 @@ func buildDefaultProcessors(options processor.DefaultOptions, obs *common.Observ
 		}
 	}
 
-	rootProcessor := processor.NewDefault("", options, obs, processors)
+	rootProcessor := processor.NewDefault("", options, obs, processors, runs)
 	if utils.IsEmpty(rootProcessor) {
 		logger.Error("No default root processor")
 		return err
@@ -287,20 +329,40 @@ func Execute() {
 			obs := common.NewObservability(logs, metrics)
 			processors := common.NewProcessors()
 
-			err := buildDefaultProcessors(defaultOptions, obs, processors)
+			runs, err := buildRunbookStore(defaultOptions)
 			if err != nil {
+				logs.Error("Couldn't create runbook store, error %s", err)
+				os.Exit(1)
+			}
+
+			err = buildDefaultProcessors(defaultOptions, obs, processors, runs)
+			if err != nil {
+				os.Exit(1)
+			}
+			processors.Add(processor.NewRunbooks(runbooksOptions, obs, runs))
+			processors.Add(processor.NewWhoami(whoamiOptions, obs, processors))
+
+			policy, err := common.NewPolicy(rootOptions.Policy)
+			if err != nil {
+				logs.Error("Couldn't load policy, error %s", err)
 				os.Exit(1)
 			}
 
 			bots := common.NewBots()
-			//bots.Add(bot.NewTelegram(telegramOptions, obs, processors))
-			bots.Add(bot.NewSlack(slackOptions, obs, processors))
+			bots.SetRunbookStore(runs)
+			bots.SetProcessors(processors)
+			bots.Add(bot.NewTelegram(telegramOptions, obs, processors, bots.MessageEvents(), policy))
+			bots.Add(bot.NewSlack(slackOptions, obs, processors, bots.MessageEvents(), policy))
 
 			// Store bots reference for graceful shutdown
 			botsInstance = bots
 
 			// Create and start HTTP server (bots implements CommandExecutor)
-			httpServer := server.NewHttpServer(httpServerOptions, obs, bots)
+			httpServer, err := server.NewHttpServer(httpServerOptions, obs, bots)
+			if err != nil {
+				logs.Error("Couldn't create HTTP server, error %s", err)
+				os.Exit(1)
+			}
 			httpServerInstance = httpServer
 			httpServer.Start(&mainWG)
 
@@ -313,6 +375,7 @@ func Execute() {
 
 	flags.StringSliceVar(&rootOptions.Logs, "logs", rootOptions.Logs, "Log providers: stdout")
 	flags.StringSliceVar(&rootOptions.Metrics, "metrics", rootOptions.Metrics, "Metric providers: prometheus")
+	flags.StringVar(&rootOptions.Policy, "policy", rootOptions.Policy, "Policy file or content with roles and bindings, replaces permissions of bots")
 
 	flags.StringVar(&stdoutOptions.Format, "stdout-format", stdoutOptions.Format, "Stdout format: json, text, template")
 	flags.StringVar(&stdoutOptions.Level, "stdout-level", stdoutOptions.Level, "Stdout level: info, warn, error, debug, panic")
@@ -327,6 +390,12 @@ func Execute() {
 	flags.StringVar(&telegramOptions.BotToken, "telegram-bot-token", telegramOptions.BotToken, "Telegram bot token")
 	flags.BoolVar(&telegramOptions.Debug, "telegram-debug", telegramOptions.Debug, "Telegram debug")
 	flags.IntVar(&telegramOptions.Timeout, "telegram-timeout", telegramOptions.Timeout, "Telegram timeout")
+	flags.IntVar(&telegramOptions.Offset, "telegram-offset", telegramOptions.Offset, "Telegram offset")
+	flags.StringVar(&telegramOptions.UserPermissions, "telegram-user-permissions", telegramOptions.UserPermissions, "Telegram user permissions")
+	flags.StringVar(&telegramOptions.CacheTTL, "telegram-cache-ttl", telegramOptions.CacheTTL, "Telegram cache TTL")
+	flags.StringVar(&telegramOptions.ErrorPrefix, "telegram-error-prefix", telegramOptions.ErrorPrefix, "Telegram error prefix")
+	flags.StringVar(&telegramOptions.Divider, "telegram-divider", telegramOptions.Divider, "Telegram divider text")
+	flags.BoolVar(&telegramOptions.ApprovalAny, "telegram-approval-any", telegramOptions.ApprovalAny, "Telegram approval any")
 
 	flags.StringVar(&slackOptions.BotToken, "slack-bot-token", slackOptions.BotToken, "Slack bot token")
 	flags.StringVar(&slackOptions.AppToken, "slack-app-token", slackOptions.AppToken, "Slack app token")
@@ -345,6 +414,7 @@ func Execute() {
 	flags.StringVar(&slackOptions.WaitingMessage, "slack-waiting-message", slackOptions.WaitingMessage, "Slack waiting approval message")
 	flags.StringVar(&slackOptions.ApprovedMessage, "slack-approved-message", slackOptions.ApprovedMessage, "Slack approved message")
 	flags.StringVar(&slackOptions.RejectedMessage, "slack-rejected-message", slackOptions.RejectedMessage, "Slack rejected message")
+	flags.StringVar(&slackOptions.CancelledMessage, "slack-cancelled-message", slackOptions.CancelledMessage, "Slack cancelled message")
 	flags.StringVar(&slackOptions.CacheFileName, "slack-cache-file-name", slackOptions.CacheFileName, "Slack cache file name")
 	flags.StringVar(&slackOptions.CacheTTL, "slack-cache-ttl", slackOptions.CacheTTL, "Slack cache TTL")
 	flags.StringVar(&slackOptions.CacheTagMessagesTTL, "slack-cache-tag-messages-ttl", slackOptions.CacheTagMessagesTTL, "Slack cache tag messages TTL")
@@ -355,12 +425,27 @@ func Execute() {
 
 	flags.StringVar(&defaultOptions.CommandsDir, "default-commands-dir", defaultOptions.CommandsDir, "Default commands directory")
 	flags.StringVar(&defaultOptions.TemplatesDir, "default-templates-dir", defaultOptions.TemplatesDir, "Default templates directory")
+	flags.StringVar(&defaultOptions.RunbookRunsDir, "default-runbook-runs-dir", defaultOptions.RunbookRunsDir, "Default runbook runs directory")
+	flags.StringVar(&defaultOptions.RunbookRunsRetention, "default-runbook-runs-retention", defaultOptions.RunbookRunsRetention, "Default runbook runs retention")
 	flags.StringVar(&defaultOptions.CommandExt, "default-command-ext", defaultOptions.CommandExt, "Default command extension")
 	flags.StringVar(&defaultOptions.ConfigExt, "default-config-ext", defaultOptions.ConfigExt, "Default config extension")
 	flags.StringVar(&defaultOptions.Error, "default-error", defaultOptions.Error, "Default error")
 
+	flags.StringVar(&runbooksOptions.Name, "runbooks-name", runbooksOptions.Name, "Runbooks command group name, empty disables it")
+	flags.IntVar(&runbooksOptions.Limit, "runbooks-limit", runbooksOptions.Limit, "Runbooks history limit")
+
+	flags.StringVar(&whoamiOptions.Command, "whoami-command", whoamiOptions.Command, "Whoami command name, empty disables it")
+
 	flags.StringVar(&httpServerOptions.Listen, "http-server-listen", httpServerOptions.Listen, "HTTP server listen address (e.g., :8081)")
 	flags.StringSliceVar(&httpServerOptions.AllowedCmds, "http-server-allowed-cmds", httpServerOptions.AllowedCmds, "HTTP server allowed commands (comma-separated)")
+	flags.StringVar(&httpServerOptions.Identities, "http-server-identities", httpServerOptions.Identities, "HTTP server identities file or content with tokens, HMAC keys and allowed commands")
+	flags.StringSliceVar(&httpServerOptions.CallbackHosts, "http-server-callback-hosts", httpServerOptions.CallbackHosts, "HTTP server hosts which message status callbacks can be posted to (comma-separated, *.domain for subdomains)")
+	flags.StringVar(&httpServerOptions.ReplayWindow, "http-server-replay-window", httpServerOptions.ReplayWindow, "HTTP server window for signed request timestamps")
+	flags.StringVar(&httpServerOptions.TLSCert, "http-server-tls-cert", httpServerOptions.TLSCert, "HTTP server TLS certificate file")
+	flags.StringVar(&httpServerOptions.TLSKey, "http-server-tls-key", httpServerOptions.TLSKey, "HTTP server TLS key file")
+	flags.StringVar(&httpServerOptions.TLSClientCA, "http-server-tls-client-ca", httpServerOptions.TLSClientCA, "HTTP server CA bundle to verify client certificates")
+	flags.StringVar(&httpServerOptions.Alertmanager, "http-server-alertmanager", httpServerOptions.Alertmanager, "HTTP server Alertmanager routes file or content, alerts are mapped to commands")
+	flags.StringVar(&httpServerOptions.Hooks, "http-server-hooks", httpServerOptions.Hooks, "HTTP server hooks file or content, webhooks of other systems are mapped to commands")
 
 	interceptSyscall()
 
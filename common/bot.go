@@ -1,6 +1,7 @@
 package common
 
 import (
+	"errors"
 	"fmt"
 	"sync"
 
@@ -15,9 +16,84 @@ const (
 	MessageStatusFailed          MessageStatus = "failed"
 	MessageStatusWaitingApproval MessageStatus = "waiting_approval"
 	MessageStatusRejected        MessageStatus = "rejected"
+	MessageStatusCancelled       MessageStatus = "cancelled"
 	MessageStatusNotFound        MessageStatus = "not_found"
 )
 
+// MessageResult is what command replied with, status is current status of the message
+type MessageResult struct {
+	Status      MessageStatus
+	Text        string
+	Attachments []*Attachment
+	Actions     []Action
+	Error       string
+	// Command of the message, it's the one of the origin for replies and approvals
+	Command string
+	// Channel and ID of the reply, empty if nothing is posted
+	Channel string
+	ID      string
+}
+
+// Final is true if message status won't change anymore
+func (ms MessageStatus) Final() bool {
+	switch ms {
+	case MessageStatusPending, MessageStatusWaitingApproval:
+		return false
+	}
+	return true
+}
+
+func (mr *MessageResult) Final() bool {
+	return mr.Status.Final()
+}
+
+func NewMessageResult(text string, attachments []*Attachment, actions []Action, err error) *MessageResult {
+
+	r := &MessageResult{
+		Text:        text,
+		Attachments: attachments,
+		Actions:     actions,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// PendingApproval is a message which waits for approver decision
+type PendingApproval struct {
+	ID      string        `json:"id"`
+	Channel string        `json:"channel"`
+	Command string        `json:"command,omitempty"`
+	Params  ExecuteParams `json:"params,omitempty"`
+	User    string        `json:"user,omitempty"` // who asked for approval
+	Reasons []string      `json:"reasons,omitempty"`
+}
+
+var (
+	ErrApprovalNotFound   = errors.New("approval not found")
+	ErrApprovalNotPending = errors.New("message doesn't wait for approval")
+	ErrApprovalSelf       = errors.New("approver can't approve own request")
+
+	ErrMessageNotFound       = errors.New("message not found")
+	ErrMessageNotCancellable = errors.New("message is neither running nor waiting for approval")
+	ErrCancelNotPermitted    = errors.New("only requester or approver can cancel the command")
+	ErrCommandNotPermitted   = errors.New("command is not permitted")
+	ErrCommandFrozen         = errors.New("command is frozen")
+)
+
+// CancelActionName is the action which cancels command of the message, bots handle it themselves
+const CancelActionName = "chatops-cancel"
+
+// ApprovalFunc is called once approval is approved or rejected
+type ApprovalFunc = func(approved bool, approver User, reasons string)
+
+// TextUpdater is a bot which replaces only text of a message, so actions of the message are kept,
+// e.g. cancel button of runbook progress. UpdateMessage replaces the whole message.
+type TextUpdater interface {
+	UpdateText(channel, ID, message string) error
+}
+
 type Bot interface {
 	Start(wg *sync.WaitGroup)
 	Stop()
@@ -25,10 +101,13 @@ type Bot interface {
 	// Command executes a command and returns the resulting Message.
 	// Returns nil if no message was created (e.g., command not found).
 	// The Message.ID() can be used to track status via GetMessageStatus().
-	Command(channel, text string, user User, parent Message, response Response) (Message, error)
+	// Params are set instead of form fields, they're checked against command fields.
+	Command(channel, text string, params ExecuteParams, user User, parent Message, response Response) (Message, error)
 	// LookupUser finds a user by ID or email (for API calls when event triggered externally)
 	LookupUser(identifier string) User
 	GetMessageStatus(messageID string) (MessageStatus, error)
+	// GetMessageResult returns status and output of a command by message ID, nil if message is not found
+	GetMessageResult(messageID string) (*MessageResult, error)
 
 	AddReaction(channel, ID, name string) error
 	RemoveReaction(channel, ID, name string) error
@@ -48,11 +127,23 @@ type Bot interface {
 
 	SendImage(channelID, threadTS string, fileContent []byte, filename, initialComment string) error
 
+	// AskApproval posts an approval message, callback is called with the decision
+	AskApproval(channel, message string, approval Approval, user User, parent Message, callback ApprovalFunc) (string, error)
+	// PendingApprovals returns messages which wait for approval
+	PendingApprovals() []*PendingApproval
+	// Approve approves or rejects message which waits for approval, as if user pressed the button
+	Approve(messageID string, approved bool, user User, reason string) error
+	// Cancel stops command of the message which is running or waits for approval
+	Cancel(messageID string, user User) error
+
 	AddDivider(channel, ID string) error
 }
 
 type Bots struct {
-	list []Bot
+	list       []Bot
+	runs       *RunbookStore
+	events     *MessageEvents
+	processors *Processors
 }
 
 func (bs *Bots) Add(b Bot) {
@@ -91,7 +182,7 @@ func (bs *Bots) FindByName(name string) Bot {
 
 // ExecuteCommand implements CommandExecutor interface.
 // Returns the Message for tracking command status.
-func (bs *Bots) ExecuteCommand(botName, channel, command, userIdentifier string) (Message, error) {
+func (bs *Bots) ExecuteCommand(botName, channel, command, userIdentifier string, params ExecuteParams) (Message, error) {
 	bot := bs.FindByName(botName)
 	if bot == nil {
 		return nil, fmt.Errorf("bot %q not found", botName)
@@ -105,7 +196,7 @@ func (bs *Bots) ExecuteCommand(botName, channel, command, userIdentifier string)
 
 	response := NewGenericResponse(true)
 
-	return bot.Command(channel, command, user, nil, response)
+	return bot.Command(channel, command, params, user, nil, response)
 }
 
 // GetMessageStatus returns the status of a message by its ID.
@@ -118,6 +209,133 @@ func (bs *Bots) GetMessageStatus(botName, messageID string) (MessageStatus, erro
 	return bot.GetMessageStatus(messageID)
 }
 
+// GetMessageResult returns the result of a command by its message ID.
+func (bs *Bots) GetMessageResult(botName, messageID string) (*MessageResult, error) {
+	bot := bs.FindByName(botName)
+	if bot == nil {
+		return nil, fmt.Errorf("bot %q not found", botName)
+	}
+
+	return bot.GetMessageResult(messageID)
+}
+
+// TagMessage tags a message of the bot.
+func (bs *Bots) TagMessage(botName, channel, ID string, tags map[string]string) error {
+	bot := bs.FindByName(botName)
+	if bot == nil {
+		return fmt.Errorf("bot %q not found", botName)
+	}
+
+	return bot.TagMessage(channel, ID, tags)
+}
+
+// FindMessagesByTag returns messages of the bot by tag, "channel/ID" => ID.
+func (bs *Bots) FindMessagesByTag(botName, tagKey, tagValue string) (map[string]string, error) {
+	bot := bs.FindByName(botName)
+	if bot == nil {
+		return nil, fmt.Errorf("bot %q not found", botName)
+	}
+
+	return bot.FindMessagesByTag(tagKey, tagValue), nil
+}
+
+// UpdateMessage replaces text of a message of the bot.
+func (bs *Bots) UpdateMessage(botName, channel, ID, message string) error {
+	bot := bs.FindByName(botName)
+	if bot == nil {
+		return fmt.Errorf("bot %q not found", botName)
+	}
+
+	return bot.UpdateMessage(channel, ID, message)
+}
+
+// MessageEvents returns events which bots publish when message status is changed
+func (bs *Bots) MessageEvents() *MessageEvents {
+	return bs.events
+}
+
+// SetRunbookStore sets the store used to look up runbook runs
+func (bs *Bots) SetRunbookStore(runs *RunbookStore) {
+	bs.runs = runs
+}
+
+// PendingApprovals returns messages of the bot which wait for approval.
+func (bs *Bots) PendingApprovals(botName string) ([]*PendingApproval, error) {
+	bot := bs.FindByName(botName)
+	if bot == nil {
+		return nil, fmt.Errorf("bot %q not found", botName)
+	}
+
+	return bot.PendingApprovals(), nil
+}
+
+// Approve approves or rejects message on behalf of the user, self approval rules of the bot are applied.
+func (bs *Bots) Approve(botName, messageID string, approved bool, userIdentifier, reason string) error {
+	bot := bs.FindByName(botName)
+	if bot == nil {
+		return fmt.Errorf("bot %q not found", botName)
+	}
+
+	user := bot.LookupUser(userIdentifier)
+	if user == nil {
+		return fmt.Errorf("user %q not found", userIdentifier)
+	}
+
+	return bot.Approve(messageID, approved, user, reason)
+}
+
+// Cancel cancels command of the message on behalf of the user, user is optional.
+func (bs *Bots) Cancel(botName, messageID, userIdentifier string) error {
+	bot := bs.FindByName(botName)
+	if bot == nil {
+		return fmt.Errorf("bot %q not found", botName)
+	}
+
+	var user User
+	if !utils.IsEmpty(userIdentifier) {
+		user = bot.LookupUser(userIdentifier)
+		if user == nil {
+			return fmt.Errorf("user %q not found", userIdentifier)
+		}
+	}
+
+	return bot.Cancel(messageID, user)
+}
+
+// SetProcessors sets processors which commands are listed
+func (bs *Bots) SetProcessors(processors *Processors) {
+	bs.processors = processors
+}
+
+// ListCommands returns commands of all processors.
+func (bs *Bots) ListCommands() ([]*CommandInfo, error) {
+	if bs.processors == nil {
+		return nil, fmt.Errorf("commands are not known")
+	}
+
+	return bs.processors.CommandInfos(), nil
+}
+
+// GetRunbookRun returns a runbook run by its ID.
+func (bs *Bots) GetRunbookRun(runID string) (*RunbookRun, error) {
+	if bs.runs == nil {
+		return nil, fmt.Errorf("runbook runs are not tracked")
+	}
+
+	return bs.runs.Get(runID), nil
+}
+
+// ListRunbookRuns returns runbook runs, newest first.
+func (bs *Bots) ListRunbookRuns(name string, limit int) ([]*RunbookRun, error) {
+	if bs.runs == nil {
+		return nil, fmt.Errorf("runbook runs are not tracked")
+	}
+
+	return bs.runs.List(name, limit), nil
+}
+
 func NewBots() *Bots {
-	return &Bots{}
+	return &Bots{
+		events: NewMessageEvents(),
+	}
 }
@@ -0,0 +1,94 @@
+package common
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/devopsext/utils"
+)
+
+// MessageRun is shared by messages of a command, so the command can be cancelled with any of them
+type MessageRun struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	holds  atomic.Int32
+}
+
+// ContextMessage is a message which command can be cancelled, its context is done once it's cancelled.
+// Hold keeps command running until returned func is called, e.g. while runbook runs in background.
+type ContextMessage interface {
+	Context() context.Context
+	Hold() func()
+}
+
+// Context is background one for messages without run
+func (mr *MessageRun) Context() context.Context {
+	if mr == nil {
+		return context.Background()
+	}
+	return mr.ctx
+}
+
+func (mr *MessageRun) Hold() func() {
+
+	if mr == nil {
+		return func() {}
+	}
+
+	mr.holds.Add(1)
+	var done atomic.Bool
+	return func() {
+		if done.CompareAndSwap(false, true) {
+			mr.holds.Add(-1)
+		}
+	}
+}
+
+// Running is true while something holds the run and it isn't cancelled
+func (mr *MessageRun) Running() bool {
+	return mr != nil && mr.holds.Load() > 0 && mr.ctx.Err() == nil
+}
+
+func (mr *MessageRun) Cancelled() bool {
+	return mr != nil && mr.ctx.Err() != nil
+}
+
+// Cancel returns false if there is nothing to cancel
+func (mr *MessageRun) Cancel() bool {
+
+	if mr == nil || mr.Cancelled() {
+		return false
+	}
+	mr.cancel()
+	return true
+}
+
+// runs aren't bound to the bot context, as they are kept by messages which live in cache
+func NewMessageRun() *MessageRun {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MessageRun{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// MessageContext returns context of the message command, messages without it can't be cancelled
+func MessageContext(m Message) context.Context {
+
+	cm, ok := m.(ContextMessage)
+	if !ok || utils.IsEmpty(cm) {
+		return context.Background()
+	}
+	return cm.Context()
+}
+
+// MessageHold keeps command of the message running until returned func is called
+func MessageHold(m Message) func() {
+
+	cm, ok := m.(ContextMessage)
+	if !ok || utils.IsEmpty(cm) {
+		return func() {}
+	}
+	return cm.Hold()
+}
@@ -0,0 +1,94 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/devopsext/utils"
+)
+
+// CommandInfo describes a command for those who build their own UI on top of commands
+type CommandInfo struct {
+	Group       string              `json:"group,omitempty"`
+	Name        string              `json:"name"`
+	Command     string              `json:"command"` // how command is typed, group and name
+	Description string              `json:"description,omitempty"`
+	Params      []string            `json:"params,omitempty"`
+	Aliases     []string            `json:"aliases,omitempty"`
+	Fields      []*CommandFieldInfo `json:"fields,omitempty"`
+	Approval    bool                `json:"approval"`
+	Schedule    string              `json:"schedule,omitempty"`
+	Channel     string              `json:"channel,omitempty"`
+	Permissions bool                `json:"permissions"`
+}
+
+type CommandFieldInfo struct {
+	Name         string    `json:"name"`
+	Type         FieldType `json:"type"`
+	Label        string    `json:"label,omitempty"`
+	Values       []string  `json:"values,omitempty"`
+	Default      string    `json:"default,omitempty"`
+	Required     bool      `json:"required"`
+	Hint         string    `json:"hint,omitempty"`
+	Dependencies []string  `json:"dependencies,omitempty"`
+	Parent       string    `json:"parent,omitempty"`
+	Visible      bool      `json:"visible"`
+}
+
+func NewCommandFieldInfo(f Field) *CommandFieldInfo {
+
+	r := &CommandFieldInfo{
+		Name:         f.Name(),
+		Type:         f.Type(),
+		Label:        f.Label(),
+		Values:       f.Values(),
+		Default:      f.Default(),
+		Required:     f.Required(),
+		Hint:         f.Hint(),
+		Dependencies: f.Dependencies(),
+		Visible:      f.Visible(),
+	}
+	if !utils.IsEmpty(f.Parent()) {
+		r.Parent = f.Parent().Name()
+	}
+	return r
+}
+
+// NewCommandInfo takes fields without bot and message, so their values aren't evaluated
+func NewCommandInfo(c Command) *CommandInfo {
+
+	r := &CommandInfo{
+		Group:       c.Group(),
+		Name:        c.Name(),
+		Command:     c.Name(),
+		Description: c.Description(),
+		Params:      c.Params(),
+		Aliases:     c.Aliases(),
+		Fields:      []*CommandFieldInfo{},
+		Approval:    !utils.IsEmpty(c.Approval()),
+		Schedule:    c.Schedule(),
+		Channel:     c.Channel(),
+		Permissions: c.Permissions(),
+	}
+	if !utils.IsEmpty(r.Group) {
+		r.Command = fmt.Sprintf("%s %s", r.Group, r.Name)
+	}
+	for _, f := range c.Fields(nil, nil, nil, nil, nil) {
+		r.Fields = append(r.Fields, NewCommandFieldInfo(f))
+	}
+	return r
+}
+
+// CommandInfos lists commands of all processors, wrappers included
+func (ps *Processors) CommandInfos() []*CommandInfo {
+
+	r := []*CommandInfo{}
+	if ps == nil {
+		return r
+	}
+	for _, p := range ps.list {
+		for _, c := range p.Commands() {
+			r = append(r, NewCommandInfo(c))
+		}
+	}
+	return r
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testProcessor struct {
+	name     string
+	commands []Command
+}
+
+func (p *testProcessor) Name() string        { return p.name }
+func (p *testProcessor) Commands() []Command { return p.commands }
+
+type testCommand struct {
+	group    string
+	name     string
+	fields   []Field
+	approval Approval
+}
+
+func (c *testCommand) Name() string                             { return c.name }
+func (c *testCommand) Group() string                            { return c.group }
+func (c *testCommand) Description() string                      { return c.name + " description" }
+func (c *testCommand) Params() []string                         { return []string{"env"} }
+func (c *testCommand) Aliases() []string                        { return nil }
+func (c *testCommand) Confirmation(params ExecuteParams) string { return "" }
+func (c *testCommand) Priority() int                            { return 0 }
+func (c *testCommand) Wrapper() bool                            { return false }
+func (c *testCommand) Schedule() string                         { return "" }
+func (c *testCommand) Channel() string                          { return "" }
+func (c *testCommand) Response() Response                       { return nil }
+func (c *testCommand) Actions() []Action                        { return nil }
+func (c *testCommand) Approval() Approval                       { return c.approval }
+func (c *testCommand) Permissions() bool                        { return true }
+func (c *testCommand) TrackMessages() bool                      { return false }
+func (c *testCommand) Execute(bot Bot, message Message, params ExecuteParams, action Action) (Executor, string, []*Attachment, []Action, error) {
+	return nil, "", nil, nil, nil
+}
+func (c *testCommand) Fields(bot Bot, message Message, params ExecuteParams, eval []string, parent Field) []Field {
+	return c.fields
+}
+
+type testApproval struct{}
+
+func (a *testApproval) Channel(bot Bot, message Message, params ExecuteParams) string { return "" }
+func (a *testApproval) Message(bot Bot, message Message, params ExecuteParams) string { return "" }
+func (a *testApproval) Reasons() []string                                             { return nil }
+func (a *testApproval) Description() bool                                             { return false }
+func (a *testApproval) Visible() bool                                                 { return false }
+
+func TestCommandInfos(t *testing.T) {
+	processors := NewProcessors()
+	processors.Add(&testProcessor{name: "", commands: []Command{&testCommand{name: "help"}}})
+	processors.Add(&testProcessor{name: "k8s", commands: []Command{&testCommand{
+		group:    "k8s",
+		name:     "deploy",
+		approval: &testApproval{},
+		fields: []Field{
+			&testField{name: "env", fieldType: FieldTypeSelect, values: []string{"dev", "prod"}, required: true},
+		},
+	}}})
+
+	infos := processors.CommandInfos()
+	if len(infos) != 2 {
+		t.Fatalf("CommandInfos() returned %d commands, expected 2", len(infos))
+	}
+
+	if infos[0].Command != "help" || infos[0].Approval || len(infos[0].Fields) != 0 {
+		t.Errorf("CommandInfos() = %+v, unexpected root command", infos[0])
+	}
+
+	deploy := infos[1]
+	if deploy.Command != "k8s deploy" || !deploy.Approval || deploy.Description != "deploy description" {
+		t.Errorf("CommandInfos() = %+v, unexpected group command", deploy)
+	}
+	expected := []*CommandFieldInfo{{Name: "env", Type: FieldTypeSelect, Label: "env", Values: []string{"dev", "prod"}, Required: true, Visible: true}}
+	if !reflect.DeepEqual(deploy.Fields, expected) {
+		t.Errorf("CommandInfos() fields = %+v, expected %+v", deploy.Fields[0], expected[0])
+	}
+}
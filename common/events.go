@@ -0,0 +1,134 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// MessageEvent is a change of message status
+type MessageEvent struct {
+	Bot     string        `json:"bot"`
+	ID      string        `json:"id"`
+	Channel string        `json:"channel,omitempty"`
+	Status  MessageStatus `json:"status"`
+	Time    time.Time     `json:"time"`
+}
+
+// messageEventsSubscriber queues events for its channel, so publisher is never blocked by it
+type messageEventsSubscriber struct {
+	ch     chan *MessageEvent
+	queue  []*MessageEvent
+	size   int
+	notify chan struct{}
+	done   chan struct{}
+	lock   sync.Mutex
+}
+
+// MessageEvents delivers message events to subscribers, slow subscribers lose events instead of blocking bots,
+// but final statuses are always delivered as clients wait for them
+type MessageEvents struct {
+	subscribers map[*messageEventsSubscriber]bool
+	lock        sync.RWMutex
+}
+
+func (mes *messageEventsSubscriber) push(e *MessageEvent) {
+
+	mes.lock.Lock()
+	if len(mes.queue) >= mes.size && !e.Status.Final() {
+		mes.lock.Unlock()
+		return
+	}
+	mes.queue = append(mes.queue, e)
+	mes.lock.Unlock()
+
+	select {
+	case mes.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (mes *messageEventsSubscriber) run() {
+
+	defer close(mes.ch)
+
+	for {
+		mes.lock.Lock()
+		if len(mes.queue) == 0 {
+			mes.lock.Unlock()
+			select {
+			case <-mes.notify:
+				continue
+			case <-mes.done:
+				return
+			}
+		}
+		e := mes.queue[0]
+		mes.queue = mes.queue[1:]
+		mes.lock.Unlock()
+
+		select {
+		case mes.ch <- e:
+		case <-mes.done:
+			return
+		}
+	}
+}
+
+func (me *MessageEvents) Publish(e *MessageEvent) {
+
+	if me == nil || e == nil {
+		return
+	}
+
+	me.lock.RLock()
+	defer me.lock.RUnlock()
+
+	for s := range me.subscribers {
+		s.push(e)
+	}
+}
+
+// Subscribe returns channel of events and function which closes it
+func (me *MessageEvents) Subscribe(size int) (<-chan *MessageEvent, func()) {
+
+	s := &messageEventsSubscriber{
+		ch:     make(chan *MessageEvent),
+		size:   size,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+
+	me.lock.Lock()
+	me.subscribers[s] = true
+	me.lock.Unlock()
+
+	go s.run()
+
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			me.lock.Lock()
+			delete(me.subscribers, s)
+			me.lock.Unlock()
+			close(s.done)
+		})
+	}
+}
+
+func NewMessageEvent(bot, ID, channel string, status MessageStatus) *MessageEvent {
+
+	return &MessageEvent{
+		Bot:     bot,
+		ID:      ID,
+		Channel: channel,
+		Status:  status,
+		Time:    time.Now(),
+	}
+}
+
+func NewMessageEvents() *MessageEvents {
+
+	return &MessageEvents{
+		subscribers: make(map[*messageEventsSubscriber]bool),
+	}
+}
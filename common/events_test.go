@@ -0,0 +1,43 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMessageEventsFinalStatus(t *testing.T) {
+
+	me := NewMessageEvents()
+	events, unsubscribe := me.Subscribe(2)
+	defer unsubscribe()
+
+	// subscriber is slow, so events over its buffer are lost, except final ones
+	for i := 0; i < 10; i++ {
+		me.Publish(NewMessageEvent("Slack", "m1", "C1", MessageStatusPending))
+	}
+	me.Publish(NewMessageEvent("Slack", "m1", "C1", MessageStatusDelivered))
+
+	received := []MessageStatus{}
+	timeout := time.After(2 * time.Second)
+	for len(received) < 3 {
+		select {
+		case e := <-events:
+			received = append(received, e.Status)
+		case <-timeout:
+			t.Fatalf("expected final status, got %v", received)
+		}
+	}
+	if received[2] != MessageStatusDelivered {
+		t.Errorf("expected final status to be delivered, got %v", received)
+	}
+
+	unsubscribe()
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Error("expected channel to be closed")
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("expected channel to be closed")
+	}
+}
@@ -5,9 +5,29 @@ package common
 type CommandExecutor interface {
 	// ExecuteCommand triggers a command execution on the specified bot.
 	// Returns the Message (use Message.ID() for tracking) or nil if no message was created.
-	ExecuteCommand(botName, channel, command, userID string) (Message, error)
+	ExecuteCommand(botName, channel, command, userID string, params ExecuteParams) (Message, error)
 	// GetMessageStatus returns the status of a message by its ID.
 	GetMessageStatus(botName, messageID string) (MessageStatus, error)
+	// GetMessageResult returns status and output of a command by its message ID, nil if it's not found.
+	GetMessageResult(botName, messageID string) (*MessageResult, error)
+	// TagMessage, FindMessagesByTag and UpdateMessage let callers follow up on messages they created.
+	TagMessage(botName, channel, ID string, tags map[string]string) error
+	FindMessagesByTag(botName, tagKey, tagValue string) (map[string]string, error)
+	UpdateMessage(botName, channel, ID, message string) error
+	// MessageEvents returns events of message status changes.
+	MessageEvents() *MessageEvents
+	// PendingApprovals returns messages which wait for approval.
+	PendingApprovals(botName string) ([]*PendingApproval, error)
+	// Approve approves or rejects message which waits for approval on behalf of the user.
+	Approve(botName, messageID string, approved bool, userID, reason string) error
+	// Cancel cancels command of the message which is running or waits for approval.
+	Cancel(botName, messageID, userID string) error
+	// ListCommands returns commands which can be executed, with their fields.
+	ListCommands() ([]*CommandInfo, error)
+	// GetRunbookRun returns a runbook run by its ID or nil if it's not found.
+	GetRunbookRun(runID string) (*RunbookRun, error)
+	// ListRunbookRuns returns runbook runs, newest first, optionally filtered by runbook name.
+	ListRunbookRuns(name string, limit int) ([]*RunbookRun, error)
 }
 
 // GenericUser is a simple implementation of the User interface
@@ -0,0 +1,225 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/devopsext/utils"
+)
+
+type PolicyFreezeAction string
+
+// PolicyFreeze stops commands during weekly windows, e.g. Fridays after 15:00, or during dates of holidays.
+// Time of the freeze is in its time zone, otherwise in the one of the policy, never in the one of the user,
+// as users could escape freezes by their time zones.
+type PolicyFreeze struct {
+	Name     string
+	Commands []string
+	Days     []string // monday, tuesday..., every day if empty
+	From     string   // 15:04, windows from 22:00 to 06:00 go over midnight
+	To       string
+	Start    string // 2006-01-02, both dates are included
+	End      string
+	TimeZone string `yaml:"timezone"`
+	Action   PolicyFreezeAction
+	Channel  string // channel of escalated approval, channel of command approval if empty
+	Message  string
+	commands []*regexp.Regexp
+	days     map[time.Weekday]bool
+	from     time.Duration
+	to       time.Duration
+	start    string
+	end      string
+	location *time.Location
+}
+
+// freezeApproval escalates approval of the command, or asks for one if command has no approval
+type freezeApproval struct {
+	freeze   *PolicyFreeze
+	approval Approval
+}
+
+const (
+	PolicyFreezeBlock    PolicyFreezeAction = "block"
+	PolicyFreezeApproval PolicyFreezeAction = "approval"
+
+	policyFreezeDateFormat = "2006-01-02"
+	policyFreezeTimeFormat = "15:04"
+)
+
+func (fa *freezeApproval) Channel(bot Bot, message Message, params ExecuteParams) string {
+
+	if !utils.IsEmpty(fa.freeze.Channel) {
+		return fa.freeze.Channel
+	}
+	if fa.approval != nil {
+		return fa.approval.Channel(bot, message, params)
+	}
+	return ""
+}
+
+func (fa *freezeApproval) Message(bot Bot, message Message, params ExecuteParams) string {
+
+	r := fa.freeze.String()
+	if fa.approval != nil {
+		if m := strings.TrimSpace(fa.approval.Message(bot, message, params)); !utils.IsEmpty(m) {
+			r = fmt.Sprintf("%s\n%s", r, m)
+		}
+	}
+	return r
+}
+
+func (fa *freezeApproval) Reasons() []string {
+
+	if fa.approval != nil {
+		return fa.approval.Reasons()
+	}
+	return nil
+}
+
+func (fa *freezeApproval) Description() bool {
+	return fa.approval != nil && fa.approval.Description()
+}
+
+func (fa *freezeApproval) Visible() bool {
+	return fa.approval == nil || fa.approval.Visible()
+}
+
+func (pf *PolicyFreeze) String() string {
+
+	if !utils.IsEmpty(pf.Message) {
+		return pf.Message
+	}
+	if pf.Action == PolicyFreezeApproval {
+		return fmt.Sprintf("Command is executed during %s freeze, it needs escalated approval", pf.Name)
+	}
+	return fmt.Sprintf("Command can't be executed during %s freeze", pf.Name)
+}
+
+// Approval wraps approval of the command, so it's escalated to the channel of the freeze
+func (pf *PolicyFreeze) Approval(approval Approval) Approval {
+	return &freezeApproval{freeze: pf, approval: approval}
+}
+
+func (pf *PolicyFreeze) active(now time.Time) bool {
+
+	now = now.In(pf.location)
+
+	date := now.Format(policyFreezeDateFormat)
+	if !utils.IsEmpty(pf.start) && date < pf.start {
+		return false
+	}
+	if !utils.IsEmpty(pf.end) && date > pf.end {
+		return false
+	}
+	if len(pf.days) > 0 && !pf.days[now.Weekday()] {
+		return false
+	}
+
+	if utils.IsEmpty(pf.From) && utils.IsEmpty(pf.To) {
+		return true
+	}
+	t := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+	if pf.from <= pf.to {
+		return t >= pf.from && t < pf.to
+	}
+	return t >= pf.from || t < pf.to
+}
+
+func (pf *PolicyFreeze) load(location *time.Location) error {
+
+	if utils.IsEmpty(pf.Name) {
+		return fmt.Errorf("freeze has no name")
+	}
+	if len(pf.Commands) == 0 {
+		return fmt.Errorf("freeze %s has no commands", pf.Name)
+	}
+
+	var err error
+	if pf.commands, err = policyGlobs(pf.Commands); err != nil {
+		return fmt.Errorf("freeze %s commands: %s", pf.Name, err)
+	}
+
+	switch pf.Action {
+	case "":
+		pf.Action = PolicyFreezeBlock
+	case PolicyFreezeBlock, PolicyFreezeApproval:
+	default:
+		return fmt.Errorf("freeze %s has unknown action %s", pf.Name, pf.Action)
+	}
+
+	pf.days = make(map[time.Weekday]bool)
+	for _, d := range pf.Days {
+		found := false
+		for wd := time.Sunday; wd <= time.Saturday; wd++ {
+			if strings.EqualFold(wd.String(), strings.TrimSpace(d)) {
+				pf.days[wd] = true
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("freeze %s has unknown day %s", pf.Name, d)
+		}
+	}
+
+	pf.to = 24 * time.Hour
+	for _, v := range []struct {
+		value string
+		d     *time.Duration
+	}{{pf.From, &pf.from}, {pf.To, &pf.to}} {
+		if utils.IsEmpty(v.value) {
+			continue
+		}
+		t, err := time.Parse(policyFreezeTimeFormat, v.value)
+		if err != nil {
+			return fmt.Errorf("freeze %s has invalid time %s", pf.Name, v.value)
+		}
+		*v.d = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+
+	for _, v := range []struct {
+		value string
+		date  *string
+	}{{pf.Start, &pf.start}, {pf.End, &pf.end}} {
+		if utils.IsEmpty(v.value) {
+			continue
+		}
+		t, err := time.Parse(policyFreezeDateFormat, v.value)
+		if err != nil {
+			return fmt.Errorf("freeze %s has invalid date %s", pf.Name, v.value)
+		}
+		*v.date = t.Format(policyFreezeDateFormat)
+	}
+	if !utils.IsEmpty(pf.start) && !utils.IsEmpty(pf.end) && pf.start > pf.end {
+		return fmt.Errorf("freeze %s ends before it starts", pf.Name)
+	}
+
+	pf.location = location
+	if !utils.IsEmpty(pf.TimeZone) {
+		if pf.location, err = time.LoadLocation(pf.TimeZone); err != nil {
+			return fmt.Errorf("freeze %s has invalid time zone %s", pf.Name, pf.TimeZone)
+		}
+	}
+	return nil
+}
+
+// Freeze returns freeze of the command, which blocks it over any other one
+func (p *Policy) Freeze(command string, now time.Time) *PolicyFreeze {
+
+	var r *PolicyFreeze
+	for _, pf := range p.freezes {
+
+		if policyMatch(pf.commands, command) < 0 || !pf.active(now) {
+			continue
+		}
+		if pf.Action == PolicyFreezeBlock {
+			return pf
+		}
+		if r == nil {
+			r = pf
+		}
+	}
+	return r
+}
@@ -0,0 +1,131 @@
+package common
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFreezePolicy = `
+freezes:
+  - name: friday
+    commands: ["deploy/*"]
+    days: [Friday]
+    from: "15:00"
+    action: approval
+    channel: C-approvals
+  - name: night
+    commands: ["deploy/*"]
+    from: "22:00"
+    to: "06:00"
+    timezone: Europe/Berlin
+  - name: holidays
+    commands: ["deploy/*", "k8s/restart"]
+    start: "2026-12-24"
+    end: "2026-12-26"
+`
+
+func TestPolicyFreeze(t *testing.T) {
+
+	p, err := NewPolicy(testFreezePolicy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 2026-10-16 is Friday
+	tests := []struct {
+		name    string
+		command string
+		now     time.Time
+		freeze  string
+	}{
+		{"friday afternoon", "deploy/app", time.Date(2026, 10, 16, 16, 0, 0, 0, time.UTC), "friday"},
+		{"friday morning", "deploy/app", time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC), ""},
+		{"friday afternoon of other time zone", "deploy/app", time.Date(2026, 10, 16, 15, 0, 0, 0, time.FixedZone("EDT", -4*3600)), "friday"},
+		{"thursday", "deploy/app", time.Date(2026, 10, 15, 16, 0, 0, 0, time.UTC), ""},
+		{"night of freeze time zone", "deploy/app", time.Date(2026, 10, 15, 21, 0, 0, 0, time.UTC), "night"},
+		{"early morning", "deploy/app", time.Date(2026, 10, 15, 3, 0, 0, 0, time.UTC), "night"},
+		{"block wins over approval", "deploy/app", time.Date(2026, 10, 16, 21, 0, 0, 0, time.UTC), "night"},
+		{"holidays", "k8s/restart", time.Date(2026, 12, 26, 12, 0, 0, 0, time.UTC), "holidays"},
+		{"after holidays", "k8s/restart", time.Date(2026, 12, 27, 12, 0, 0, 0, time.UTC), ""},
+		{"other command", "k8s/pods", time.Date(2026, 12, 25, 12, 0, 0, 0, time.UTC), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := p.Freeze(tt.command, tt.now)
+			name := ""
+			if f != nil {
+				name = f.Name
+			}
+			if name != tt.freeze {
+				t.Errorf("expected freeze %q, got %q", tt.freeze, name)
+			}
+		})
+	}
+}
+
+func TestPolicyFreezeTimeZone(t *testing.T) {
+
+	p, err := NewPolicy("timezone: America/New_York\n" + testFreezePolicy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 16:00 UTC is 12:00 in New York, so friday freeze isn't active yet
+	if f := p.Freeze("deploy/app", time.Date(2026, 10, 16, 16, 0, 0, 0, time.UTC)); f != nil {
+		t.Errorf("expected no freeze, got %s", f.Name)
+	}
+	if f := p.Freeze("deploy/app", time.Date(2026, 10, 16, 19, 0, 0, 0, time.UTC)); f == nil || f.Name != "friday" {
+		t.Errorf("expected friday freeze, got %v", f)
+	}
+}
+
+func TestPolicyFreezeApproval(t *testing.T) {
+
+	p, err := NewPolicy(testFreezePolicy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f := p.Freeze("deploy/app", time.Date(2026, 10, 16, 16, 0, 0, 0, time.UTC))
+	if f == nil || f.Action != PolicyFreezeApproval {
+		t.Fatalf("expected approval freeze, got %v", f)
+	}
+
+	a := f.Approval(nil)
+	if a.Channel(nil, nil, nil) != "C-approvals" {
+		t.Errorf("expected channel of freeze, got %s", a.Channel(nil, nil, nil))
+	}
+	if !strings.Contains(a.Message(nil, nil, nil), "friday") {
+		t.Errorf("expected message of freeze, got %s", a.Message(nil, nil, nil))
+	}
+	if !a.Visible() || a.Description() || len(a.Reasons()) > 0 {
+		t.Error("approval of freeze without command approval must be visible without reasons")
+	}
+}
+
+func TestNewPolicyFreezes(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"no commands", "freezes:\n  - name: f\n"},
+		{"unknown action", "freezes:\n  - name: f\n    commands: [deploy]\n    action: skip\n"},
+		{"unknown day", "freezes:\n  - name: f\n    commands: [deploy]\n    days: [fri]\n"},
+		{"invalid time", "freezes:\n  - name: f\n    commands: [deploy]\n    from: 3pm\n"},
+		{"invalid date", "freezes:\n  - name: f\n    commands: [deploy]\n    start: 24.12.2026\n"},
+		{"end before start", "freezes:\n  - name: f\n    commands: [deploy]\n    start: \"2026-12-26\"\n    end: \"2026-12-24\"\n"},
+		{"invalid time zone", "freezes:\n  - name: f\n    commands: [deploy]\n    timezone: Mars/Olympus\n"},
+		{"invalid policy time zone", "timezone: Mars/Olympus\nfreezes:\n  - name: f\n    commands: [deploy]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewPolicy(tt.config); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package common
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devopsext/utils"
+)
+
+// ParamsError describes all params which don't match command fields
+type ParamsError struct {
+	Errors []string
+}
+
+const (
+	paramsDateFormat = "2006-01-02"
+	paramsTimeFormat = "15:04"
+)
+
+func (pe *ParamsError) Error() string {
+	return strings.Join(pe.Errors, "; ")
+}
+
+func paramsMultiType(t FieldType) bool {
+
+	switch t {
+	case FieldTypeMultiSelect, FieldTypeDynamicMultiSelect, FieldTypeMultiUser, FieldTypeMultiChannel, FieldTypeMultiGroup:
+		return true
+	}
+	return false
+}
+
+func paramsStrings(v interface{}) []string {
+
+	switch arr := v.(type) {
+	case []string:
+		return RemoveEmptyStrings(arr)
+	case []interface{}:
+		return RemoveEmptyStrings(InterfaceListAsStrings(arr))
+	case string:
+		return RemoveEmptyStrings(strings.Split(arr, ","))
+	}
+	return []string{fmt.Sprintf("%v", v)}
+}
+
+func paramsString(v interface{}) string {
+
+	switch s := v.(type) {
+	case string:
+		return strings.TrimSpace(s)
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func paramsEmpty(v interface{}) bool {
+
+	// false is a value for bool fields
+	if _, ok := v.(bool); ok {
+		return false
+	}
+	if s, ok := v.(string); ok {
+		return utils.IsEmpty(strings.TrimSpace(s))
+	}
+	return utils.IsEmpty(v)
+}
+
+// paramValue converts value to the shape which forms produce, multi values are lists, others are strings
+func paramValue(f Field, v interface{}) (interface{}, error) {
+
+	t := f.Type()
+	values := f.Values()
+
+	if paramsMultiType(t) || t == FieldTypeCheckboxes {
+		arr := paramsStrings(v)
+		if t == FieldTypeMultiSelect || t == FieldTypeCheckboxes {
+			for _, s := range arr {
+				if len(values) > 0 && !slices.Contains(values, s) {
+					return nil, fmt.Errorf("%s is not one of %s", s, strings.Join(values, ", "))
+				}
+			}
+		}
+		if t == FieldTypeCheckboxes {
+			return strings.Join(arr, ","), nil
+		}
+		return arr, nil
+	}
+
+	s := paramsString(v)
+	switch t {
+	case FieldTypeInteger:
+		if f, ok := v.(float64); ok && f != math.Trunc(f) {
+			return nil, fmt.Errorf("%s is not an integer", s)
+		}
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("%s is not an integer", s)
+		}
+	case FieldTypeFloat:
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return nil, fmt.Errorf("%s is not a number", s)
+		}
+	case FieldTypeBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a boolean", s)
+		}
+		s = strconv.FormatBool(b)
+	case FieldTypeURL:
+		u, err := url.ParseRequestURI(s)
+		if err != nil || utils.IsEmpty(u.Scheme) || utils.IsEmpty(u.Host) {
+			return nil, fmt.Errorf("%s is not a URL", s)
+		}
+	case FieldTypeDate:
+		if _, err := time.Parse(paramsDateFormat, s); err != nil {
+			return nil, fmt.Errorf("%s is not a date like %s", s, paramsDateFormat)
+		}
+	case FieldTypeTime:
+		if _, err := time.Parse(paramsTimeFormat, s); err != nil {
+			return nil, fmt.Errorf("%s is not a time like %s", s, paramsTimeFormat)
+		}
+	case FieldTypeSelect, FieldTypeRadionButtons:
+		if len(values) > 0 && !slices.Contains(values, s) {
+			return nil, fmt.Errorf("%s is not one of %s", s, strings.Join(values, ", "))
+		}
+	}
+	return s, nil
+}
+
+// ValidateParams checks params against command fields, sets defaults and returns params as forms would set them
+func ValidateParams(fields []Field, params ExecuteParams) (ExecuteParams, error) {
+
+	r := make(ExecuteParams)
+	for k, v := range params {
+		r[k] = v
+	}
+
+	errs := []string{}
+	for _, f := range fields {
+
+		if utils.IsEmpty(f) {
+			continue
+		}
+		name := f.Name()
+		switch f.Type() {
+		case FieldTypeMarkdown, FieldTypeGroup:
+			continue
+		}
+
+		v, ok := r[name]
+		if !ok || paramsEmpty(v) {
+			if !utils.IsEmpty(f.Default()) {
+				v = f.Default()
+			} else if !utils.IsEmpty(f.Value()) {
+				v = f.Value()
+			} else {
+				if f.Required() {
+					errs = append(errs, fmt.Sprintf("%s is required", name))
+				}
+				delete(r, name)
+				continue
+			}
+		}
+
+		nv, err := paramValue(f, v)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", name, err))
+			continue
+		}
+		r[name] = nv
+	}
+
+	if len(errs) > 0 {
+		return nil, &ParamsError{Errors: errs}
+	}
+	return r, nil
+}
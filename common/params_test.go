@@ -0,0 +1,130 @@
+package common
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testField struct {
+	name         string
+	fieldType    FieldType
+	values       []string
+	defaultValue string
+	required     bool
+}
+
+func (f *testField) Name() string           { return f.name }
+func (f *testField) Type() FieldType        { return f.fieldType }
+func (f *testField) Label() string          { return f.name }
+func (f *testField) Values() []string       { return f.values }
+func (f *testField) Default() string        { return f.defaultValue }
+func (f *testField) Required() bool         { return f.required }
+func (f *testField) Template() string       { return "" }
+func (f *testField) Dependencies() []string { return nil }
+func (f *testField) Hint() string           { return "" }
+func (f *testField) Filter() string         { return "" }
+func (f *testField) Value() string          { return "" }
+func (f *testField) Visible() bool          { return true }
+func (f *testField) Parent() Field          { return nil }
+
+func TestValidateParams(t *testing.T) {
+	fields := []Field{
+		&testField{name: "env", fieldType: FieldTypeSelect, values: []string{"dev", "prod"}, required: true},
+		&testField{name: "replicas", fieldType: FieldTypeInteger, defaultValue: "1"},
+		&testField{name: "regions", fieldType: FieldTypeMultiSelect, values: []string{"eu", "us"}},
+		&testField{name: "checks", fieldType: FieldTypeCheckboxes},
+		&testField{name: "force", fieldType: FieldTypeBool},
+		&testField{name: "link", fieldType: FieldTypeURL},
+		&testField{name: "date", fieldType: FieldTypeDate},
+		&testField{name: "note", fieldType: FieldTypeMarkdown, required: true},
+	}
+
+	tests := []struct {
+		name     string
+		params   ExecuteParams
+		expected ExecuteParams
+		errors   []string
+	}{
+		{
+			name:   "Defaults and unknown params",
+			params: ExecuteParams{"env": "prod", "other": 1},
+			expected: ExecuteParams{
+				"env":      "prod",
+				"replicas": "1",
+				"other":    1,
+			},
+		},
+		{
+			name: "Values are converted",
+			params: ExecuteParams{
+				"env":      "dev",
+				"replicas": float64(3),
+				"regions":  []interface{}{"eu", "us"},
+				"checks":   []interface{}{"a", "b"},
+				"force":    true,
+				"link":     "https://example.com/x",
+				"date":     "2024-02-01",
+			},
+			expected: ExecuteParams{
+				"env":      "dev",
+				"replicas": "3",
+				"regions":  []string{"eu", "us"},
+				"checks":   "a,b",
+				"force":    "true",
+				"link":     "https://example.com/x",
+				"date":     "2024-02-01",
+			},
+		},
+		{
+			name:     "Comma separated multi value",
+			params:   ExecuteParams{"env": "dev", "regions": "eu, us"},
+			expected: ExecuteParams{"env": "dev", "replicas": "1", "regions": []string{"eu", "us"}},
+		},
+		{
+			name:   "Required field is missing",
+			params: ExecuteParams{"env": ""},
+			errors: []string{"env is required"},
+		},
+		{
+			name: "Invalid values",
+			params: ExecuteParams{
+				"env":      "stage",
+				"replicas": 1.5,
+				"regions":  []string{"asia"},
+				"force":    "maybe",
+				"link":     "example",
+				"date":     "01.02.2024",
+			},
+			errors: []string{
+				"env: stage is not one of dev, prod",
+				"replicas: 1.5 is not an integer",
+				"regions: asia is not one of eu, us",
+				"force: maybe is not a boolean",
+				"link: example is not a URL",
+				"date: 01.02.2024 is not a date like 2006-01-02",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ValidateParams(fields, tt.params)
+			if tt.errors != nil {
+				pe, ok := err.(*ParamsError)
+				if !ok {
+					t.Fatalf("ValidateParams() error = %v, expected ParamsError", err)
+				}
+				if !reflect.DeepEqual(pe.Errors, tt.errors) {
+					t.Errorf("ValidateParams() errors = %v, expected %v", pe.Errors, tt.errors)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateParams() error = %v", err)
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("ValidateParams() = %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
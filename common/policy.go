@@ -0,0 +1,468 @@
+package common
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/devopsext/utils"
+)
+
+// PolicyConfig is YAML of the policy, e.g.
+//
+//	roles:
+//	  - name: sre
+//	    rules:
+//	      - allow: ["*"]
+//	      - deny: ["prod/*"]
+//	        when:
+//	          bots: [Telegram]
+//	  - name: dev
+//	    rules:
+//	      - allow: [deploy]
+//	        when:
+//	          params:
+//	            env: [staging]
+//	bindings:
+//	  - role: sre
+//	    groups: [sre-team]
+//	scopes:
+//	  - commands: ["prod/*"]
+//	    channels: ["#ops-prod"]
+//	timezone: Europe/Berlin
+//	freezes:
+//	  - name: friday
+//	    commands: ["deploy/*"]
+//	    days: [friday]
+//	    from: "15:00"
+//	    action: approval
+//	    channel: "#change-approvals"
+type PolicyConfig struct {
+	Roles    []*PolicyRole
+	Bindings []*PolicyBinding
+	Scopes   []*PolicyScope
+	Freezes  []*PolicyFreeze
+	TimeZone string `yaml:"timezone"` // time zone of freezes which have none, UTC if empty
+}
+
+type PolicyRole struct {
+	Name  string
+	Rules []*PolicyRule
+}
+
+// PolicyRule allows or denies commands by globs of group/name, rule is applied only if its conditions match
+type PolicyRule struct {
+	Allow []string
+	Deny  []string
+	When  *PolicyCondition
+	allow []*regexp.Regexp
+	deny  []*regexp.Regexp
+}
+
+// PolicyCondition matches params by globs of their values, allow rule needs all values
+// of multi value param to match, while deny rule needs any of them
+type PolicyCondition struct {
+	Bots     []string
+	Channels []string
+	Params   map[string][]string
+	bots     []*regexp.Regexp
+	channels []*regexp.Regexp
+	params   map[string][]*regexp.Regexp
+}
+
+// PolicyScope limits channels where commands can run whoever runs them, commands out of scopes run anywhere
+type PolicyScope struct {
+	Commands []string
+	Channels []string
+	commands []*regexp.Regexp
+	channels []*regexp.Regexp
+}
+
+// PolicyBinding gives role to any of its subjects, users are matched by ID or name, channels by ID or name
+type PolicyBinding struct {
+	Role     string
+	Users    []string
+	Groups   []string
+	Channels []string
+	users    []*regexp.Regexp
+	groups   []*regexp.Regexp
+	channels []*regexp.Regexp
+}
+
+// Policy is loaded once and shared by bots, deny rules win over allow ones, commands which no rule allows are denied
+type Policy struct {
+	roles    map[string]*PolicyRole
+	bindings []*PolicyBinding
+	scopes   []*PolicyScope
+	freezes  []*PolicyFreeze
+}
+
+// PermissionsExplainer is a bot which can explain why user can or can't run command
+type PermissionsExplainer interface {
+	UserGroups(user User) []string
+	Explain(user User, channel, command string) string
+}
+
+// PolicyRequest is who runs command and where, channel is empty when commands of user are listed,
+// params are nil until they're known, so rules which allow with params are applied then
+type PolicyRequest struct {
+	Bot         string
+	UserID      string
+	UserName    string
+	Groups      []string
+	Channel     string
+	ChannelName string
+	Command     string
+	Params      ExecuteParams
+}
+
+type PolicyDecision struct {
+	Allowed bool   `json:"allowed"`
+	Role    string `json:"role,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+}
+
+func (pd *PolicyDecision) String() string {
+
+	switch {
+	case pd.Allowed:
+		return fmt.Sprintf("allowed by role %s, rule %s", pd.Role, pd.Rule)
+	case !utils.IsEmpty(pd.Role):
+		return fmt.Sprintf("denied by role %s, rule %s", pd.Role, pd.Rule)
+	case !utils.IsEmpty(pd.Rule):
+		return fmt.Sprintf("denied by %s", pd.Rule)
+	}
+	return "denied, no rule allows it"
+}
+
+// policyGlob matches whole value, * matches any characters including /
+func policyGlob(glob string) (*regexp.Regexp, error) {
+
+	if utils.IsEmpty(strings.TrimSpace(glob)) {
+		return nil, fmt.Errorf("empty glob")
+	}
+	expr := regexp.QuoteMeta(glob)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	return regexp.Compile("^" + expr + "$")
+}
+
+// channels are written as they're seen in chats, so # is optional
+func policyChannelGlobs(globs []string) ([]*regexp.Regexp, error) {
+
+	r := []string{}
+	for _, g := range globs {
+		r = append(r, strings.TrimPrefix(g, "#"))
+	}
+	return policyGlobs(r)
+}
+
+func policyGlobs(globs []string) ([]*regexp.Regexp, error) {
+
+	r := []*regexp.Regexp{}
+	for _, g := range globs {
+		re, err := policyGlob(g)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %s", g, err)
+		}
+		r = append(r, re)
+	}
+	return r, nil
+}
+
+// policyMatch returns index of the first glob which matches any of values
+func policyMatch(globs []*regexp.Regexp, values ...string) int {
+
+	for i, re := range globs {
+		for _, v := range values {
+			if !utils.IsEmpty(v) && re.MatchString(v) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func (pc *PolicyCondition) match(req *PolicyRequest) bool {
+
+	if pc == nil {
+		return true
+	}
+	if len(pc.bots) > 0 && policyMatch(pc.bots, req.Bot) < 0 {
+		return false
+	}
+	if len(pc.channels) > 0 && policyMatch(pc.channels, req.Channel, req.ChannelName) < 0 {
+		return false
+	}
+	return true
+}
+
+func (pc *PolicyCondition) matchParams(req *PolicyRequest, deny bool) bool {
+
+	if pc == nil || len(pc.params) == 0 {
+		return true
+	}
+	if req.Params == nil {
+		return !deny
+	}
+
+	for name, globs := range pc.params {
+
+		v := req.Params[name]
+		if paramsEmpty(v) {
+			return false
+		}
+		values := paramsStrings(v)
+		matched := 0
+		for _, value := range values {
+			if policyMatch(globs, value) >= 0 {
+				matched++
+			}
+		}
+		if (deny && matched == 0) || (!deny && matched < len(values)) {
+			return false
+		}
+	}
+	return true
+}
+
+// paramsString is a part of rule in decisions, as rule with params differs from one without them
+func (pc *PolicyCondition) paramsString() string {
+
+	if pc == nil || len(pc.Params) == 0 {
+		return ""
+	}
+	r := []string{}
+	for _, name := range slices.Sorted(maps.Keys(pc.Params)) {
+		r = append(r, fmt.Sprintf("%s=%s", name, strings.Join(pc.Params[name], "|")))
+	}
+	return fmt.Sprintf(" with %s", strings.Join(r, ", "))
+}
+
+func (pb *PolicyBinding) match(req *PolicyRequest) bool {
+
+	if policyMatch(pb.users, req.UserID, req.UserName) >= 0 {
+		return true
+	}
+	if policyMatch(pb.groups, req.Groups...) >= 0 {
+		return true
+	}
+	return policyMatch(pb.channels, req.Channel, req.ChannelName) >= 0
+}
+
+// CheckChannel returns nil if command can run in the channel, command of several scopes can run in channels of any of them.
+// Channel isn't known when commands of user are listed, so nothing is checked then.
+func (p *Policy) CheckChannel(req *PolicyRequest) *PolicyDecision {
+
+	if utils.IsEmpty(req.Channel) {
+		return nil
+	}
+
+	var denied *PolicyDecision
+	for _, sc := range p.scopes {
+
+		i := policyMatch(sc.commands, req.Command)
+		if i < 0 {
+			continue
+		}
+		if policyMatch(sc.channels, req.Channel, req.ChannelName) >= 0 {
+			return nil
+		}
+		if denied == nil {
+			denied = &PolicyDecision{Rule: fmt.Sprintf("scope %s in %s", sc.Commands[i], strings.Join(sc.Channels, ", "))}
+		}
+	}
+	return denied
+}
+
+// Check finds the rule which decides on command, it goes through all roles of subjects,
+// so deny of one role can't be overridden by allow of another one
+func (p *Policy) Check(req *PolicyRequest) *PolicyDecision {
+
+	if d := p.CheckChannel(req); d != nil {
+		return d
+	}
+
+	var allowed *PolicyDecision
+	for _, b := range p.bindings {
+
+		if !b.match(req) {
+			continue
+		}
+		role := p.roles[b.Role]
+		for _, r := range role.Rules {
+
+			if !r.When.match(req) {
+				continue
+			}
+			if i := policyMatch(r.deny, req.Command); i >= 0 && r.When.matchParams(req, true) {
+				return &PolicyDecision{Role: role.Name, Rule: "deny " + r.Deny[i] + r.When.paramsString()}
+			}
+			if allowed != nil {
+				continue
+			}
+			if i := policyMatch(r.allow, req.Command); i >= 0 && r.When.matchParams(req, false) {
+				allowed = &PolicyDecision{Allowed: true, Role: role.Name, Rule: "allow " + r.Allow[i] + r.When.paramsString()}
+			}
+		}
+	}
+	if allowed != nil {
+		return allowed
+	}
+	return &PolicyDecision{}
+}
+
+func (p *Policy) Allowed(req *PolicyRequest) bool {
+	return p.Check(req).Allowed
+}
+
+func (p *Policy) load(config *PolicyConfig) error {
+
+	for i, role := range config.Roles {
+
+		if role == nil || utils.IsEmpty(role.Name) {
+			return fmt.Errorf("role %d has no name", i)
+		}
+		if _, ok := p.roles[role.Name]; ok {
+			return fmt.Errorf("role %s is defined twice", role.Name)
+		}
+		for j, r := range role.Rules {
+
+			if r == nil || (len(r.Allow) == 0 && len(r.Deny) == 0) {
+				return fmt.Errorf("role %s rule %d neither allows nor denies", role.Name, j)
+			}
+			var err error
+			if r.allow, err = policyGlobs(r.Allow); err != nil {
+				return fmt.Errorf("role %s rule %d: %s", role.Name, j, err)
+			}
+			if r.deny, err = policyGlobs(r.Deny); err != nil {
+				return fmt.Errorf("role %s rule %d: %s", role.Name, j, err)
+			}
+			if r.When != nil {
+				if r.When.bots, err = policyGlobs(r.When.Bots); err != nil {
+					return fmt.Errorf("role %s rule %d bots: %s", role.Name, j, err)
+				}
+				if r.When.channels, err = policyChannelGlobs(r.When.Channels); err != nil {
+					return fmt.Errorf("role %s rule %d channels: %s", role.Name, j, err)
+				}
+				r.When.params = make(map[string][]*regexp.Regexp)
+				for name, values := range r.When.Params {
+					if len(values) == 0 {
+						return fmt.Errorf("role %s rule %d param %s has no values", role.Name, j, name)
+					}
+					if r.When.params[name], err = policyGlobs(values); err != nil {
+						return fmt.Errorf("role %s rule %d param %s: %s", role.Name, j, name, err)
+					}
+				}
+			}
+		}
+		p.roles[role.Name] = role
+	}
+
+	for i, b := range config.Bindings {
+
+		if b == nil || utils.IsEmpty(b.Role) {
+			return fmt.Errorf("binding %d has no role", i)
+		}
+		if _, ok := p.roles[b.Role]; !ok {
+			return fmt.Errorf("binding %d has unknown role %s", i, b.Role)
+		}
+		if len(b.Users) == 0 && len(b.Groups) == 0 && len(b.Channels) == 0 {
+			return fmt.Errorf("binding %d of role %s has no subjects", i, b.Role)
+		}
+		var err error
+		if b.users, err = policyGlobs(b.Users); err != nil {
+			return fmt.Errorf("binding %d users: %s", i, err)
+		}
+		if b.groups, err = policyGlobs(b.Groups); err != nil {
+			return fmt.Errorf("binding %d groups: %s", i, err)
+		}
+		if b.channels, err = policyChannelGlobs(b.Channels); err != nil {
+			return fmt.Errorf("binding %d channels: %s", i, err)
+		}
+		p.bindings = append(p.bindings, b)
+	}
+
+	for i, sc := range config.Scopes {
+
+		if sc == nil || len(sc.Commands) == 0 || len(sc.Channels) == 0 {
+			return fmt.Errorf("scope %d needs commands and channels", i)
+		}
+		var err error
+		if sc.commands, err = policyGlobs(sc.Commands); err != nil {
+			return fmt.Errorf("scope %d commands: %s", i, err)
+		}
+		if sc.channels, err = policyChannelGlobs(sc.Channels); err != nil {
+			return fmt.Errorf("scope %d channels: %s", i, err)
+		}
+		p.scopes = append(p.scopes, sc)
+	}
+
+	location := time.UTC
+	if !utils.IsEmpty(config.TimeZone) {
+		l, err := time.LoadLocation(config.TimeZone)
+		if err != nil {
+			return fmt.Errorf("policy has invalid time zone %s", config.TimeZone)
+		}
+		location = l
+	}
+
+	for i, pf := range config.Freezes {
+
+		if pf == nil {
+			return fmt.Errorf("freeze %d is empty", i)
+		}
+		if err := pf.load(location); err != nil {
+			return err
+		}
+		p.freezes = append(p.freezes, pf)
+	}
+	return nil
+}
+
+// NewPolicy loads policy from file or content, there is no policy if config is empty
+func NewPolicy(config string) (*Policy, error) {
+
+	var c PolicyConfig
+	ok, err := LoadYaml(config, &c)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load policy: %s", err)
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	p := &Policy{roles: make(map[string]*PolicyRole)}
+	if err := p.load(&c); err != nil {
+		return nil, fmt.Errorf("invalid policy: %s", err)
+	}
+	return p, nil
+}
+
+// FindPermission returns pair of permissions which allows command to subject, permissions are pairs
+// of subject and command regexes, e.g. .*=^(help|news)$,some=^(escalate)$
+func FindPermission(permissions, command string, subject func(re *regexp.Regexp) bool) (string, error) {
+
+	for key, value := range utils.MapGetKeyValues(permissions) {
+
+		reCommand, err := regexp.Compile(value)
+		if err != nil {
+			return "", fmt.Errorf("command regex error: %s", err)
+		}
+		if !reCommand.MatchString(command) {
+			continue
+		}
+
+		reSubject, err := regexp.Compile(key)
+		if err != nil {
+			return "", fmt.Errorf("subject regex error: %s", err)
+		}
+		if subject(reSubject) {
+			return fmt.Sprintf("%s=%s", key, value), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,196 @@
+package common
+
+import (
+	"regexp"
+	"testing"
+)
+
+const testPolicy = `
+roles:
+  - name: sre
+    rules:
+      - allow: ["*"]
+      - deny: ["prod/*"]
+        when:
+          bots: [Telegram]
+  - name: everyone
+    rules:
+      - allow: [help, "k8s/pods"]
+  - name: guest
+    rules:
+      - deny: ["k8s/*"]
+bindings:
+  - role: sre
+    groups: [sre-team]
+  - role: everyone
+    users: ["*"]
+  - role: guest
+    users: [U3]
+    channels: [C-public]
+scopes:
+  - commands: ["prod/*"]
+    channels: ["#ops-prod"]
+`
+
+func TestPolicyCheck(t *testing.T) {
+
+	p, err := NewPolicy(testPolicy)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		req     PolicyRequest
+		allowed bool
+		rule    string
+	}{
+		{"everyone runs help", PolicyRequest{Bot: "Slack", UserID: "U1", Command: "help"}, true, "allow help"},
+		{"not allowed command", PolicyRequest{Bot: "Slack", UserID: "U1", Command: "prod/deploy"}, false, ""},
+		{"role of group", PolicyRequest{Bot: "Slack", UserID: "U2", Groups: []string{"sre-team"}, Command: "prod/deploy"}, true, "allow *"},
+		{"scope channel", PolicyRequest{Bot: "Slack", UserID: "U2", Groups: []string{"sre-team"}, Channel: "C1", ChannelName: "ops-prod", Command: "prod/deploy"}, true, "allow *"},
+		{"out of scope channel", PolicyRequest{Bot: "Slack", UserID: "U2", Groups: []string{"sre-team"}, Channel: "D1", Command: "prod/deploy"}, false, "scope prod/* in #ops-prod"},
+		{"deny of bot condition", PolicyRequest{Bot: "Telegram", UserID: "U2", Groups: []string{"sre-team"}, Command: "prod/deploy"}, false, "deny prod/*"},
+		{"deny wins over allow of other role", PolicyRequest{Bot: "Slack", UserID: "U3", Command: "k8s/pods"}, false, "deny k8s/*"},
+		{"channel subject", PolicyRequest{Bot: "Slack", UserID: "U1", Channel: "C-public", Command: "k8s/pods"}, false, "deny k8s/*"},
+		{"other channel", PolicyRequest{Bot: "Slack", UserID: "U1", Channel: "C-private", Command: "k8s/pods"}, true, "allow k8s/pods"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := p.Check(&tt.req)
+			if d.Allowed != tt.allowed || d.Rule != tt.rule {
+				t.Errorf("unexpected decision: %s", d)
+			}
+		})
+	}
+}
+
+func TestNewPolicy(t *testing.T) {
+
+	p, err := NewPolicy("")
+	if err != nil || p != nil {
+		t.Fatalf("empty config must have no policy, got %v, %v", p, err)
+	}
+
+	invalid := map[string]string{
+		"unknown role":    "roles: [{name: sre, rules: [{allow: ['*']}]}]\nbindings: [{role: dev, users: ['*']}]",
+		"no subjects":     "roles: [{name: sre, rules: [{allow: ['*']}]}]\nbindings: [{role: sre}]",
+		"empty rule":      "roles: [{name: sre, rules: [{}]}]",
+		"duplicated role": "roles: [{name: sre, rules: [{allow: ['*']}]}, {name: sre, rules: [{deny: ['*']}]}]",
+		"empty glob":      "roles: [{name: sre, rules: [{allow: ['']}]}]",
+		"scope channels":  "scopes: [{commands: ['prod/*']}]",
+	}
+	for name, config := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewPolicy(config); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestPolicyCondition(t *testing.T) {
+
+	p, err := NewPolicy(`
+roles:
+  - name: dev
+    rules:
+      - allow: ["k8s/*"]
+        when:
+          channels: ["dev-*"]
+bindings:
+  - role: dev
+    users: ["*"]
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !p.Allowed(&PolicyRequest{UserID: "U1", Channel: "C1", ChannelName: "dev-team", Command: "k8s/pods"}) {
+		t.Error("rule must be applied in dev channels")
+	}
+	if p.Allowed(&PolicyRequest{UserID: "U1", Channel: "C2", ChannelName: "random", Command: "k8s/pods"}) {
+		t.Error("rule must not be applied out of dev channels")
+	}
+	if d := p.CheckChannel(&PolicyRequest{Channel: "C2", Command: "k8s/pods"}); d != nil {
+		t.Errorf("command without scope must run anywhere, got %s", d)
+	}
+}
+
+func TestPolicyParams(t *testing.T) {
+
+	p, err := NewPolicy(`
+roles:
+  - name: dev
+    rules:
+      - allow: [deploy]
+        when:
+          params:
+            env: [staging, "dev-*"]
+  - name: sre
+    rules:
+      - allow: [deploy]
+      - deny: [deploy]
+        when:
+          params:
+            env: [dr]
+bindings:
+  - role: dev
+    users: [dev]
+  - role: sre
+    users: [sre]
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		user    string
+		params  ExecuteParams
+		allowed bool
+	}{
+		{"params aren't known yet", "dev", nil, true},
+		{"allowed value", "dev", ExecuteParams{"env": "staging"}, true},
+		{"allowed glob", "dev", ExecuteParams{"env": "dev-1"}, true},
+		{"not allowed value", "dev", ExecuteParams{"env": "prod"}, false},
+		{"all values must be allowed", "dev", ExecuteParams{"env": []interface{}{"staging", "prod"}}, false},
+		{"param is missing", "dev", ExecuteParams{}, false},
+		{"rule without params", "sre", ExecuteParams{"env": "prod"}, true},
+		{"deny isn't applied until params are known", "sre", nil, true},
+		{"any value is denied", "sre", ExecuteParams{"env": []interface{}{"prod", "dr"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := p.Check(&PolicyRequest{UserID: tt.user, Command: "deploy", Params: tt.params})
+			if d.Allowed != tt.allowed {
+				t.Errorf("unexpected decision: %s", d)
+			}
+		})
+	}
+
+	d := p.Check(&PolicyRequest{UserID: "dev", Command: "deploy", Params: ExecuteParams{"env": "staging"}})
+	if d.Rule != "allow deploy with env=staging|dev-*" {
+		t.Errorf("unexpected rule: %s", d.Rule)
+	}
+}
+
+func TestFindPermission(t *testing.T) {
+
+	permissions := "sre=^(k8s/.*)$,.*=^help$"
+	subject := func(name string) func(re *regexp.Regexp) bool {
+		return func(re *regexp.Regexp) bool { return re.MatchString(name) }
+	}
+
+	if p, err := FindPermission(permissions, "k8s/pods", subject("sre")); err != nil || p != "sre=^(k8s/.*)$" {
+		t.Errorf("unexpected permission %q, %v", p, err)
+	}
+	if p, err := FindPermission(permissions, "k8s/pods", subject("dev")); err != nil || p != "" {
+		t.Errorf("unexpected permission %q, %v", p, err)
+	}
+	if _, err := FindPermission("sre=^(k8s", "k8s/pods", subject("sre")); err == nil {
+		t.Error("expected regex error")
+	}
+}
@@ -0,0 +1,299 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devopsext/utils"
+)
+
+type RunbookStatus string
+
+const (
+	RunbookStatusPending     RunbookStatus = "pending"
+	RunbookStatusRunning     RunbookStatus = "running"
+	RunbookStatusWaiting     RunbookStatus = "waiting"
+	RunbookStatusDone        RunbookStatus = "done"
+	RunbookStatusFailed      RunbookStatus = "failed"
+	RunbookStatusSkipped     RunbookStatus = "skipped"
+	RunbookStatusInterrupted RunbookStatus = "interrupted"
+	RunbookStatusCancelled   RunbookStatus = "cancelled"
+	RunbookStatusRolledBack  RunbookStatus = "rolled_back"
+)
+
+type RunbookRunStep struct {
+	ID       string        `json:"id"`
+	Status   RunbookStatus `json:"status"`
+	Text     string        `json:"text,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Started  *time.Time    `json:"started,omitempty"`
+	Finished *time.Time    `json:"finished,omitempty"`
+}
+
+type RunbookRun struct {
+	ID       string                     `json:"id"`
+	Name     string                     `json:"name"`
+	Path     string                     `json:"path"`
+	Command  string                     `json:"command,omitempty"`
+	Bot      string                     `json:"bot,omitempty"`
+	Channel  string                     `json:"channel,omitempty"`
+	Message  string                     `json:"message,omitempty"`
+	User     string                     `json:"user,omitempty"`
+	UserName string                     `json:"user_name,omitempty"`
+	Reply    string                     `json:"reply,omitempty"`
+	Params   map[string]interface{}     `json:"params,omitempty"`
+	Status   RunbookStatus              `json:"status"`
+	Error    string                     `json:"error,omitempty"`
+	Steps    map[string]*RunbookRunStep `json:"steps,omitempty"`
+	Started  time.Time                  `json:"started"`
+	Finished *time.Time                 `json:"finished,omitempty"`
+}
+
+// RunbookStore keeps runbook runs in memory and, if dir is set, in a JSON file per run
+type RunbookStore struct {
+	dir       string
+	retention time.Duration
+	lock      sync.RWMutex
+	runs      map[string]*RunbookRun
+	active    map[string]bool
+}
+
+const runbookRunFileExt = ".json"
+
+func (rr *RunbookRun) Finish(err error) {
+
+	now := time.Now()
+	rr.Finished = &now
+	rr.Status = RunbookStatusDone
+	rr.Error = ""
+	if err != nil {
+		rr.Status = RunbookStatusFailed
+		rr.Error = err.Error()
+	}
+	if errors.Is(err, context.Canceled) {
+		rr.Status = RunbookStatusCancelled
+	}
+}
+
+func (rr *RunbookRun) StepFinished(id string) bool {
+
+	if rr.Steps == nil {
+		return false
+	}
+	s, ok := rr.Steps[id]
+	if !ok || s == nil {
+		return false
+	}
+	return s.Status == RunbookStatusDone || s.Status == RunbookStatusSkipped
+}
+
+func (rr *RunbookRun) copy() (*RunbookRun, []byte, error) {
+
+	data, err := json.Marshal(rr)
+	if err != nil {
+		return nil, nil, err
+	}
+	var r RunbookRun
+	err = json.Unmarshal(data, &r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &r, data, nil
+}
+
+func (rs *RunbookStore) filePath(id string) string {
+	return filepath.Join(rs.dir, fmt.Sprintf("%s%s", id, runbookRunFileExt))
+}
+
+func (rs *RunbookStore) Persistent() bool {
+	return !utils.IsEmpty(rs.dir)
+}
+
+// prune removes finished runs which are older than retention
+func (rs *RunbookStore) prune() {
+
+	if rs.retention <= 0 {
+		return
+	}
+	for id, r := range rs.runs {
+		if r.Finished == nil || time.Since(*r.Finished) < rs.retention {
+			continue
+		}
+		delete(rs.runs, id)
+		if rs.Persistent() {
+			os.Remove(rs.filePath(id))
+		}
+	}
+}
+
+// Save stores a copy of the run, so callers are free to change it later
+func (rs *RunbookStore) Save(run *RunbookRun) error {
+
+	if run == nil || utils.IsEmpty(run.ID) {
+		return fmt.Errorf("runbook run has no id")
+	}
+
+	r, data, err := run.copy()
+	if err != nil {
+		return err
+	}
+
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	rs.runs[r.ID] = r
+	rs.prune()
+
+	if !rs.Persistent() {
+		return nil
+	}
+	return os.WriteFile(rs.filePath(r.ID), data, 0644)
+}
+
+func (rs *RunbookStore) Get(id string) *RunbookRun {
+
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+
+	r, ok := rs.runs[id]
+	if !ok {
+		return nil
+	}
+	c, _, err := r.copy()
+	if err != nil {
+		return nil
+	}
+	return c
+}
+
+// List returns copies of runs, newest first, filtered by runbook name if it's set
+func (rs *RunbookStore) List(name string, limit int) []*RunbookRun {
+
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+
+	r := []*RunbookRun{}
+	for _, v := range rs.runs {
+		if !utils.IsEmpty(name) && v.Name != name {
+			continue
+		}
+		c, _, err := v.copy()
+		if err != nil {
+			continue
+		}
+		r = append(r, c)
+	}
+
+	sort.Slice(r, func(i, j int) bool {
+		return r[i].Started.After(r[j].Started)
+	})
+
+	if limit > 0 && len(r) > limit {
+		r = r[:limit]
+	}
+	return r
+}
+
+// Acquire marks run as active in this process, it returns false if run is already active
+func (rs *RunbookStore) Acquire(id string) bool {
+
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	if rs.active[id] {
+		return false
+	}
+	rs.active[id] = true
+	return true
+}
+
+func (rs *RunbookStore) Release(id string) {
+
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	delete(rs.active, id)
+}
+
+func (rs *RunbookStore) load() error {
+
+	entries, err := os.ReadDir(rs.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+
+		if e.IsDir() || filepath.Ext(e.Name()) != runbookRunFileExt {
+			continue
+		}
+
+		path := filepath.Join(rs.dir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		var r RunbookRun
+		err = json.Unmarshal(data, &r)
+		if err != nil {
+			return fmt.Errorf("couldn't read runbook run %s: %s", path, err)
+		}
+		if utils.IsEmpty(r.ID) {
+			r.ID = strings.TrimSuffix(e.Name(), runbookRunFileExt)
+		}
+
+		// runs which were running before restart can't be running anymore
+		if r.Status == RunbookStatusRunning || r.Status == RunbookStatusPending {
+			r.Status = RunbookStatusInterrupted
+			for _, s := range r.Steps {
+				if s != nil && (s.Status == RunbookStatusRunning || s.Status == RunbookStatusWaiting) {
+					s.Status = RunbookStatusInterrupted
+				}
+			}
+			data, err = json.Marshal(&r)
+			if err != nil {
+				return err
+			}
+			err = os.WriteFile(path, data, 0644)
+			if err != nil {
+				return err
+			}
+		}
+		rs.runs[r.ID] = &r
+	}
+	return nil
+}
+
+func NewRunbookStore(dir string, retention time.Duration) (*RunbookStore, error) {
+
+	rs := &RunbookStore{
+		dir:       dir,
+		retention: retention,
+		runs:      make(map[string]*RunbookRun),
+		active:    make(map[string]bool),
+	}
+
+	if !rs.Persistent() {
+		return rs, nil
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	err = rs.load()
+	if err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
@@ -0,0 +1,141 @@
+package common
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunbookStorePersistence(t *testing.T) {
+
+	dir := t.TempDir()
+
+	store, err := NewRunbookStore(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if !store.Persistent() {
+		t.Fatalf("Expected store with dir to be persistent")
+	}
+
+	run := &RunbookRun{
+		ID:      "run-1",
+		Name:    "deploy",
+		Status:  RunbookStatusRunning,
+		Started: time.Now(),
+		Steps: map[string]*RunbookRunStep{
+			"build":  {ID: "build", Status: RunbookStatusDone, Text: "ok"},
+			"deploy": {ID: "deploy", Status: RunbookStatusRunning},
+		},
+	}
+	if err := store.Save(run); err != nil {
+		t.Fatalf("Failed to save run: %v", err)
+	}
+
+	// store keeps its own copy
+	run.Status = RunbookStatusFailed
+	if r := store.Get("run-1"); r == nil || r.Status != RunbookStatusRunning {
+		t.Fatalf("Expected stored run to be running, got %+v", r)
+	}
+
+	// reload simulates restart
+	store, err = NewRunbookStore(dir, 0)
+	if err != nil {
+		t.Fatalf("Failed to reload store: %v", err)
+	}
+
+	r := store.Get("run-1")
+	if r == nil {
+		t.Fatalf("Expected run to be loaded from disk")
+	}
+	if r.Status != RunbookStatusInterrupted {
+		t.Errorf("Expected status %s, got %s", RunbookStatusInterrupted, r.Status)
+	}
+	if !r.StepFinished("build") {
+		t.Errorf("Expected step build to be finished")
+	}
+	if r.StepFinished("deploy") {
+		t.Errorf("Expected step deploy not to be finished")
+	}
+	if r.Steps["deploy"].Status != RunbookStatusInterrupted {
+		t.Errorf("Expected step deploy to be interrupted, got %s", r.Steps["deploy"].Status)
+	}
+}
+
+func TestRunbookStoreAcquire(t *testing.T) {
+
+	store, err := NewRunbookStore("", 0)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if store.Persistent() {
+		t.Fatalf("Expected store without dir to be in memory")
+	}
+
+	if !store.Acquire("run-1") {
+		t.Fatalf("Expected first acquire to succeed")
+	}
+	if store.Acquire("run-1") {
+		t.Errorf("Expected second acquire to fail")
+	}
+	store.Release("run-1")
+	if !store.Acquire("run-1") {
+		t.Errorf("Expected acquire after release to succeed")
+	}
+}
+
+func TestRunbookStoreRetention(t *testing.T) {
+
+	store, err := NewRunbookStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	old := &RunbookRun{ID: "old", Started: time.Now().Add(-3 * time.Hour)}
+	old.Finish(errors.New("failed"))
+	finished := time.Now().Add(-2 * time.Hour)
+	old.Finished = &finished
+
+	if old.Status != RunbookStatusFailed || old.Error != "failed" {
+		t.Errorf("Expected failed run, got %s %s", old.Status, old.Error)
+	}
+
+	store.Save(old)
+	store.Save(&RunbookRun{ID: "new", Status: RunbookStatusRunning, Started: time.Now()})
+
+	if store.Get("old") != nil {
+		t.Errorf("Expected old run to be pruned")
+	}
+	if store.Get("new") == nil {
+		t.Errorf("Expected new run to be kept")
+	}
+}
+
+func TestRunbookStoreList(t *testing.T) {
+
+	store, err := NewRunbookStore("", 0)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+
+	now := time.Now()
+	store.Save(&RunbookRun{ID: "run-1", Name: "deploy", Started: now.Add(-2 * time.Minute)})
+	store.Save(&RunbookRun{ID: "run-2", Name: "restart", Started: now.Add(-time.Minute)})
+	store.Save(&RunbookRun{ID: "run-3", Name: "deploy", Started: now})
+
+	runs := store.List("", 0)
+	if len(runs) != 3 || runs[0].ID != "run-3" || runs[2].ID != "run-1" {
+		t.Fatalf("Expected runs newest first, got %+v", runs)
+	}
+
+	runs = store.List("deploy", 1)
+	if len(runs) != 1 || runs[0].ID != "run-3" {
+		t.Errorf("Expected latest deploy run, got %+v", runs)
+	}
+
+	// list returns copies
+	runs[0].Name = "changed"
+	if store.Get("run-3").Name != "deploy" {
+		t.Errorf("Expected stored run not to be changed")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"slices"
 	"strings"
+	"syscall"
 	"text/template"
 	"time"
 
@@ -23,7 +24,8 @@ func LoadYaml(config string, obj interface{}) (bool, error) {
 
 	raw := ""
 
-	if _, err := os.Stat(config); errors.Is(err, os.ErrNotExist) {
+	// long content can't be a file name either
+	if _, err := os.Stat(config); errors.Is(err, os.ErrNotExist) || errors.Is(err, syscall.ENAMETOOLONG) {
 		raw = config
 	} else {
 		r, err := os.ReadFile(config)
@@ -1,12 +1,15 @@
 package processor
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -32,21 +35,40 @@ type DefaultRunbookStepResult struct {
 	Error        error
 }
 
+type defaultRunbookAttempt struct {
+	result *DefaultRunbookStepResult
+	posts  []*DefaultPost
+	err    error
+}
+
 type DefaultRunbookStepResultFunc = func(result *DefaultRunbookStepResult, parent common.Message) error
 
 type DefaultRunbookStep struct {
-	ID       string
-	Step     string
-	Template string
-	Command  string
-	Disabled bool
-	Pipeline []*DefaultRunbookStep
+	ID              string
+	Step            string
+	Template        string
+	Command         string
+	Disabled        bool
+	When            string
+	Retries         int
+	Backoff         string
+	Timeout         string
+	ContinueOnError bool `yaml:"continueOnError"`
+	Approval        *DefaultApproval
+	ApprovalTimeout string `yaml:"approvalTimeout"`
+	Foreach         string
+	Concurrency     int
+	Mode            string
+	Pipeline        []*DefaultRunbookStep
 }
 
 type DefaultRunbookConfig struct {
 	Description string
 	Params      []string
+	Mode        string
+	Progress    bool
 	Pipeline    []*DefaultRunbookStep
+	Rollback    []*DefaultRunbookStep
 }
 
 type DefaultRunbook struct {
@@ -55,10 +77,31 @@ type DefaultRunbook struct {
 	command        *DefaultCommand
 	config         *DefaultRunbookConfig
 	parentExecutor *DefaultExecutor
+	steps          *sync.Map
+	items          *sync.Map // foreach children to the step which is expanded
+	run            *common.RunbookRun
+	runLock        sync.Mutex
+	completed      []string
+	completedLock  sync.Mutex
+	progress       *DefaultRunbookProgress
+	ctx            context.Context
 }
 
 type DefaultPostKind = int
 
+const (
+	DefaultRunbookModeParallel   = "parallel"
+	DefaultRunbookModeSequential = "sequential"
+	DefaultRunbookResumeAction   = "runbook-resume"
+	DefaultRunbookRollbackID     = "rollback"
+
+	// approval isn't waited longer than bots keep it in cache
+	DefaultRunbookApprovalTimeout = time.Hour
+)
+
+// runtime objects can't be stored within a run, they are set again on resume
+var defaultRunbookRuntimeParams = []string{"bot", "message", "user", "caller", "channel", "action", "steps"}
+
 const (
 	DefaultPostKindTemplate = 0
 	DefaultPostKindCommand  = 1
@@ -86,6 +129,7 @@ type DefaultExecutor struct {
 	message     common.Message
 	template    *toolsRender.TextTemplate
 	action      common.Action
+	ctx         context.Context // done once command of the message is cancelled
 }
 
 type DefaultFieldWrapper struct {
@@ -124,13 +168,15 @@ type DefaultRunbookExecutor struct {
 }
 
 type DefaultOptions struct {
-	CommandsDir  string
-	TemplatesDir string
-	RunbooksDir  string
-	CommandExt   string
-	ConfigExt    string
-	Description  string
-	Error        string
+	CommandsDir          string
+	TemplatesDir         string
+	RunbooksDir          string
+	RunbookRunsDir       string
+	RunbookRunsRetention string
+	CommandExt           string
+	ConfigExt            string
+	Description          string
+	Error                string
 }
 
 type DefaultResponse struct {
@@ -196,6 +242,11 @@ type DefaultCommandApproval struct {
 	command *DefaultCommand
 }
 
+type DefaultRunbookApproval struct {
+	runbook  *DefaultRunbook
+	approval *DefaultApproval
+}
+
 type DefaultCommandAction struct {
 	command  *DefaultCommand
 	name     string
@@ -219,6 +270,7 @@ type Default struct {
 	commands      []common.Command
 	meter         sreCommon.Meter
 	observability *common.Observability
+	runs          *common.RunbookStore
 }
 
 // Default executor
@@ -296,6 +348,11 @@ func (de *DefaultExecutor) filePath(dir, fileName string) string {
 	return fmt.Sprintf("%s%s%s", dir, string(os.PathSeparator), fileName)
 }
 
+func (de *DefaultExecutor) dryRun(obj interface{}) bool {
+	m, _ := obj.(map[string]interface{})
+	return runbookDryRun(de.bot, m, de.params)
+}
+
 func (de *DefaultExecutor) fPostFile(path string, obj interface{}, kind DefaultPostKind) string {
 
 	gid := utils.GoRoutineID()
@@ -547,6 +604,10 @@ func (de *DefaultExecutor) fRunBook(fileName string, obj interface{}) (string, e
 		return "", err
 	}
 
+	if de.dryRun(obj) {
+		return rb.Plan(de.bot, de.message, obj), nil
+	}
+
 	err = rb.Execute(de.bot, de.message, obj, de.runbookAfterCallback, true)
 	if err != nil {
 		return "", err
@@ -554,6 +615,23 @@ func (de *DefaultExecutor) fRunBook(fileName string, obj interface{}) (string, e
 	return "", nil
 }
 
+func (de *DefaultExecutor) fPlanBook(fileName string, obj interface{}) (string, error) {
+
+	s := de.filePath(de.command.processor.options.RunbooksDir, fileName)
+	if !utils.FileExists(s) {
+		return "", fmt.Errorf("Default couldn't find runbook file %s", s)
+	}
+
+	ext := filepath.Ext(fileName)
+	name := strings.TrimSuffix(fileName, ext)
+
+	rb, err := NewRunbook(name, s, de.command, de)
+	if err != nil {
+		return "", err
+	}
+	return rb.Plan(de.bot, de.message, obj), nil
+}
+
 func (de *DefaultExecutor) fSendMessageEx(message, channels string, params map[string]interface{}, parent string) (string, error) {
 
 	if utils.IsEmpty(message) {
@@ -746,6 +824,19 @@ func (de *DefaultExecutor) fAddRemoveReactionOnMessage(channelID, messageID, fir
 	return ""
 }
 
+// context is background one for executors which aren't bound to a message
+func (de *DefaultExecutor) context() context.Context {
+	if de.ctx == nil {
+		return context.Background()
+	}
+	return de.ctx
+}
+
+// fIsCancelled lets long templates stop once command is cancelled
+func (de *DefaultExecutor) fIsCancelled() bool {
+	return de.context().Err() != nil
+}
+
 func (de *DefaultExecutor) fAskOpenAI(params map[string]interface{}) string {
 	apiKey, _ := params["apiKey"].(string)
 	model, _ := params["model"].(string)
@@ -792,8 +883,28 @@ func (de *DefaultExecutor) fAskOpenAI(params map[string]interface{}) string {
 		BaseURL:  baseURL,
 	}
 
-	openAI := vendors.NewOpenAI(options)
-	response, err := openAI.CreateChatCompletion(options)
+	type completion struct {
+		response []byte
+		err      error
+	}
+
+	ch := make(chan *completion, 1)
+	go func() {
+		openAI := vendors.NewOpenAI(options)
+		response, err := openAI.CreateChatCompletion(options)
+		ch <- &completion{response: response, err: err}
+	}()
+
+	var c *completion
+	select {
+	case c = <-ch:
+	case <-de.context().Done():
+		e := true
+		de.error = &e
+		return "OpenAI request is cancelled"
+	}
+
+	response, err := c.response, c.err
 	log.Printf("OpenAI response: %s", string(response))
 	if err != nil {
 		e := true
@@ -1039,6 +1150,15 @@ func (de *DefaultExecutor) runbookAfter(post *DefaultPost, message common.Messag
 		return err
 	}
 
+	// plan is posted instead of step results
+	if de.dryRun(post.Obj) {
+		r := &DefaultRunbookStepResult{
+			ID:   post.Name,
+			Text: rb.Plan(de.bot, message, post.Obj),
+		}
+		return de.runbookAfterCallback(r, message)
+	}
+
 	err = rb.Execute(de.bot, message, post.Obj, de.runbookAfterCallback, waitGroup)
 	if err != nil {
 		return err
@@ -1122,6 +1242,7 @@ func NewExecutorTemplate(name string, content string, executor *DefaultExecutor,
 	funcs["runTemplate"] = executor.fRunTemplate
 	funcs["runTemplateAsJson"] = executor.fRunTemplateAsJson
 	funcs["runBook"] = executor.fRunBook
+	funcs["planBook"] = executor.fPlanBook
 	funcs["postFile"] = executor.fPostFile
 	funcs["postCommand"] = executor.fPostCommand
 	funcs["postTemplate"] = executor.fPostTemplate
@@ -1145,6 +1266,7 @@ func NewExecutorTemplate(name string, content string, executor *DefaultExecutor,
 	funcs["tagMessage"] = executor.fTagMessage
 	funcs["findMessagesByTag"] = executor.fFindMessagesByTag
 	funcs["gracefulAbort"] = executor.fGracefulAbort
+	funcs["isCancelled"] = executor.fIsCancelled
 
 	templateOpts := toolsRender.TemplateOptions{
 		Name:    fmt.Sprintf("default-internal-%s", name),
@@ -1187,6 +1309,7 @@ func NewExecutor(name, path string, command *DefaultCommand, bot common.Bot, mes
 		action:      action,
 		visible:     visible,
 		error:       nil,
+		ctx:         common.MessageContext(message),
 	}
 
 	template, err := NewExecutorTemplate(name, string(content), executor, command.processor.observability)
@@ -1646,7 +1769,7 @@ func (dre *DefaultRunbookCommandExecutor) execute() error {
 
 	m := dre.message
 
-	_, err := dre.bot.Command(channel.ID(), dre.command, user, m, response)
+	_, err := dre.bot.Command(channel.ID(), dre.command, nil, user, m, response)
 	return err
 }
 
@@ -1684,7 +1807,8 @@ func (dre *DefaultRunbookExecutor) loadPosts() []*DefaultPost {
 	return posts
 }
 
-func NewRunbookExecutor(rb *DefaultRunbook, step *DefaultRunbookStep, bot common.Bot, message common.Message, params common.ExecuteParams) (*DefaultRunbookExecutor, error) {
+// NewRunbookExecutor binds templates to ctx, so they can stop once step times out or runbook is cancelled
+func NewRunbookExecutor(ctx context.Context, rb *DefaultRunbook, step *DefaultRunbookStep, bot common.Bot, message common.Message, params common.ExecuteParams) (*DefaultRunbookExecutor, error) {
 
 	if utils.IsEmpty(step.Template) && utils.IsEmpty(step.Command) {
 		return nil, nil
@@ -1708,6 +1832,7 @@ func NewRunbookExecutor(rb *DefaultRunbook, step *DefaultRunbookStep, bot common
 			bot:         bot,
 			message:     message,
 			params:      params,
+			ctx:         ctx,
 		}
 
 		name := fmt.Sprintf("runbook-%s", rb.name)
@@ -1746,14 +1871,724 @@ func (dr *DefaultRunbook) countPipelineSteps(pl []*DefaultRunbookStep) int {
 	return r
 }
 
-func (dr *DefaultRunbook) runPipeline(id string, pl []*DefaultRunbookStep, bot common.Bot, parent common.Message, params map[string]interface{},
-	callback DefaultRunbookStepResultFunc, waitGroup bool) error {
+func (dr *DefaultRunbook) parseDuration(id, name, value string) (time.Duration, error) {
 
-	if dr.countPipelineSteps(pl) == 0 {
+	if utils.IsEmpty(value) {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("Default runbook %s step %s has invalid %s %s: %s", dr.name, id, name, value, err)
+	}
+	return d, nil
+}
+
+// when condition is rendered with step params, empty or false-like result skips the step
+func (dr *DefaultRunbook) stepAllowed(step *DefaultRunbookStep, params map[string]interface{}) bool {
+
+	if utils.IsEmpty(step.When) {
+		return true
+	}
+
+	s := common.Render(step.When, params, dr.command.processor.observability)
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	switch s {
+	case "", "false", "0", "no", "off", "<no value>":
+		return false
+	}
+	return true
+}
+
+// step results are available in templates as .steps.<id>.text, .steps.<id>.json and .steps.<id>.error
+func (dr *DefaultRunbook) setStepResult(id string, step *DefaultRunbookStep, result *DefaultRunbookStepResult, err error) {
+
+	r := make(map[string]interface{})
+	r["id"] = id
+	r["text"] = ""
+	r["error"] = ""
+
+	if result != nil {
+		r["text"] = result.Text
+
+		var v interface{}
+		if !utils.IsEmpty(result.Text) && json.Unmarshal([]byte(result.Text), &v) == nil {
+			r["json"] = v
+		}
+	}
+	if err != nil {
+		r["error"] = err.Error()
+	}
+
+	dr.steps.Store(id, r)
+	if !utils.IsEmpty(step.ID) && step.ID != id {
+		dr.steps.Store(step.ID, r)
+	}
+}
+
+func (dr *DefaultRunbook) stepResults() map[string]interface{} {
+
+	r := make(map[string]interface{})
+	dr.steps.Range(func(key, value any) bool {
+		r[key.(string)] = value
+		return true
+	})
+	return r
+}
+
+// stepContext is done once command which runs the runbook is cancelled
+func (dr *DefaultRunbook) stepContext() context.Context {
+	if dr.ctx == nil {
+		return context.Background()
+	}
+	return dr.ctx
+}
+
+func (dr *DefaultRunbook) cancelled(id string) error {
+	return fmt.Errorf("Default runbook %s step %s is cancelled: %w", dr.name, id, context.Canceled)
+}
+
+func (dr *DefaultRunbook) executeStepOnce(id string, step *DefaultRunbookStep, bot common.Bot, parent common.Message, params map[string]interface{},
+	timeout time.Duration) (*DefaultRunbookStepResult, []*DefaultPost, error) {
+
+	ctx := dr.stepContext()
+	if timeout <= 0 && ctx.Done() == nil {
+		a := dr.attemptStep(ctx, id, step, bot, parent, params)
+		return a.result, a.posts, a.err
+	}
+
+	// templates stop by context, commands don't get it, so attempt which ignores context is abandoned once it's timed out,
+	// it runs until it returns on its own, its result is dropped and the next attempt doesn't wait for it
+	var actx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		actx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		actx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	ch := make(chan *defaultRunbookAttempt, 1)
+	go func() {
+		ch <- dr.attemptStep(actx, id, step, bot, parent, params)
+	}()
+
+	select {
+	case a := <-ch:
+		return a.result, a.posts, a.err
+	case <-actx.Done():
+	}
+
+	if ctx.Err() != nil {
+		return nil, nil, dr.cancelled(id)
+	}
+	return nil, nil, fmt.Errorf("Default runbook %s step %s timed out after %s", dr.name, id, timeout)
+}
+
+func (dr *DefaultRunbook) attemptStep(ctx context.Context, id string, step *DefaultRunbookStep, bot common.Bot, parent common.Message,
+	params map[string]interface{}) *defaultRunbookAttempt {
+
+	executor, err := NewRunbookExecutor(ctx, dr, step, bot, parent, params)
+	if err != nil {
+		return &defaultRunbookAttempt{err: err}
+	}
+	if executor == nil {
+		return &defaultRunbookAttempt{}
+	}
+	r := executor.execute(id, params, parent)
+	// posts are stored per goroutine, so they should be loaded in the same one
+	posts := executor.loadPosts()
+	if r != nil && r.Error != nil {
+		return &defaultRunbookAttempt{result: r, err: r.Error}
+	}
+	return &defaultRunbookAttempt{result: r, posts: posts}
+}
+
+// executeStep runs step with retries, backoff doubles after every failed attempt
+func (dr *DefaultRunbook) executeStep(id string, step *DefaultRunbookStep, bot common.Bot, parent common.Message, params map[string]interface{}) (*DefaultRunbookStepResult, []*DefaultPost, error) {
+
+	timeout, err := dr.parseDuration(id, "timeout", step.Timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	backoff, err := dr.parseDuration(id, "backoff", step.Backoff)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger := dr.command.logger
+	attempts := step.Retries + 1
+
+	var r *DefaultRunbookStepResult
+	var posts []*DefaultPost
+
+	for i := 1; i <= attempts; i++ {
+
+		r, posts, err = dr.executeStepOnce(id, step, bot, parent, params, timeout)
+		if err == nil {
+			return r, posts, nil
+		}
+		if i == attempts || errors.Is(err, context.Canceled) {
+			break
+		}
+
+		logger.Warn("Default runbook %s step %s attempt %d of %d failed: %s", dr.name, id, i, attempts, err)
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-dr.stepContext().Done():
+				timer.Stop()
+				return r, posts, dr.cancelled(id)
+			}
+			backoff = backoff * 2
+		}
+	}
+	return r, posts, err
+}
+
+// run params keep only values which can be stored
+func (dr *DefaultRunbook) runParams(params map[string]interface{}) map[string]interface{} {
+
+	r := make(map[string]interface{})
+	for k, v := range params {
+		if slices.Contains(defaultRunbookRuntimeParams, k) {
+			continue
+		}
+		if _, err := json.Marshal(v); err != nil {
+			continue
+		}
+		r[k] = v
+	}
+	return r
+}
+
+func (dr *DefaultRunbook) updateRun(f func(run *common.RunbookRun)) {
+
+	if dr.run == nil {
+		return
+	}
+
+	dr.runLock.Lock()
+	defer dr.runLock.Unlock()
+
+	if f != nil {
+		f(dr.run)
+	}
+	err := dr.command.processor.runs.Save(dr.run)
+	if err != nil {
+		dr.command.logger.Error("Default runbook %s couldn't save run %s: %s", dr.name, dr.run.ID, err)
+	}
+}
+
+func (dr *DefaultRunbook) setRunStep(id string, status common.RunbookStatus, text string, err error) {
+
+	if status == common.RunbookStatusFailed && errors.Is(err, context.Canceled) {
+		status = common.RunbookStatusCancelled
+	}
+
+	if dr.progress != nil {
+		dr.progress.setStatus(id, status)
+	}
+
+	dr.updateRun(func(run *common.RunbookRun) {
+
+		if run.Steps == nil {
+			run.Steps = make(map[string]*common.RunbookRunStep)
+		}
+		s, ok := run.Steps[id]
+		if !ok {
+			s = &common.RunbookRunStep{ID: id}
+			run.Steps[id] = s
+		}
+
+		now := time.Now()
+		s.Status = status
+		s.Text = text
+		s.Error = ""
+		if err != nil {
+			s.Error = err.Error()
+		}
+		if status == common.RunbookStatusRunning {
+			s.Started = &now
+			s.Finished = nil
+			return
+		}
+		s.Finished = &now
+	})
+}
+
+// stepFinished returns status of the step which was finished before resume, its result is restored
+func (dr *DefaultRunbook) stepFinished(id string, step *DefaultRunbookStep) (common.RunbookStatus, bool) {
+
+	if dr.run == nil {
+		return "", false
+	}
+
+	dr.runLock.Lock()
+	defer dr.runLock.Unlock()
+
+	if !dr.run.StepFinished(id) {
+		return "", false
+	}
+
+	s := dr.run.Steps[id]
+	if s.Status == common.RunbookStatusDone {
+		dr.setStepResult(id, step, &DefaultRunbookStepResult{ID: id, Text: s.Text}, nil)
+	}
+	return s.Status, true
+}
+
+func (dr *DefaultRunbook) newRun(bot common.Bot, message common.Message, params map[string]interface{}) {
+
+	runs := dr.command.processor.runs
+	if runs == nil {
+		return
+	}
+
+	run := &common.RunbookRun{
+		ID:      common.UUID(),
+		Name:    dr.name,
+		Path:    dr.path,
+		Command: dr.command.getNameWithGroup("/"),
+		Params:  dr.runParams(params),
+		Status:  common.RunbookStatusPending,
+		Steps:   make(map[string]*common.RunbookRunStep),
+		Started: time.Now(),
+	}
+	if !utils.IsEmpty(bot) {
+		run.Bot = bot.Name()
+	}
+
+	var channel common.Channel
+	var user common.User
+
+	if !utils.IsEmpty(message) {
+		run.Message = message.ID()
+		channel = message.Channel()
+		user = message.User()
+	}
+	if !utils.IsEmpty(channel) {
+		run.Channel = channel.ID()
+	}
+	if !utils.IsEmpty(user) {
+		run.User = user.ID()
+		run.UserName = user.Name()
+	}
+
+	// run message lets users resume the run after restart or failure
+	if runs.Persistent() && !utils.IsEmpty(run.Channel) && !utils.IsEmpty(bot) {
+
+		var response common.Response
+		if !utils.IsEmpty(dr.parentExecutor) {
+			response = dr.parentExecutor.Response()
+		}
+
+		action := &DefaultCommandAction{
+			command:  dr.command,
+			name:     DefaultRunbookResumeAction,
+			label:    "Resume",
+			template: run.ID,
+			style:    "primary",
+		}
+
+		text := fmt.Sprintf("Runbook %s run %s", dr.name, run.ID)
+		reply, err := bot.PostMessage(run.Channel, text, nil, []common.Action{action}, user, message, response)
+		if err != nil {
+			dr.command.logger.Error("Default runbook %s couldn't post run %s: %s", dr.name, run.ID, err)
+		}
+		run.Reply = reply
+	}
+
+	dr.run = run
+	dr.updateRun(nil)
+}
+
+func (dr *DefaultRunbook) finishRun(bot common.Bot, err error) {
+
+	if dr.run == nil {
+		return
+	}
+
+	dr.updateRun(func(run *common.RunbookRun) {
+		run.Finish(err)
+	})
+
+	if err != nil || utils.IsEmpty(dr.run.Reply) || utils.IsEmpty(bot) {
+		return
+	}
+
+	err = bot.RemoveAction(dr.run.Channel, dr.run.Reply, DefaultRunbookResumeAction)
+	if err != nil {
+		dr.command.logger.Error("Default runbook %s couldn't remove resume action of run %s: %s", dr.name, dr.run.ID, err)
+	}
+}
+
+// waitApproval blocks the step until the approval is approved, rejected or expired
+func (dr *DefaultRunbook) waitApproval(id string, step *DefaultRunbookStep, bot common.Bot, parent common.Message, params map[string]interface{}) error {
+
+	if step.Approval == nil || step.Approval.Disabled {
+		return nil
+	}
+
+	timeout, err := dr.parseDuration(id, "approvalTimeout", step.ApprovalTimeout)
+	if err != nil {
+		return err
+	}
+	if timeout <= 0 {
+		timeout = DefaultRunbookApprovalTimeout
+	}
+
+	approval := &DefaultRunbookApproval{
+		runbook:  dr,
+		approval: step.Approval,
+	}
+
+	var user common.User
+	channel := strings.TrimSpace(approval.Channel(bot, parent, params))
+	if !utils.IsEmpty(parent) {
+		user = parent.User()
+		if utils.IsEmpty(channel) && !utils.IsEmpty(parent.Channel()) {
+			channel = parent.Channel().ID()
+		}
+	}
+
+	message := strings.TrimSpace(approval.Message(bot, parent, params))
+	if utils.IsEmpty(message) {
+		message = fmt.Sprintf("Runbook %s step %s is waiting for approval", dr.name, id)
+	}
+
+	type decision struct {
+		approved bool
+		approver common.User
+		reasons  string
+	}
+
+	ch := make(chan *decision, 1)
+	approvalID, err := bot.AskApproval(channel, message, approval, user, parent, func(approved bool, approver common.User, reasons string) {
+		select {
+		case ch <- &decision{approved: approved, approver: approver, reasons: reasons}:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	dr.setRunStep(id, common.RunbookStatusWaiting, "", nil)
+
+	// approval message shouldn't wait for decision which nobody needs
+	cancelApproval := func() {
+		err := bot.Cancel(approvalID, nil)
+		if err != nil && !errors.Is(err, common.ErrMessageNotCancellable) {
+			dr.command.logger.Error("Default runbook %s couldn't cancel approval of step %s: %s", dr.name, id, err)
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var d *decision
+	select {
+	case d = <-ch:
+	case <-timer.C:
+		cancelApproval()
+		return fmt.Errorf("Runbook %s step %s approval expired after %s", dr.name, id, timeout)
+	case <-dr.stepContext().Done():
+		cancelApproval()
+		return dr.cancelled(id)
+	}
+
+	approver := ""
+	if !utils.IsEmpty(d.approver) {
+		approver = d.approver.Name()
+	}
+	params["approval"] = map[string]interface{}{
+		"approved": d.approved,
+		"approver": approver,
+		"reasons":  d.reasons,
+	}
+
+	if !d.approved {
+		return fmt.Errorf("Runbook %s step %s is rejected by %s", dr.name, id, approver)
+	}
+	dr.command.logger.Debug("Default runbook %s step %s is approved by %s", dr.name, id, approver)
+	return nil
+}
+
+func (dr *DefaultRunbook) stepCompleted(id string) {
+
+	dr.completedLock.Lock()
+	defer dr.completedLock.Unlock()
+
+	dr.completed = append(dr.completed, id)
+}
+
+// rollbackMatches returns true if rollback step belongs to the completed step, either by full or own ID.
+// Children of foreach belong to the step which is expanded.
+func (dr *DefaultRunbook) rollbackMatches(step *DefaultRunbookStep, id string) bool {
+
+	if step.ID == id || strings.HasSuffix(id, fmt.Sprintf(".%s", step.ID)) {
+		return true
+	}
+	if parent, ok := dr.items.Load(id); ok {
+		return dr.rollbackMatches(step, parent.(string))
+	}
+	return false
+}
+
+// rollback runs compensating steps in reverse order of completed steps, steps without ID run at the end
+func (dr *DefaultRunbook) rollback(bot common.Bot, parent common.Message, params map[string]interface{},
+	callback DefaultRunbookStepResultFunc, failure error) {
+
+	if dr.countPipelineSteps(dr.config.Rollback) == 0 {
+		return
+	}
+
+	// compensating steps run even if runbook is cancelled
+	dr.ctx = context.WithoutCancel(dr.stepContext())
+
+	logger := dr.command.logger
+	logger.Debug("Default runbook %s is rolling back...", dr.name)
+
+	// previous rollback should not prevent a new one after resume
+	prefix := fmt.Sprintf("%s.", DefaultRunbookRollbackID)
+	dr.updateRun(func(run *common.RunbookRun) {
+		for k := range run.Steps {
+			if strings.HasPrefix(k, prefix) {
+				delete(run.Steps, k)
+			}
+		}
+	})
+
+	dr.completedLock.Lock()
+	completed := slices.Clone(dr.completed)
+	dr.completedLock.Unlock()
+	slices.Reverse(completed)
+
+	localParams := make(map[string]any)
+	maps.Copy(localParams, params)
+	localParams["error"] = failure.Error()
+
+	run := func(id string, step *DefaultRunbookStep) bool {
+		err := dr.runStep(id, step, bot, parent, localParams, callback)
+		if err != nil {
+			logger.Error("Default runbook %s rollback step %s failed: %s", dr.name, id, err)
+			return false
+		}
+		return true
+	}
+
+	for _, c := range completed {
+		if strings.HasPrefix(c, prefix) {
+			continue
+		}
+		compensated := false
+		for _, step := range dr.config.Rollback {
+			if step.Disabled || utils.IsEmpty(step.ID) || !dr.rollbackMatches(step, c) {
+				continue
+			}
+			compensated = run(fmt.Sprintf("%s%s", prefix, c), step) || compensated
+		}
+		// step which is compensated should be done again on resume
+		if compensated {
+			dr.setRunStep(c, common.RunbookStatusRolledBack, "", nil)
+		}
+	}
+
+	for i, step := range dr.config.Rollback {
+		if step.Disabled || !utils.IsEmpty(step.ID) {
+			continue
+		}
+		run(fmt.Sprintf("%s%d", prefix, i), step)
+	}
+}
+
+// foreachItems renders foreach template into a list, either JSON array or lines/comma separated values
+func (dr *DefaultRunbook) foreachItems(step *DefaultRunbookStep, params map[string]interface{}) []interface{} {
+
+	s := strings.TrimSpace(common.Render(step.Foreach, params, dr.command.processor.observability))
+	if utils.IsEmpty(s) {
 		return nil
 	}
 
+	var items []interface{}
+	if json.Unmarshal([]byte(s), &items) == nil {
+		return items
+	}
+
+	items = []interface{}{}
+	for _, v := range strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == ',' }) {
+		v = strings.TrimSpace(v)
+		if utils.IsEmpty(v) {
+			continue
+		}
+		items = append(items, v)
+	}
+	return items
+}
+
+// runForeach expands step into a child step per item, item and index are available in params
+func (dr *DefaultRunbook) runForeach(id string, step *DefaultRunbookStep, bot common.Bot, parent common.Message, params map[string]interface{},
+	callback DefaultRunbookStepResultFunc) error {
+
+	localParams := make(map[string]any)
+	maps.Copy(localParams, params)
+	localParams["steps"] = dr.stepResults()
+
+	items := dr.foreachItems(step, localParams)
+	if len(items) == 0 {
+		dr.command.logger.Debug("Default runbook %s step %s has no items", dr.name, id)
+		dr.setRunStep(id, common.RunbookStatusSkipped, "", nil)
+		return nil
+	}
+	dr.setRunStep(id, common.RunbookStatusRunning, "", nil)
+
+	ids := []string{}
+	for i := range items {
+		ids = append(ids, fmt.Sprintf("%s-%d", id, i))
+	}
+	if dr.progress != nil {
+		dr.progress.addItems(ids)
+	}
+
 	g := &errgroup.Group{}
+	if step.Concurrency > 0 {
+		g.SetLimit(step.Concurrency)
+	}
+
+	for i, item := range items {
+
+		child := *step
+		child.Foreach = ""
+		if !utils.IsEmpty(step.ID) {
+			child.ID = fmt.Sprintf("%s-%d", step.ID, i)
+		}
+		id1 := ids[i]
+		dr.items.Store(id1, id)
+
+		itemParams := make(map[string]any)
+		maps.Copy(itemParams, params)
+		itemParams["item"] = item
+		itemParams["index"] = i
+
+		g.Go(func() error {
+			return dr.runStep(id1, &child, bot, parent, itemParams, callback)
+		})
+	}
+	err := g.Wait()
+
+	// results of all items are available as .steps.<id>.items
+	results := dr.stepResults()
+	list := []interface{}{}
+	for _, v := range ids {
+		list = append(list, results[v])
+	}
+	r := map[string]interface{}{"id": id, "items": list}
+	dr.steps.Store(id, r)
+	if !utils.IsEmpty(step.ID) && step.ID != id {
+		dr.steps.Store(step.ID, r)
+	}
+
+	if err != nil {
+		dr.setRunStep(id, common.RunbookStatusFailed, "", err)
+		return err
+	}
+	dr.setRunStep(id, common.RunbookStatusDone, "", nil)
+	return nil
+}
+
+func (dr *DefaultRunbook) runStep(id string, step *DefaultRunbookStep, bot common.Bot, parent common.Message, params map[string]interface{},
+	callback DefaultRunbookStepResultFunc) error {
+
+	logger := dr.command.logger
+
+	if dr.stepContext().Err() != nil {
+		err := dr.cancelled(id)
+		dr.setRunStep(id, common.RunbookStatusFailed, "", err)
+		return err
+	}
+
+	if !utils.IsEmpty(step.Foreach) {
+		return dr.runForeach(id, step, bot, parent, params, callback)
+	}
+
+	status, finished := dr.stepFinished(id, step)
+	if finished {
+		logger.Debug("Default runbook %s step %s is already %s", dr.name, id, status)
+		if status != common.RunbookStatusDone {
+			return nil
+		}
+		dr.stepCompleted(id)
+		return dr.runPipeline(id, step.Mode, step.Pipeline, bot, parent, params, callback)
+	}
+
+	localParams := make(map[string]any)
+	maps.Copy(localParams, params)
+	localParams["steps"] = dr.stepResults()
+
+	if !dr.stepAllowed(step, localParams) {
+		logger.Debug("Default runbook %s step %s skipped by condition", dr.name, id)
+		dr.setRunStep(id, common.RunbookStatusSkipped, "", nil)
+		return nil
+	}
+
+	// rejected step stops the pipeline even if errors are allowed
+	err := dr.waitApproval(id, step, bot, parent, localParams)
+	if err != nil {
+		dr.setRunStep(id, common.RunbookStatusFailed, "", err)
+		return err
+	}
+
+	dr.setRunStep(id, common.RunbookStatusRunning, "", nil)
+
+	r1, posts, err := dr.executeStep(id, step, bot, parent, localParams)
+	dr.setStepResult(id, step, r1, err)
+	if err != nil {
+		dr.setRunStep(id, common.RunbookStatusFailed, "", err)
+		if step.ContinueOnError {
+			logger.Warn("Default runbook %s step %s failed, continue: %s", dr.name, id, err)
+			return nil
+		}
+		return err
+	}
+
+	text := ""
+	if r1 != nil {
+		text = r1.Text
+	}
+	dr.setRunStep(id, common.RunbookStatusDone, text, nil)
+	dr.stepCompleted(id)
+
+	// progress shows the step instead of posting its result
+	if r1 != nil && dr.progress == nil {
+		r1.ID = id
+		err = callback(r1, parent)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(posts) > 0 {
+		err = dr.parentExecutor.after(posts, parent, false, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return dr.runPipeline(id, step.Mode, step.Pipeline, bot, parent, localParams, callback)
+}
+
+func (dr *DefaultRunbook) runPipeline(id, mode string, pl []*DefaultRunbookStep, bot common.Bot, parent common.Message, params map[string]interface{},
+	callback DefaultRunbookStepResultFunc) error {
+
+	if dr.countPipelineSteps(pl) == 0 {
+		return nil
+	}
+
+	ids := []string{}
+	steps := []*DefaultRunbookStep{}
 
 	for i, step := range pl {
 
@@ -1767,52 +2602,88 @@ func (dr *DefaultRunbook) runPipeline(id string, pl []*DefaultRunbookStep, bot c
 		if step.Disabled {
 			continue
 		}
+		ids = append(ids, id1)
+		steps = append(steps, step)
+	}
 
-		g.Go(func() error {
-			localParams := make(map[string]any)
-
-			maps.Copy(localParams, params)
+	if mode == DefaultRunbookModeSequential {
 
-			executor, err := NewRunbookExecutor(dr, step, bot, parent, localParams)
+		for i, step := range steps {
+			err := dr.runStep(ids[i], step, bot, parent, params, callback)
 			if err != nil {
 				return err
 			}
-			if executor == nil {
-				return nil
-			}
+		}
+		return nil
+	}
 
-			r1 := executor.execute(id1, localParams, parent)
-			if r1 != nil && r1.Error != nil {
-				return r1.Error
-			}
-			if r1 == nil {
-				return nil
-			}
+	g := &errgroup.Group{}
 
-			r1.ID = id1
-			err = callback(r1, parent)
-			if err != nil {
-				return err
-			}
+	for i, step := range steps {
+		g.Go(func() error {
+			return dr.runStep(ids[i], step, bot, parent, params, callback)
+		})
+	}
+	return g.Wait()
+}
+
+func (dr *DefaultRunbook) execute(bot common.Bot, message common.Message, params map[string]interface{}, callback DefaultRunbookStepResultFunc, waitGroup bool) error {
+
+	runs := dr.command.processor.runs
+	if dr.run != nil && !runs.Acquire(dr.run.ID) {
+		return fmt.Errorf("Runbook %s run %s is already running", dr.name, dr.run.ID)
+	}
+
+	// runbook in background keeps command of the message running, so it can be cancelled
+	dr.ctx = common.MessageContext(message)
+	release := common.MessageHold(message)
+
+	process := func() error {
+
+		defer release()
+		if dr.run != nil {
+			defer runs.Release(dr.run.ID)
+		}
+
+		dr.updateRun(func(run *common.RunbookRun) {
+			run.Status = common.RunbookStatusRunning
+			run.Error = ""
+			run.Finished = nil
+		})
 
-			posts := executor.loadPosts()
-			if len(posts) > 0 {
-				err = dr.parentExecutor.after(posts, parent, false, false)
+		if dr.config.Progress {
+			progress := NewRunbookProgress(dr, bot, message)
+			if progress != nil {
+				err := progress.start(message)
 				if err != nil {
-					return err
+					dr.command.logger.Error("Default runbook %s couldn't post progress: %s", dr.name, err)
+				} else {
+					dr.progress = progress
 				}
 			}
+		}
 
-			err = dr.runPipeline(id1, step.Pipeline, bot, parent, localParams, callback, true)
-			if err != nil {
-				return err
-			}
-			return nil
-		})
+		err := dr.runPipeline("", dr.config.Mode, dr.config.Pipeline, bot, message, params, callback)
+		if err != nil {
+			dr.rollback(bot, message, params, callback, err)
+		}
+		if dr.progress != nil {
+			dr.progress.finish(err)
+		}
+		dr.finishRun(bot, err)
+		return err
 	}
+
 	if waitGroup {
-		return g.Wait()
+		return process()
 	}
+
+	go func() {
+		err := process()
+		if err != nil {
+			dr.command.logger.Error("Default runbook %s failed: %s", dr.name, err)
+		}
+	}()
 	return nil
 }
 
@@ -1829,7 +2700,29 @@ func (dr *DefaultRunbook) Execute(bot common.Bot, message common.Message, obj in
 	if ok {
 		params = ps
 	}
-	return dr.runPipeline("", dr.config.Pipeline, bot, message, params, callback, waitGroup)
+
+	dr.newRun(bot, message, params)
+	return dr.execute(bot, message, params, callback, waitGroup)
+}
+
+// Resume continues the run from the first step which didn't finish
+func (dr *DefaultRunbook) Resume(run *common.RunbookRun, bot common.Bot, message common.Message, callback DefaultRunbookStepResultFunc) error {
+
+	dr.command.logger.Debug("Default is resuming runbook %s run %s...", dr.name, run.ID)
+
+	params := make(common.ExecuteParams)
+	maps.Copy(params, run.Params)
+
+	params["bot"] = bot
+	if !utils.IsEmpty(message) {
+		params["message"] = message
+		params["user"] = message.User()
+		params["caller"] = message.Caller()
+		params["channel"] = message.Channel()
+	}
+
+	dr.run = run
+	return dr.execute(bot, message, params, callback, true)
 }
 
 func NewRunbook(name, path string, command *DefaultCommand, parentExecutor *DefaultExecutor) (*DefaultRunbook, error) {
@@ -1855,6 +2748,8 @@ func NewRunbook(name, path string, command *DefaultCommand, parentExecutor *Defa
 		command:        command,
 		config:         &config,
 		parentExecutor: parentExecutor,
+		steps:          &sync.Map{},
+		items:          &sync.Map{},
 	}
 	return rb, nil
 }
@@ -2051,6 +2946,50 @@ func (dca *DefaultCommandApproval) Message(bot common.Bot, message common.Messag
 	return string(b)
 }
 
+// DefaultRunbookApproval
+
+// approval channel and template can be either a file in templates dir or an inline template
+func (dra *DefaultRunbookApproval) render(value string, params common.ExecuteParams) string {
+
+	if utils.IsEmpty(value) {
+		return ""
+	}
+
+	content := value
+	command := dra.runbook.command
+	path := filepath.Join(command.processor.options.TemplatesDir, value)
+
+	if !utils.IsEmpty(command.processor.options.TemplatesDir) && utils.FileExists(path) {
+		data, err := utils.Content(path)
+		if err != nil {
+			command.logger.Error("Default runbook %s approval template %s error: %s", dra.runbook.name, path, err)
+			return ""
+		}
+		content = string(data)
+	}
+	return common.Render(content, params, command.processor.observability)
+}
+
+func (dra *DefaultRunbookApproval) Channel(bot common.Bot, message common.Message, params common.ExecuteParams) string {
+	return dra.render(dra.approval.Channel, params)
+}
+
+func (dra *DefaultRunbookApproval) Message(bot common.Bot, message common.Message, params common.ExecuteParams) string {
+	return dra.render(dra.approval.Template, params)
+}
+
+func (dra *DefaultRunbookApproval) Reasons() []string {
+	return dra.approval.Reasons
+}
+
+func (dra *DefaultRunbookApproval) Description() bool {
+	return dra.approval.Description
+}
+
+func (dra *DefaultRunbookApproval) Visible() bool {
+	return dra.approval.Visible
+}
+
 // DefaultCommandAction
 
 func (dca *DefaultCommandAction) Name() string {
@@ -2076,7 +3015,7 @@ func (dc *DefaultCommand) Name() string {
 }
 
 func (dc *DefaultCommand) Group() string {
-	if dc.processor == nil {
+	if dc.processor != nil {
 		return dc.processor.name
 	}
 	return ""
@@ -2368,10 +3307,48 @@ func (dc *DefaultCommand) Response() common.Response {
 	}
 }
 
+func (dc *DefaultCommand) resumeRunbook(name string, bot common.Bot, message common.Message, params common.ExecuteParams, action common.Action) (common.Executor, string, []*common.Attachment, []common.Action, error) {
+
+	runs := dc.processor.runs
+	if runs == nil {
+		return nil, "", nil, nil, fmt.Errorf("Runbook runs are not tracked")
+	}
+
+	run := runs.Get(action.Template())
+	if run == nil {
+		return nil, "", nil, nil, fmt.Errorf("Runbook run %s is not found", action.Template())
+	}
+
+	executor, err := NewExecutor(name, dc.path, dc, bot, message, params, action)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+
+	if run.Status == common.RunbookStatusDone {
+		return executor, fmt.Sprintf("Runbook %s run %s is already done", run.Name, run.ID), nil, nil, nil
+	}
+
+	rb, err := NewRunbook(run.Name, run.Path, dc, executor)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+
+	err = rb.Resume(run, bot, message, executor.runbookAfterCallback)
+	if err != nil {
+		dc.logger.Error("Default couldn't resume runbook %s run %s: %s", run.Name, run.ID, err)
+		return nil, "", nil, nil, err
+	}
+	return executor, "", nil, nil, nil
+}
+
 func (dc *DefaultCommand) Execute(bot common.Bot, message common.Message, params common.ExecuteParams, action common.Action) (common.Executor, string, []*common.Attachment, []common.Action, error) {
 
 	name := dc.getNameWithGroup("-")
 
+	if action != nil && action.Name() == DefaultRunbookResumeAction {
+		return dc.resumeRunbook(name, bot, message, params, action)
+	}
+
 	path := dc.path
 	if action != nil && !utils.IsEmpty(action.Template()) {
 		path = fmt.Sprintf("%s%s%s", dc.processor.options.TemplatesDir, string(os.PathSeparator), action.Template())
@@ -2587,7 +3564,8 @@ func (dca *DefaultCommandApproval) addTemplateFunctions(funcs map[string]any, bo
 	funcs["isEmpty"] = utils.IsEmpty
 }
 
-func NewDefault(name string, options DefaultOptions, observability *common.Observability, processors *common.Processors) *Default {
+func NewDefault(name string, options DefaultOptions, observability *common.Observability, processors *common.Processors,
+	runs *common.RunbookStore) *Default {
 
 	return &Default{
 		name:          name,
@@ -2595,5 +3573,6 @@ func NewDefault(name string, options DefaultOptions, observability *common.Obser
 		processors:    processors,
 		meter:         observability.Metrics(),
 		observability: observability,
+		runs:          runs,
 	}
 }
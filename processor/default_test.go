@@ -0,0 +1,19 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/devopsext/chatops/common"
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultCommandGroup(t *testing.T) {
+
+	obs := common.NewObservability(sreCommon.NewLogs(), sreCommon.NewMetrics())
+	processor := NewDefault("k8s", DefaultOptions{}, obs, common.NewProcessors(), nil)
+
+	require.Equal(t, "k8s", (&DefaultCommand{name: "pods", processor: processor}).Group())
+	// command without processor used to dereference it
+	require.Empty(t, (&DefaultCommand{name: "pods"}).Group())
+}
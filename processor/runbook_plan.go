@@ -0,0 +1,286 @@
+package processor
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/devopsext/chatops/common"
+	"github.com/devopsext/utils"
+)
+
+// DefaultDryRunBot wraps bot and records everything which would change chats instead of doing it
+type DefaultDryRunBot struct {
+	common.Bot
+	calls []string
+	lock  sync.Mutex
+}
+
+const DefaultRunbookDryRunParam = "dryRun"
+
+func (db *DefaultDryRunBot) record(format string, args ...interface{}) {
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.calls = append(db.calls, fmt.Sprintf(format, args...))
+}
+
+func (db *DefaultDryRunBot) flush() []string {
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	r := db.calls
+	db.calls = nil
+	return r
+}
+
+func (db *DefaultDryRunBot) Command(channel, text string, params common.ExecuteParams, user common.User, parent common.Message, response common.Response) (common.Message, error) {
+	db.record("command `%s` in %s", text, channel)
+	return nil, nil
+}
+
+func (db *DefaultDryRunBot) PostMessage(channel string, message string, attachments []*common.Attachment, actions []common.Action,
+	user common.User, parent common.Message, response common.Response) (string, error) {
+	db.record("post to %s: %s", channel, message)
+	return "", nil
+}
+
+func (db *DefaultDryRunBot) DeleteMessage(channel, ID string) error {
+	db.record("delete message %s in %s", ID, channel)
+	return nil
+}
+
+func (db *DefaultDryRunBot) UpdateMessage(channel, ID, message string) error {
+	db.record("update message %s in %s: %s", ID, channel, message)
+	return nil
+}
+
+func (db *DefaultDryRunBot) SendImage(channelID, threadTS string, fileContent []byte, filename, initialComment string) error {
+	db.record("send image %s to %s", filename, channelID)
+	return nil
+}
+
+func (db *DefaultDryRunBot) AskApproval(channel, message string, approval common.Approval, user common.User, parent common.Message, callback common.ApprovalFunc) (string, error) {
+	db.record("ask approval in %s", channel)
+	return "", nil
+}
+
+func (db *DefaultDryRunBot) PendingApprovals() []*common.PendingApproval {
+	return []*common.PendingApproval{}
+}
+
+func (db *DefaultDryRunBot) Approve(messageID string, approved bool, user common.User, reason string) error {
+	db.record("approve %s: %t", messageID, approved)
+	return nil
+}
+
+func (db *DefaultDryRunBot) Cancel(messageID string, user common.User) error {
+	db.record("cancel %s", messageID)
+	return nil
+}
+
+func (db *DefaultDryRunBot) AddReaction(channel, ID, name string) error                   { return nil }
+func (db *DefaultDryRunBot) RemoveReaction(channel, ID, name string) error                { return nil }
+func (db *DefaultDryRunBot) AddAction(channel, ID string, action common.Action) error     { return nil }
+func (db *DefaultDryRunBot) AddActions(channel, ID string, actions []common.Action) error { return nil }
+func (db *DefaultDryRunBot) RemoveAction(channel, ID, name string) error                  { return nil }
+func (db *DefaultDryRunBot) ClearActions(channel, ID string) error                        { return nil }
+func (db *DefaultDryRunBot) TagMessage(channel, ID string, tags map[string]string) error  { return nil }
+func (db *DefaultDryRunBot) AddDivider(channel, ID string) error                          { return nil }
+
+func NewDryRunBot(bot common.Bot) *DefaultDryRunBot {
+
+	if db, ok := bot.(*DefaultDryRunBot); ok {
+		return db
+	}
+	return &DefaultDryRunBot{Bot: bot}
+}
+
+// runbookDryRun is true if it's requested by runbook params, command params or runbook is already planned
+func runbookDryRun(bot common.Bot, values ...map[string]interface{}) bool {
+
+	if _, ok := bot.(*DefaultDryRunBot); ok {
+		return true
+	}
+	for _, m := range values {
+		switch v := m[DefaultRunbookDryRunParam].(type) {
+		case bool:
+			if v {
+				return true
+			}
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil && b {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (dr *DefaultRunbook) planMode(mode string) string {
+
+	if mode == DefaultRunbookModeSequential {
+		return mode
+	}
+	return DefaultRunbookModeParallel
+}
+
+func (dr *DefaultRunbook) planIndent(lines []string, indent string) []string {
+
+	r := []string{}
+	for _, l := range lines {
+		for _, s := range strings.Split(l, "\n") {
+			r = append(r, fmt.Sprintf("%s%s", indent, s))
+		}
+	}
+	return r
+}
+
+func (dr *DefaultRunbook) planOptions(step *DefaultRunbookStep) string {
+
+	options := []string{}
+	if step.Retries > 0 {
+		options = append(options, fmt.Sprintf("retries %d", step.Retries))
+	}
+	if !utils.IsEmpty(step.Backoff) {
+		options = append(options, fmt.Sprintf("backoff %s", step.Backoff))
+	}
+	if !utils.IsEmpty(step.Timeout) {
+		options = append(options, fmt.Sprintf("timeout %s", step.Timeout))
+	}
+	if step.ContinueOnError {
+		options = append(options, "continue on error")
+	}
+	if step.Approval != nil && !step.Approval.Disabled {
+		options = append(options, "approval")
+	}
+	if step.Concurrency > 0 {
+		options = append(options, fmt.Sprintf("concurrency %d", step.Concurrency))
+	}
+	if len(step.Pipeline) > 0 {
+		options = append(options, dr.planMode(step.Mode))
+	}
+	return strings.Join(options, ", ")
+}
+
+func (dr *DefaultRunbook) planStep(id string, step *DefaultRunbookStep, bot *DefaultDryRunBot, parent common.Message, params map[string]interface{}) []string {
+
+	header := []string{fmt.Sprintf("• *%s*", id)}
+	if options := dr.planOptions(step); !utils.IsEmpty(options) {
+		header = append(header, options)
+	}
+
+	// results of previous steps are unknown, so conditions might depend on empty values
+	if !utils.IsEmpty(step.When) {
+		allowed := dr.stepAllowed(step, params)
+		header = append(header, fmt.Sprintf("when `%s` → %v", strings.TrimSpace(step.When), allowed))
+		if !allowed {
+			return []string{strings.Join(header, " · ")}
+		}
+	}
+
+	lines := []string{strings.Join(header, " · ")}
+	details := []string{}
+
+	if !utils.IsEmpty(step.Foreach) {
+
+		items := dr.foreachItems(step, params)
+		if len(items) == 0 {
+			return append(lines, "    no items")
+		}
+		for i, item := range items {
+
+			child := *step
+			child.Foreach = ""
+			child.Concurrency = 0
+
+			itemParams := make(map[string]any)
+			maps.Copy(itemParams, params)
+			itemParams["item"] = item
+			itemParams["index"] = i
+
+			details = append(details, dr.planStep(fmt.Sprintf("%s-%d", id, i), &child, bot, parent, itemParams)...)
+		}
+		return append(lines, dr.planIndent(details, "    ")...)
+	}
+
+	executor, err := NewRunbookExecutor(dr.stepContext(), dr, step, bot, parent, params)
+	if err != nil {
+		details = append(details, fmt.Sprintf("error: %s", err))
+	}
+	if executor != nil {
+
+		if !utils.IsEmpty(executor.description) {
+			details = append(details, fmt.Sprintf("step: %s", executor.description))
+		}
+		if executor.commandExecutor != nil {
+			details = append(details, fmt.Sprintf("command: `%s`", executor.commandExecutor.command))
+		}
+		// template isn't executed, as its functions can do anything regardless of the bot, e.g. HTTP requests
+		if executor.templateExecutor != nil {
+			details = append(details, "template:")
+			details = append(details, dr.planIndent([]string{strings.TrimSpace(step.Template)}, "    ")...)
+		}
+	}
+
+	for _, c := range bot.flush() {
+		details = append(details, fmt.Sprintf("would %s", c))
+	}
+	lines = append(lines, dr.planIndent(details, "    ")...)
+
+	return append(lines, dr.planIndent(dr.planPipeline(id, step.Pipeline, bot, parent, params), "    ")...)
+}
+
+func (dr *DefaultRunbook) planPipeline(id string, pl []*DefaultRunbookStep, bot *DefaultDryRunBot, parent common.Message, params map[string]interface{}) []string {
+
+	lines := []string{}
+	for i, step := range pl {
+
+		if step.Disabled {
+			continue
+		}
+		id1 := strconv.Itoa(i)
+		if !utils.IsEmpty(step.ID) {
+			id1 = step.ID
+		}
+		if !utils.IsEmpty(id) {
+			id1 = fmt.Sprintf("%s.%s", id, id1)
+		}
+		lines = append(lines, dr.planStep(id1, step, bot, parent, params)...)
+	}
+	return lines
+}
+
+// Plan renders runbook steps and conditions with params and returns what would be done, templates are shown as they are,
+// nothing is posted or executed
+func (dr *DefaultRunbook) Plan(bot common.Bot, message common.Message, obj interface{}) string {
+
+	dr.command.logger.Debug("Default is planning runbook %s...", dr.name)
+
+	db := NewDryRunBot(bot)
+
+	params := make(common.ExecuteParams)
+	ps, ok := obj.(map[string]interface{})
+	if ok {
+		maps.Copy(params, ps)
+	}
+	delete(params, DefaultRunbookDryRunParam)
+	params["bot"] = db
+	params["steps"] = make(map[string]interface{})
+
+	lines := []string{fmt.Sprintf("*Runbook %s* dry run · %s", dr.name, dr.planMode(dr.config.Mode))}
+	if !utils.IsEmpty(dr.config.Description) {
+		lines = append(lines, dr.config.Description)
+	}
+	lines = append(lines, dr.planPipeline("", dr.config.Pipeline, db, message, params)...)
+
+	if dr.countPipelineSteps(dr.config.Rollback) > 0 {
+		lines = append(lines, "*Rollback*")
+		lines = append(lines, dr.planPipeline(DefaultRunbookRollbackID, dr.config.Rollback, db, message, params)...)
+	}
+	return strings.Join(lines, "\n")
+}
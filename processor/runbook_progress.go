@@ -0,0 +1,311 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devopsext/chatops/common"
+	"github.com/devopsext/utils"
+)
+
+type DefaultRunbookProgressStep struct {
+	ID       string
+	Depth    int
+	Status   common.RunbookStatus
+	Started  time.Time
+	Finished time.Time
+}
+
+// DefaultRunbookProgress keeps a single message with a checklist of runbook steps
+type DefaultRunbookProgress struct {
+	runbook  *DefaultRunbook
+	bot      common.Bot
+	channel  string
+	message  string
+	started  time.Time
+	finished time.Time
+	err      error
+	steps    []*DefaultRunbookProgressStep
+	timer    *time.Timer
+	lock     sync.Mutex
+}
+
+// steps change often, so message is updated at most once per delay
+const defaultRunbookProgressDelay = time.Second
+
+var defaultRunbookProgressIcons = map[common.RunbookStatus]string{
+	common.RunbookStatusPending:     "⚪",
+	common.RunbookStatusRunning:     "🔄",
+	common.RunbookStatusWaiting:     "✋",
+	common.RunbookStatusDone:        "✅",
+	common.RunbookStatusFailed:      "❌",
+	common.RunbookStatusSkipped:     "⏭️",
+	common.RunbookStatusInterrupted: "⚠️",
+	common.RunbookStatusCancelled:   "🚫",
+	common.RunbookStatusRolledBack:  "↩️",
+}
+
+func (drp *DefaultRunbookProgress) find(id string) *DefaultRunbookProgressStep {
+
+	for _, s := range drp.steps {
+		if s.ID == id {
+			return s
+		}
+	}
+	return nil
+}
+
+// child IDs are either nested pipeline steps or foreach items
+func (drp *DefaultRunbookProgress) child(id, parent string) bool {
+	return strings.HasPrefix(id, fmt.Sprintf("%s.", parent)) || strings.HasPrefix(id, fmt.Sprintf("%s-", parent))
+}
+
+// add puts a step after its parent and parent's known children, so expanded steps stay in place
+func (drp *DefaultRunbookProgress) add(id string) *DefaultRunbookProgressStep {
+
+	s := &DefaultRunbookProgressStep{
+		ID:     id,
+		Status: common.RunbookStatusPending,
+	}
+
+	pos := len(drp.steps)
+	for i, v := range drp.steps {
+		if !drp.child(id, v.ID) {
+			continue
+		}
+		s.Depth = v.Depth + 1
+		pos = i + 1
+		for pos < len(drp.steps) && drp.child(drp.steps[pos].ID, v.ID) {
+			pos++
+		}
+	}
+
+	drp.steps = append(drp.steps[:pos], append([]*DefaultRunbookProgressStep{s}, drp.steps[pos:]...)...)
+	return s
+}
+
+func (drp *DefaultRunbookProgress) addPipeline(id string, pl []*DefaultRunbookStep) {
+
+	for i, step := range pl {
+		if step.Disabled {
+			continue
+		}
+		id1 := strconv.Itoa(i)
+		if !utils.IsEmpty(step.ID) {
+			id1 = step.ID
+		}
+		if !utils.IsEmpty(id) {
+			id1 = fmt.Sprintf("%s.%s", id, id1)
+		}
+		drp.add(id1)
+		drp.addPipeline(id1, step.Pipeline)
+	}
+}
+
+// addItems keeps foreach items in their order, whatever order they are started in
+func (drp *DefaultRunbookProgress) addItems(ids []string) {
+
+	drp.lock.Lock()
+	defer drp.lock.Unlock()
+
+	for _, id := range ids {
+		if drp.find(id) == nil {
+			drp.add(id)
+		}
+	}
+}
+
+func (drp *DefaultRunbookProgress) duration(started, finished time.Time) string {
+
+	if started.IsZero() {
+		return ""
+	}
+	if finished.IsZero() {
+		finished = time.Now()
+	}
+	return finished.Sub(started).Round(time.Millisecond).String()
+}
+
+func (drp *DefaultRunbookProgress) render() string {
+
+	icon := defaultRunbookProgressIcons[common.RunbookStatusRunning]
+	if !drp.finished.IsZero() {
+		icon = defaultRunbookProgressIcons[common.RunbookStatusDone]
+		if drp.err != nil {
+			icon = defaultRunbookProgressIcons[common.RunbookStatusFailed]
+		}
+		if errors.Is(drp.err, context.Canceled) {
+			icon = defaultRunbookProgressIcons[common.RunbookStatusCancelled]
+		}
+	}
+
+	lines := []string{fmt.Sprintf("%s *Runbook %s* %s", icon, drp.runbook.name, drp.duration(drp.started, drp.finished))}
+
+	for _, s := range drp.steps {
+
+		indent := strings.Repeat("    ", s.Depth)
+		items := []string{fmt.Sprintf("%s%s %s", indent, defaultRunbookProgressIcons[s.Status], s.ID)}
+
+		d := drp.duration(s.Started, s.Finished)
+		if !utils.IsEmpty(d) && s.Status != common.RunbookStatusSkipped {
+			items = append(items, d)
+		}
+		lines = append(lines, strings.Join(items, " · "))
+	}
+
+	if drp.err != nil {
+		lines = append(lines, drp.err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// flush should be called under lock, text of the message is replaced so cancel action is kept
+func (drp *DefaultRunbookProgress) flush() {
+
+	if utils.IsEmpty(drp.message) {
+		return
+	}
+
+	var err error
+	if tu, ok := drp.bot.(common.TextUpdater); ok {
+		err = tu.UpdateText(drp.channel, drp.message, drp.render())
+	} else {
+		err = drp.bot.UpdateMessage(drp.channel, drp.message, drp.render())
+	}
+	if err != nil {
+		drp.runbook.command.logger.Error("Default runbook %s couldn't update progress: %s", drp.runbook.name, err)
+	}
+}
+
+// update should be called under lock, changes until the delay passes are flushed together
+func (drp *DefaultRunbookProgress) update() {
+
+	if utils.IsEmpty(drp.message) || drp.timer != nil {
+		return
+	}
+	drp.timer = time.AfterFunc(defaultRunbookProgressDelay, func() {
+
+		drp.lock.Lock()
+		defer drp.lock.Unlock()
+
+		drp.timer = nil
+		// finished progress is flushed already
+		if drp.finished.IsZero() {
+			drp.flush()
+		}
+	})
+}
+
+func (drp *DefaultRunbookProgress) setStatus(id string, status common.RunbookStatus) {
+
+	drp.lock.Lock()
+	defer drp.lock.Unlock()
+
+	s := drp.find(id)
+	if s == nil {
+		s = drp.add(id)
+	}
+
+	now := time.Now()
+	s.Status = status
+	switch status {
+	case common.RunbookStatusRunning:
+		s.Started = now
+		s.Finished = time.Time{}
+	case common.RunbookStatusWaiting:
+	default:
+		s.Finished = now
+	}
+	drp.update()
+}
+
+func (drp *DefaultRunbookProgress) finish(err error) {
+
+	drp.lock.Lock()
+	defer drp.lock.Unlock()
+
+	drp.finished = time.Now()
+	drp.err = err
+	if drp.timer != nil {
+		drp.timer.Stop()
+		drp.timer = nil
+	}
+	drp.flush()
+
+	if utils.IsEmpty(drp.message) {
+		return
+	}
+	err = drp.bot.RemoveAction(drp.channel, drp.message, common.CancelActionName)
+	if err != nil {
+		drp.runbook.command.logger.Error("Default runbook %s couldn't remove cancel action: %s", drp.runbook.name, err)
+	}
+}
+
+func (drp *DefaultRunbookProgress) start(message common.Message) error {
+
+	drp.lock.Lock()
+	defer drp.lock.Unlock()
+
+	drp.started = time.Now()
+	drp.addPipeline("", drp.runbook.config.Pipeline)
+
+	// resumed run shows steps which are already finished
+	if drp.runbook.run != nil {
+		for _, s := range drp.steps {
+			rs, ok := drp.runbook.run.Steps[s.ID]
+			if !ok || rs == nil {
+				continue
+			}
+			s.Status = rs.Status
+			if rs.Started != nil {
+				s.Started = *rs.Started
+			}
+			if rs.Finished != nil {
+				s.Finished = *rs.Finished
+			}
+		}
+	}
+
+	var user common.User
+	var response common.Response
+
+	if !utils.IsEmpty(message) {
+		user = message.User()
+	}
+	if !utils.IsEmpty(drp.runbook.parentExecutor) {
+		response = drp.runbook.parentExecutor.Response()
+	}
+
+	// bot cancels command of the message itself, runbook stops as its context is done
+	cancel := &DefaultCommandAction{
+		command: drp.runbook.command,
+		name:    common.CancelActionName,
+		label:   "Cancel",
+		style:   "danger",
+	}
+
+	id, err := drp.bot.PostMessage(drp.channel, drp.render(), nil, []common.Action{cancel}, user, message, response)
+	if err != nil {
+		return err
+	}
+	drp.message = id
+	return nil
+}
+
+func NewRunbookProgress(rb *DefaultRunbook, bot common.Bot, message common.Message) *DefaultRunbookProgress {
+
+	if utils.IsEmpty(bot) || utils.IsEmpty(message) || utils.IsEmpty(message.Channel()) {
+		return nil
+	}
+
+	return &DefaultRunbookProgress{
+		runbook: rb,
+		bot:     bot,
+		channel: message.Channel().ID(),
+	}
+}
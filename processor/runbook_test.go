@@ -0,0 +1,784 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devopsext/chatops/common"
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/stretchr/testify/require"
+)
+
+// testMessage implements common.Message for testing
+type testMessage struct {
+	id      string
+	channel string
+	user    common.User
+}
+
+func (m *testMessage) ID() string              { return m.id }
+func (m *testMessage) Visible() bool           { return true }
+func (m *testMessage) User() common.User       { return m.user }
+func (m *testMessage) Caller() common.User     { return m.user }
+func (m *testMessage) Channel() common.Channel { return &testChannel{id: m.channel} }
+func (m *testMessage) ParentID() string        { return "" }
+func (m *testMessage) SetParentID(ts string)   {}
+
+// testRunMessage is a message which command can be cancelled
+type testRunMessage struct {
+	testMessage
+	run *common.MessageRun
+}
+
+func (m *testRunMessage) Context() context.Context { return m.run.Context() }
+func (m *testRunMessage) Hold() func()             { return m.run.Hold() }
+
+type testChannel struct {
+	id string
+}
+
+func (c *testChannel) ID() string { return c.id }
+
+// testBot implements common.Bot and records commands and posts
+type testBot struct {
+	mu           sync.Mutex
+	commands     []string
+	posts        []string
+	removed      []string
+	approvals    []string
+	cancelled    []string
+	updates      map[string]string
+	updated      int
+	failCommands int
+	reject       bool
+	pending      bool // approvals aren't decided
+	delay        time.Duration
+}
+
+func (b *testBot) Start(wg *sync.WaitGroup)                                     {}
+func (b *testBot) Stop()                                                        {}
+func (b *testBot) Name() string                                                 { return "test" }
+func (b *testBot) LookupUser(identifier string) common.User                     { return nil }
+func (b *testBot) GetMessageStatus(ID string) (common.MessageStatus, error)     { return "", nil }
+func (b *testBot) GetMessageResult(ID string) (*common.MessageResult, error)    { return nil, nil }
+func (b *testBot) AddReaction(channel, ID, name string) error                   { return nil }
+func (b *testBot) RemoveReaction(channel, ID, name string) error                { return nil }
+func (b *testBot) AddAction(channel, ID string, action common.Action) error     { return nil }
+func (b *testBot) AddActions(channel, ID string, actions []common.Action) error { return nil }
+func (b *testBot) ClearActions(channel, ID string) error                        { return nil }
+func (b *testBot) DeleteMessage(channel, ID string) error                       { return nil }
+func (b *testBot) ReadMessage(channel, ID, threadID string) (string, error)     { return "", nil }
+func (b *testBot) ReadThread(channel, threadID string) ([]string, error)        { return nil, nil }
+func (b *testBot) TagMessage(channel, ID string, tags map[string]string) error  { return nil }
+func (b *testBot) FindMessagesByTag(tagKey, tagValue string) map[string]string  { return nil }
+func (b *testBot) AddDivider(channel, ID string) error                          { return nil }
+func (b *testBot) SendImage(channelID, threadTS string, fileContent []byte, filename, initialComment string) error {
+	return nil
+}
+
+func (b *testBot) RemoveAction(channel, ID, name string) error {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.removed = append(b.removed, name)
+	return nil
+}
+
+func (b *testBot) AskApproval(channel, message string, approval common.Approval, user common.User, parent common.Message, callback common.ApprovalFunc) (string, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.approvals = append(b.approvals, fmt.Sprintf("%s:%s", channel, message))
+	if !b.pending {
+		go callback(!b.reject, common.NewGenericUser("U2", "approver", "UTC", nil), "")
+	}
+	return fmt.Sprintf("a%d", len(b.approvals)), nil
+}
+
+func (b *testBot) PendingApprovals() []*common.PendingApproval { return nil }
+func (b *testBot) Approve(messageID string, approved bool, user common.User, reason string) error {
+	return common.ErrApprovalNotFound
+}
+
+func (b *testBot) Cancel(messageID string, user common.User) error {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.cancelled = append(b.cancelled, messageID)
+	return nil
+}
+
+func (b *testBot) UpdateMessage(channel, ID, message string) error {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.updates == nil {
+		b.updates = make(map[string]string)
+	}
+	b.updates[ID] = message
+	b.updated++
+	return nil
+}
+
+func (b *testBot) Command(channel, text string, params common.ExecuteParams, user common.User, parent common.Message, response common.Response) (common.Message, error) {
+
+	// command ignores context of the step, as bots do
+	if b.delay > 0 {
+		time.Sleep(b.delay)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.commands = append(b.commands, text)
+	if b.failCommands > 0 {
+		b.failCommands--
+		return nil, fmt.Errorf("command %s failed", text)
+	}
+	return &testMessage{id: common.UUID(), channel: channel}, nil
+}
+
+func (b *testBot) PostMessage(channel string, message string, attachments []*common.Attachment, actions []common.Action,
+	user common.User, parent common.Message, response common.Response) (string, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.posts = append(b.posts, message)
+	return fmt.Sprintf("m%d", len(b.posts)), nil
+}
+
+type testResults struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (r *testResults) callback(result *DefaultRunbookStepResult, parent common.Message) error {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids = append(r.ids, fmt.Sprintf("%s=%s", result.ID, result.Text))
+	return nil
+}
+
+func testRunbook(t *testing.T, content string) (*DefaultRunbook, *testBot, common.Message) {
+	return testRunbookWithStore(t, content, nil)
+}
+
+func testRunbookWithStore(t *testing.T, content string, runs *common.RunbookStore) (*DefaultRunbook, *testBot, common.Message) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.yml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	obs := common.NewObservability(sreCommon.NewLogs(), sreCommon.NewMetrics())
+	processor := NewDefault("", DefaultOptions{RunbooksDir: dir}, obs, common.NewProcessors(), runs)
+
+	command := &DefaultCommand{
+		name:      "test",
+		processor: processor,
+		logger:    obs.Logs(),
+	}
+
+	bot := &testBot{}
+	message := &testMessage{
+		id:      "1",
+		channel: "C1",
+		user:    common.NewGenericUser("U1", "user", "UTC", nil),
+	}
+
+	parent := &DefaultExecutor{
+		name:        "test",
+		command:     command,
+		attachments: &sync.Map{},
+		actions:     &sync.Map{},
+		posts:       &sync.Map{},
+		bot:         bot,
+		message:     message,
+	}
+
+	rb, err := NewRunbook("test", path, command, parent)
+	require.NoError(t, err)
+	return rb, bot, message
+}
+
+func TestRunbookSequentialMode(t *testing.T) {
+
+	rb, bot, message := testRunbook(t, `
+mode: sequential
+pipeline:
+  - id: first
+    template: "one"
+  - id: second
+    template: "two"
+  - id: third
+    template: "three"
+`)
+
+	results := &testResults{}
+	err := rb.Execute(bot, message, nil, results.callback, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"first=one", "second=two", "third=three"}, results.ids)
+}
+
+func TestRunbookWhenCondition(t *testing.T) {
+
+	rb, bot, message := testRunbook(t, `
+mode: sequential
+pipeline:
+  - id: prod
+    when: '{{ eq .env "prod" }}'
+    template: "prod"
+  - id: staging
+    when: '{{ eq .env "staging" }}'
+    template: "staging"
+  - id: always
+    template: "always"
+`)
+
+	results := &testResults{}
+	err := rb.Execute(bot, message, map[string]interface{}{"env": "staging"}, results.callback, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"staging=staging", "always=always"}, results.ids)
+}
+
+func TestRunbookRetries(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		failures int
+		retries  int
+		wantErr  bool
+		commands int
+	}{
+		{name: "succeeds after retries", failures: 2, retries: 2, wantErr: false, commands: 3},
+		{name: "fails when retries exhausted", failures: 3, retries: 1, wantErr: true, commands: 2},
+		{name: "no retries", failures: 0, retries: 0, wantErr: false, commands: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			rb, bot, message := testRunbook(t, fmt.Sprintf(`
+pipeline:
+  - id: deploy
+    command: "deploy app"
+    retries: %d
+    backoff: 1ms
+`, tt.retries))
+			bot.failCommands = tt.failures
+
+			err := rb.Execute(bot, message, nil, (&testResults{}).callback, true)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Len(t, bot.commands, tt.commands)
+		})
+	}
+}
+
+func TestRunbookTimeoutAndContinueOnError(t *testing.T) {
+
+	rb, bot, message := testRunbook(t, `
+mode: sequential
+pipeline:
+  - id: slow
+    command: "slow"
+    timeout: 10ms
+  - id: next
+    template: "next"
+`)
+	bot.delay = 100 * time.Millisecond
+
+	err := rb.Execute(bot, message, nil, (&testResults{}).callback, true)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "timed out")
+
+	// step which ignores its context doesn't hold the runbook, timed out attempts are abandoned
+	rb, bot, message = testRunbook(t, `
+pipeline:
+  - id: slow
+    command: "slow"
+    timeout: 10ms
+    retries: 2
+`)
+	bot.delay = time.Second
+
+	start := time.Now()
+	err = rb.Execute(bot, message, nil, (&testResults{}).callback, true)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "timed out")
+	require.Less(t, time.Since(start), bot.delay)
+	require.Eventually(t, func() bool {
+		bot.mu.Lock()
+		defer bot.mu.Unlock()
+		return len(bot.commands) == 3
+	}, 3*time.Second, 10*time.Millisecond, "abandoned attempts run until they return")
+
+	rb, bot, message = testRunbook(t, `
+mode: sequential
+pipeline:
+  - id: failing
+    command: "failing"
+    continueOnError: true
+  - id: next
+    template: "next"
+`)
+	bot.failCommands = 1
+
+	results := &testResults{}
+	err = rb.Execute(bot, message, nil, results.callback, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"next=next"}, results.ids)
+}
+
+func TestRunbookStepOutputs(t *testing.T) {
+
+	rb, bot, message := testRunbook(t, `
+mode: sequential
+pipeline:
+  - id: check
+    template: '{"replicas": 3, "status": "degraded"}'
+  - id: decide
+    when: '{{ eq .steps.check.json.status "degraded" }}'
+    template: 'scale to {{ .steps.check.json.replicas }}'
+  - id: group
+    mode: sequential
+    pipeline:
+      - id: inner
+        template: 'inner'
+      - id: report
+        template: '{{ .steps.inner.text }} after {{ .steps.decide.text }}'
+`)
+
+	results := &testResults{}
+	err := rb.Execute(bot, message, nil, results.callback, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`check={"replicas": 3, "status": "degraded"}`,
+		"decide=scale to 3",
+		"group.inner=inner",
+		"group.report=inner after scale to 3",
+	}, results.ids)
+}
+
+func TestRunbookResume(t *testing.T) {
+
+	runs, err := common.NewRunbookStore(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	rb, bot, message := testRunbookWithStore(t, `
+mode: sequential
+pipeline:
+  - id: prepare
+    template: "prepared"
+  - id: deploy
+    command: "deploy app"
+  - id: report
+    template: '{{ .steps.prepare.text }} and deployed {{ .app }}'
+`, runs)
+	bot.failCommands = 1
+
+	err = rb.Execute(bot, message, map[string]interface{}{"app": "api", "bot": bot}, (&testResults{}).callback, true)
+	require.Error(t, err)
+
+	run := runs.Get(rb.run.ID)
+	require.NotNil(t, run)
+	require.Equal(t, common.RunbookStatusFailed, run.Status)
+	require.Equal(t, common.RunbookStatusDone, run.Steps["prepare"].Status)
+	require.Equal(t, common.RunbookStatusFailed, run.Steps["deploy"].Status)
+	require.NotContains(t, run.Params, "bot")
+	require.Contains(t, bot.posts[0], run.ID)
+
+	resumed, err := NewRunbook(run.Name, run.Path, rb.command, rb.parentExecutor)
+	require.NoError(t, err)
+
+	results := &testResults{}
+	err = resumed.Resume(run, bot, message, results.callback)
+	require.NoError(t, err)
+	require.Equal(t, []string{"deploy=", "report=prepared and deployed api"}, results.ids)
+	require.Equal(t, []string{"deploy app", "deploy app"}, bot.commands)
+	require.Equal(t, []string{DefaultRunbookResumeAction}, bot.removed)
+
+	run = runs.Get(run.ID)
+	require.Equal(t, common.RunbookStatusDone, run.Status)
+	require.Equal(t, common.RunbookStatusDone, run.Steps["report"].Status)
+}
+
+func TestRunbookApproval(t *testing.T) {
+
+	content := `
+mode: sequential
+pipeline:
+  - id: check
+    template: "checked"
+  - id: restart
+    approval:
+      template: 'Restart {{ .app }} after {{ .steps.check.text }}?'
+    template: 'restarted by {{ .approval.approver }}'
+  - id: report
+    template: "reported"
+`
+
+	rb, bot, message := testRunbook(t, content)
+
+	results := &testResults{}
+	err := rb.Execute(bot, message, map[string]interface{}{"app": "api"}, results.callback, true)
+	require.NoError(t, err)
+	require.Equal(t, []string{"C1:Restart api after checked?"}, bot.approvals)
+	require.Equal(t, []string{"check=checked", "restart=restarted by approver", "report=reported"}, results.ids)
+
+	rb, bot, message = testRunbook(t, content)
+	bot.reject = true
+
+	results = &testResults{}
+	err = rb.Execute(bot, message, map[string]interface{}{"app": "api"}, results.callback, true)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "rejected by approver")
+	require.Equal(t, []string{"check=checked"}, results.ids)
+}
+
+func TestRunbookCancel(t *testing.T) {
+
+	rb, bot, message := testRunbook(t, `
+mode: sequential
+progress: true
+pipeline:
+  - id: check
+    template: "checked"
+  - id: deploy
+    command: "deploy app"
+  - id: report
+    template: "never"
+rollback:
+  - id: check
+    template: 'unchecked {{ isCancelled }}'
+`)
+	bot.delay = time.Second
+
+	run := common.NewMessageRun()
+	m := &testRunMessage{testMessage: *(message.(*testMessage)), run: run}
+	time.AfterFunc(100*time.Millisecond, func() { run.Cancel() })
+
+	results := &testResults{}
+	err := rb.Execute(bot, m, nil, results.callback, true)
+	require.Error(t, err)
+	require.True(t, errors.Is(err, context.Canceled))
+	require.Empty(t, results.ids, "progress shows steps instead of their posts")
+	require.False(t, run.Running())
+
+	// cancel action is removed once runbook is finished
+	progress := bot.updates["m1"]
+	require.True(t, strings.HasPrefix(progress, "🚫 *Runbook test*"))
+	require.Contains(t, progress, "↩️ check")
+	require.Contains(t, progress, "✅ rollback.check")
+	require.Equal(t, []string{common.CancelActionName}, bot.removed)
+}
+
+func TestRunbookCancelApproval(t *testing.T) {
+
+	rb, bot, message := testRunbook(t, `
+pipeline:
+  - id: restart
+    approval:
+      template: "Restart?"
+    template: "restarted"
+`)
+	bot.pending = true
+
+	run := common.NewMessageRun()
+	m := &testRunMessage{testMessage: *(message.(*testMessage)), run: run}
+
+	err := rb.Execute(bot, m, nil, (&testResults{}).callback, false)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		bot.mu.Lock()
+		defer bot.mu.Unlock()
+		return len(bot.approvals) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// runbook in background keeps command running
+	require.True(t, run.Running())
+	require.True(t, run.Cancel())
+
+	// approval which nobody waits for is cancelled too
+	require.Eventually(t, func() bool {
+		bot.mu.Lock()
+		defer bot.mu.Unlock()
+		return len(bot.cancelled) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"a1"}, bot.cancelled)
+}
+
+func TestRunbookApprovalTimeout(t *testing.T) {
+
+	rb, bot, message := testRunbook(t, `
+pipeline:
+  - id: restart
+    approval:
+      template: "Restart?"
+    approvalTimeout: 10ms
+    template: "restarted"
+`)
+	bot.pending = true
+
+	results := &testResults{}
+	err := rb.Execute(bot, message, nil, results.callback, true)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "approval expired")
+	require.Empty(t, results.ids)
+
+	// expired approval can't be decided anymore
+	require.Equal(t, []string{"a1"}, bot.cancelled)
+}
+
+func TestRunbookRollback(t *testing.T) {
+
+	rb, bot, message := testRunbook(t, `
+mode: sequential
+pipeline:
+  - id: scale
+    template: "scaled"
+  - id: config
+    template: "configured"
+  - id: deploy
+    command: "deploy app"
+  - id: notify
+    template: "notified"
+rollback:
+  - id: scale
+    template: "unscaled"
+  - id: config
+    template: 'restored after {{ .error }}'
+  - id: notify
+    template: "never"
+  - template: "cleaned"
+`)
+	bot.failCommands = 1
+
+	results := &testResults{}
+	err := rb.Execute(bot, message, nil, results.callback, true)
+	require.Error(t, err)
+	require.Equal(t, []string{
+		"scale=scaled",
+		"config=configured",
+		"rollback.config=restored after command deploy app failed",
+		"rollback.scale=unscaled",
+		"rollback.3=cleaned",
+	}, results.ids)
+}
+
+func TestRunbookRollbackForeach(t *testing.T) {
+
+	runs, err := common.NewRunbookStore(t.TempDir(), 0)
+	require.NoError(t, err)
+
+	rb, bot, message := testRunbookWithStore(t, `
+mode: sequential
+pipeline:
+  - id: scale
+    foreach: 'eu, us'
+    concurrency: 1
+    template: 'scaled {{ .item }}'
+  - id: notify
+    template: "notified"
+  - id: deploy
+    command: "deploy app"
+rollback:
+  - id: scale
+    template: "unscaled"
+`, runs)
+	bot.failCommands = 1
+
+	results := &testResults{}
+	err = rb.Execute(bot, message, nil, results.callback, true)
+	require.Error(t, err)
+	require.Equal(t, []string{
+		"scale-0=scaled eu",
+		"scale-1=scaled us",
+		"notify=notified",
+		"rollback.scale-1=unscaled",
+		"rollback.scale-0=unscaled",
+	}, results.ids)
+
+	// compensated steps are done again on resume, others are not
+	run := runs.Get(rb.run.ID)
+	require.Equal(t, common.RunbookStatusRolledBack, run.Steps["scale-0"].Status)
+	require.Equal(t, common.RunbookStatusDone, run.Steps["notify"].Status)
+
+	resumed, err := NewRunbook(run.Name, run.Path, rb.command, rb.parentExecutor)
+	require.NoError(t, err)
+
+	results = &testResults{}
+	err = resumed.Resume(run, bot, message, results.callback)
+	require.NoError(t, err)
+	require.Equal(t, []string{"scale-0=scaled eu", "scale-1=scaled us", "deploy="}, results.ids)
+}
+
+func TestRunbookForeach(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		foreach string
+		items   []string
+	}{
+		{name: "json array", foreach: `'["eu", "us"]'`, items: []string{"eu", "us"}},
+		{name: "comma separated", foreach: `'eu, us'`, items: []string{"eu", "us"}},
+		{name: "from params", foreach: `'{{ .clusters }}'`, items: []string{"a", "b", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			rb, bot, message := testRunbook(t, fmt.Sprintf(`
+mode: sequential
+pipeline:
+  - id: deploy
+    foreach: %s
+    concurrency: 1
+    template: 'deploy {{ .item }} {{ .index }}'
+  - id: report
+    template: '{{ len .steps.deploy.items }}'
+`, tt.foreach))
+
+			results := &testResults{}
+			err := rb.Execute(bot, message, map[string]interface{}{"clusters": "a\nb\nc"}, results.callback, true)
+			require.NoError(t, err)
+
+			expected := []string{}
+			for i, item := range tt.items {
+				expected = append(expected, fmt.Sprintf("deploy-%d=deploy %s %d", i, item, i))
+			}
+			expected = append(expected, fmt.Sprintf("report=%d", len(tt.items)))
+			require.Equal(t, expected, results.ids)
+		})
+	}
+}
+
+func TestRunbookProgress(t *testing.T) {
+
+	rb, bot, message := testRunbook(t, `
+mode: sequential
+progress: true
+pipeline:
+  - id: check
+    template: "checked"
+  - id: deploy
+    foreach: 'eu,us'
+    template: 'deployed {{ .item }}'
+  - id: skip
+    when: "false"
+    template: "never"
+`)
+
+	results := &testResults{}
+	err := rb.Execute(bot, message, nil, results.callback, true)
+	require.NoError(t, err)
+	require.Empty(t, results.ids, "progress shows steps instead of their posts")
+
+	// the only post is the progress message, it's updated once with the final state as updates are debounced
+	require.Len(t, bot.posts, 1)
+	require.Contains(t, bot.posts[0], "Runbook test")
+	require.Equal(t, 1, bot.updated)
+	progress := bot.updates["m1"]
+
+	lines := strings.Split(progress, "\n")
+	require.Len(t, lines, 6)
+	require.True(t, strings.HasPrefix(lines[0], "✅ *Runbook test*"))
+	require.True(t, strings.HasPrefix(lines[1], "✅ check"))
+	require.True(t, strings.HasPrefix(lines[2], "✅ deploy"))
+	require.True(t, strings.HasPrefix(lines[3], "    ✅ deploy-0"))
+	require.True(t, strings.HasPrefix(lines[4], "    ✅ deploy-1"))
+	require.Equal(t, "⏭️ skip", lines[5])
+}
+
+func TestRunbookPlan(t *testing.T) {
+
+	rb, bot, message := testRunbook(t, `
+mode: sequential
+pipeline:
+  - id: notify
+    template: '{{ sendMessage "deploying" "C2" }}notified {{ .env }}'
+  - id: deploy
+    foreach: 'eu,us'
+    command: 'deploy {{ .item }} {{ .env }}'
+  - id: check
+    when: '{{ eq .env "dev" }}'
+    command: "check"
+rollback:
+  - id: deploy
+    command: 'undeploy {{ .env }}'
+`)
+
+	plan := rb.Plan(bot, message, map[string]interface{}{"env": "prod", "dryRun": true})
+
+	// nothing is executed or posted
+	require.Empty(t, bot.commands)
+	require.Empty(t, bot.posts)
+
+	require.Contains(t, plan, "*Runbook test* dry run · sequential")
+	require.Contains(t, plan, "template:\n        {{ sendMessage \"deploying\" \"C2\" }}notified {{ .env }}")
+	require.NotContains(t, plan, "would post", "template must not be executed")
+	require.Contains(t, plan, "*deploy-0*")
+	require.Contains(t, plan, "command: `deploy eu prod`")
+	require.Contains(t, plan, "command: `deploy us prod`")
+	require.Contains(t, plan, "*check* · when `{{ eq .env \"dev\" }}` → false")
+	require.NotContains(t, plan, "command: `check`")
+	require.Contains(t, plan, "command: `undeploy prod`")
+}
+
+func TestRunbooksHistory(t *testing.T) {
+
+	runs, err := common.NewRunbookStore("", 0)
+	require.NoError(t, err)
+
+	rb, bot, message := testRunbookWithStore(t, `
+mode: sequential
+pipeline:
+  - id: check
+    template: "checked {{ .env }}"
+  - id: deploy
+    command: "deploy"
+`, runs)
+
+	err = rb.Execute(bot, message, map[string]interface{}{"env": "prod"}, (&testResults{}).callback, true)
+	require.NoError(t, err)
+
+	obs := common.NewObservability(sreCommon.NewLogs(), sreCommon.NewMetrics())
+	require.Nil(t, NewRunbooks(RunbooksOptions{}, obs, runs))
+
+	processor := NewRunbooks(RunbooksOptions{Name: "runbook", Limit: 10}, obs, runs)
+	require.Len(t, processor.Commands(), 1)
+	history := processor.Commands()[0]
+	require.Equal(t, "runbook", history.Group())
+
+	_, text, _, _, err := history.Execute(bot, message, common.ExecuteParams{}, nil)
+	require.NoError(t, err)
+	require.Contains(t, text, fmt.Sprintf("`%s` test · done", rb.run.ID))
+	require.Contains(t, text, "by user")
+
+	_, text, _, _, err = history.Execute(bot, message, common.ExecuteParams{"filter": rb.run.ID}, nil)
+	require.NoError(t, err)
+	require.Contains(t, text, "*Runbook test*")
+	require.Contains(t, text, "Params: env=prod")
+	require.Contains(t, text, "✅ check")
+	require.Contains(t, text, "checked prod")
+	require.Contains(t, text, "✅ deploy")
+
+	_, text, _, _, err = history.Execute(bot, message, common.ExecuteParams{"filter": "unknown"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "No runbook runs found", text)
+}
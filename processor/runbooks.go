@@ -0,0 +1,292 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/devopsext/chatops/common"
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+)
+
+type RunbooksOptions struct {
+	Name  string
+	Limit int
+}
+
+type RunbooksExecutor struct {
+	response common.Response
+}
+
+type RunbooksHistoryCommand struct {
+	processor *Runbooks
+}
+
+// Runbooks is a built-in processor which shows runbook runs
+type Runbooks struct {
+	options  RunbooksOptions
+	runs     *common.RunbookStore
+	commands []common.Command
+	logger   sreCommon.Logger
+}
+
+const (
+	RunbooksHistoryCommandName = "history"
+	runbooksTimeFormat         = "2006-01-02 15:04:05 MST"
+	runbooksTextLimit          = 200
+)
+
+// Runbooks executor
+
+func (re *RunbooksExecutor) Response() common.Response {
+	return re.response
+}
+
+func (re *RunbooksExecutor) After(message common.Message) error {
+	return nil
+}
+
+// Runbooks history command
+
+func (rhc *RunbooksHistoryCommand) Name() string {
+	return RunbooksHistoryCommandName
+}
+
+func (rhc *RunbooksHistoryCommand) Group() string {
+	return rhc.processor.options.Name
+}
+
+func (rhc *RunbooksHistoryCommand) Description() string {
+	return "Show runbook runs, a run by its ID or runs of a runbook by its name"
+}
+
+func (rhc *RunbooksHistoryCommand) Params() []string {
+	return []string{"(?P<filter>\\S+)"}
+}
+
+func (rhc *RunbooksHistoryCommand) Aliases() []string {
+	return []string{}
+}
+
+func (rhc *RunbooksHistoryCommand) Confirmation(params common.ExecuteParams) string {
+	return ""
+}
+
+func (rhc *RunbooksHistoryCommand) Priority() int {
+	return 0
+}
+
+func (rhc *RunbooksHistoryCommand) Wrapper() bool {
+	return false
+}
+
+func (rhc *RunbooksHistoryCommand) Schedule() string {
+	return ""
+}
+
+func (rhc *RunbooksHistoryCommand) Channel() string {
+	return ""
+}
+
+func (rhc *RunbooksHistoryCommand) Response() common.Response {
+	return common.NewGenericResponse(true)
+}
+
+func (rhc *RunbooksHistoryCommand) Actions() []common.Action {
+	return []common.Action{}
+}
+
+func (rhc *RunbooksHistoryCommand) Approval() common.Approval {
+	return nil
+}
+
+func (rhc *RunbooksHistoryCommand) Permissions() bool {
+	return true
+}
+
+func (rhc *RunbooksHistoryCommand) TrackMessages() bool {
+	return false
+}
+
+func (rhc *RunbooksHistoryCommand) Fields(bot common.Bot, message common.Message, params common.ExecuteParams, eval []string, parent common.Field) []common.Field {
+	return []common.Field{}
+}
+
+// times are shown in user's time zone if it's known
+func (rhc *RunbooksHistoryCommand) formatTime(t time.Time, message common.Message) string {
+
+	if !utils.IsEmpty(message) && !utils.IsEmpty(message.User()) {
+		loc, err := time.LoadLocation(message.User().TimeZone())
+		if err == nil {
+			t = t.In(loc)
+		}
+	}
+	return t.Format(runbooksTimeFormat)
+}
+
+func (rhc *RunbooksHistoryCommand) duration(started time.Time, finished *time.Time) string {
+
+	if finished == nil {
+		return time.Since(started).Round(time.Second).String()
+	}
+	return finished.Sub(started).Round(time.Millisecond).String()
+}
+
+func (rhc *RunbooksHistoryCommand) user(run *common.RunbookRun) string {
+
+	if !utils.IsEmpty(run.UserName) {
+		return run.UserName
+	}
+	return run.User
+}
+
+func (rhc *RunbooksHistoryCommand) list(runs []*common.RunbookRun, message common.Message) string {
+
+	if len(runs) == 0 {
+		return "No runbook runs found"
+	}
+
+	lines := []string{"*Runbook runs*"}
+	for _, run := range runs {
+
+		items := []string{
+			fmt.Sprintf("%s `%s` %s", defaultRunbookProgressIcons[run.Status], run.ID, run.Name),
+			string(run.Status),
+			rhc.formatTime(run.Started, message),
+			rhc.duration(run.Started, run.Finished),
+		}
+		if u := rhc.user(run); !utils.IsEmpty(u) {
+			items = append(items, fmt.Sprintf("by %s", u))
+		}
+		lines = append(lines, strings.Join(items, " · "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (rhc *RunbooksHistoryCommand) truncate(s string) string {
+
+	s = strings.TrimSpace(s)
+	if len([]rune(s)) <= runbooksTextLimit {
+		return s
+	}
+	return fmt.Sprintf("%s...", string([]rune(s)[:runbooksTextLimit]))
+}
+
+func (rhc *RunbooksHistoryCommand) show(run *common.RunbookRun, message common.Message) string {
+
+	lines := []string{
+		fmt.Sprintf("%s *Runbook %s* run `%s` · %s", defaultRunbookProgressIcons[run.Status], run.Name, run.ID, run.Status),
+	}
+
+	started := fmt.Sprintf("Started %s", rhc.formatTime(run.Started, message))
+	if u := rhc.user(run); !utils.IsEmpty(u) {
+		started = fmt.Sprintf("%s by %s", started, u)
+	}
+	if !utils.IsEmpty(run.Command) {
+		started = fmt.Sprintf("%s with %s", started, run.Command)
+	}
+	lines = append(lines, started)
+
+	if run.Finished != nil {
+		lines = append(lines, fmt.Sprintf("Finished %s in %s", rhc.formatTime(*run.Finished, message), rhc.duration(run.Started, run.Finished)))
+	}
+
+	if len(run.Params) > 0 {
+		keys := []string{}
+		for k := range run.Params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		params := []string{}
+		for _, k := range keys {
+			params = append(params, fmt.Sprintf("%s=%v", k, run.Params[k]))
+		}
+		lines = append(lines, fmt.Sprintf("Params: %s", strings.Join(params, ", ")))
+	}
+
+	if !utils.IsEmpty(run.Error) {
+		lines = append(lines, fmt.Sprintf("Error: %s", run.Error))
+	}
+
+	steps := []*common.RunbookRunStep{}
+	for _, s := range run.Steps {
+		if s != nil {
+			steps = append(steps, s)
+		}
+	}
+	sort.Slice(steps, func(i, j int) bool {
+		if steps[i].Started == nil || steps[j].Started == nil || steps[i].Started.Equal(*steps[j].Started) {
+			return steps[i].ID < steps[j].ID
+		}
+		return steps[i].Started.Before(*steps[j].Started)
+	})
+
+	for _, s := range steps {
+
+		items := []string{fmt.Sprintf("%s %s", defaultRunbookProgressIcons[s.Status], s.ID)}
+		if s.Started != nil && s.Finished != nil {
+			items = append(items, rhc.duration(*s.Started, s.Finished))
+		}
+		if !utils.IsEmpty(s.Error) {
+			items = append(items, rhc.truncate(s.Error))
+		} else if !utils.IsEmpty(s.Text) {
+			items = append(items, rhc.truncate(s.Text))
+		}
+		lines = append(lines, strings.Join(items, " · "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (rhc *RunbooksHistoryCommand) Execute(bot common.Bot, message common.Message, params common.ExecuteParams, action common.Action) (common.Executor, string, []*common.Attachment, []common.Action, error) {
+
+	runs := rhc.processor.runs
+	if runs == nil {
+		return nil, "", nil, nil, fmt.Errorf("Runbook runs are not tracked")
+	}
+
+	executor := &RunbooksExecutor{
+		response: rhc.Response(),
+	}
+
+	filter, _ := params["filter"].(string)
+	filter = strings.TrimSpace(filter)
+	rhc.processor.logger.Debug("Runbooks is showing runs with filter %s...", filter)
+
+	// filter is either run ID or runbook name
+	if !utils.IsEmpty(filter) {
+		run := runs.Get(filter)
+		if run != nil {
+			return executor, rhc.show(run, message), nil, nil, nil
+		}
+	}
+	return executor, rhc.list(runs.List(filter, rhc.processor.options.Limit), message), nil, nil, nil
+}
+
+// Runbooks
+
+func (r *Runbooks) Name() string {
+	return r.options.Name
+}
+
+func (r *Runbooks) Commands() []common.Command {
+	return r.commands
+}
+
+func NewRunbooks(options RunbooksOptions, observability *common.Observability, runs *common.RunbookStore) *Runbooks {
+
+	if utils.IsEmpty(options.Name) {
+		return nil
+	}
+
+	r := &Runbooks{
+		options: options,
+		runs:    runs,
+		logger:  observability.Logs(),
+	}
+	r.commands = []common.Command{
+		&RunbooksHistoryCommand{processor: r},
+	}
+	return r
+}
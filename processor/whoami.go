@@ -0,0 +1,246 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/devopsext/chatops/common"
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/devopsext/utils"
+)
+
+type WhoamiOptions struct {
+	Command string
+}
+
+type WhoamiExecutor struct {
+	response common.Response
+}
+
+type WhoamiCommand struct {
+	processor *Whoami
+}
+
+// Whoami is a built-in processor which shows user as bot sees it and explains permissions of commands
+type Whoami struct {
+	options    WhoamiOptions
+	processors *common.Processors
+	commands   []common.Command
+	logger     sreCommon.Logger
+}
+
+// Whoami executor
+
+func (we *WhoamiExecutor) Response() common.Response {
+	return we.response
+}
+
+func (we *WhoamiExecutor) After(message common.Message) error {
+	return nil
+}
+
+// Whoami command
+
+func (wc *WhoamiCommand) Name() string {
+	return wc.processor.options.Command
+}
+
+func (wc *WhoamiCommand) Group() string {
+	return ""
+}
+
+func (wc *WhoamiCommand) Description() string {
+	return "Show your identity, groups and commands, or explain which rule allows or denies a command"
+}
+
+func (wc *WhoamiCommand) Params() []string {
+	return []string{"(?P<command>.+)"}
+}
+
+func (wc *WhoamiCommand) Aliases() []string {
+	return []string{}
+}
+
+func (wc *WhoamiCommand) Confirmation(params common.ExecuteParams) string {
+	return ""
+}
+
+func (wc *WhoamiCommand) Priority() int {
+	return 0
+}
+
+func (wc *WhoamiCommand) Wrapper() bool {
+	return false
+}
+
+func (wc *WhoamiCommand) Schedule() string {
+	return ""
+}
+
+func (wc *WhoamiCommand) Channel() string {
+	return ""
+}
+
+func (wc *WhoamiCommand) Response() common.Response {
+	return common.NewGenericResponse(false)
+}
+
+func (wc *WhoamiCommand) Actions() []common.Action {
+	return []common.Action{}
+}
+
+func (wc *WhoamiCommand) Approval() common.Approval {
+	return nil
+}
+
+// everyone should be able to find out why a command is denied
+func (wc *WhoamiCommand) Permissions() bool {
+	return false
+}
+
+func (wc *WhoamiCommand) TrackMessages() bool {
+	return false
+}
+
+func (wc *WhoamiCommand) Fields(bot common.Bot, message common.Message, params common.ExecuteParams, eval []string, parent common.Field) []common.Field {
+	return []common.Field{}
+}
+
+func (wc *WhoamiCommand) groupName(group string, c common.Command) string {
+
+	if utils.IsEmpty(group) {
+		return c.Name()
+	}
+	return fmt.Sprintf("%s/%s", group, c.Name())
+}
+
+// find takes command as it's typed or as permissions have it, e.g. "k8s pods" or "k8s/pods"
+func (wc *WhoamiCommand) find(text string) (string, common.Command) {
+
+	items := strings.FieldsFunc(text, func(r rune) bool {
+		return r == '/' || r == ' '
+	})
+	if len(items) == 0 {
+		return "", nil
+	}
+
+	ps := wc.processor.processors
+	if len(items) > 1 {
+		if c := ps.FindCommand(items[0], items[1]); c != nil {
+			return wc.groupName(items[0], c), c
+		}
+	}
+	if c := ps.FindCommand("", items[0]); c != nil {
+		return c.Name(), c
+	}
+	if group, c := ps.FindCommandByAlias(items[0]); c != nil {
+		return wc.groupName(group, c), c
+	}
+	return "", nil
+}
+
+// commands are those which exist, as bots add fake one to users without commands
+func (wc *WhoamiCommand) commands(user common.User) []string {
+
+	r := []string{}
+	for _, p := range wc.processor.processors.Items() {
+		for _, c := range p.Commands() {
+			name := wc.groupName(p.Name(), c)
+			if utils.Contains(user.Commands(), name) {
+				r = append(r, fmt.Sprintf("`%s`", name))
+			}
+		}
+	}
+	return r
+}
+
+func (wc *WhoamiCommand) explain(bot common.Bot, message common.Message, text string) string {
+
+	name, c := wc.find(text)
+	if c == nil {
+		return fmt.Sprintf("`%s` is not a command", text)
+	}
+	if !c.Permissions() {
+		return fmt.Sprintf("`%s` is allowed to everyone", name)
+	}
+
+	explainer, ok := bot.(common.PermissionsExplainer)
+	if !ok {
+		return fmt.Sprintf("`%s` can't be explained by %s", name, bot.Name())
+	}
+
+	channel := ""
+	if !utils.IsEmpty(message.Channel()) {
+		channel = message.Channel().ID()
+	}
+	return fmt.Sprintf("`%s` is %s", name, explainer.Explain(message.User(), channel, name))
+}
+
+func (wc *WhoamiCommand) Execute(bot common.Bot, message common.Message, params common.ExecuteParams, action common.Action) (common.Executor, string, []*common.Attachment, []common.Action, error) {
+
+	if utils.IsEmpty(message) || utils.IsEmpty(message.User()) {
+		return nil, "", nil, nil, fmt.Errorf("User is unknown")
+	}
+	user := message.User()
+
+	executor := &WhoamiExecutor{
+		response: wc.Response(),
+	}
+
+	text, _ := params["command"].(string)
+	text = strings.TrimSpace(text)
+	if !utils.IsEmpty(text) {
+		wc.processor.logger.Debug("Whoami is explaining %s to %s...", text, user.ID())
+		return executor, wc.explain(bot, message, text), nil, nil, nil
+	}
+
+	lines := []string{fmt.Sprintf("*%s* `%s` on %s", user.Name(), user.ID(), bot.Name())}
+	if !utils.IsEmpty(user.Email()) {
+		lines = append(lines, fmt.Sprintf("Email: %s", user.Email()))
+	}
+	if !utils.IsEmpty(user.TimeZone()) {
+		lines = append(lines, fmt.Sprintf("Time zone: %s", user.TimeZone()))
+	}
+
+	if explainer, ok := bot.(common.PermissionsExplainer); ok {
+		groups := explainer.UserGroups(user)
+		if len(groups) == 0 {
+			groups = []string{"none"}
+		}
+		lines = append(lines, fmt.Sprintf("Groups: %s", strings.Join(groups, ", ")))
+	}
+
+	commands := wc.commands(user)
+	if len(commands) == 0 {
+		commands = []string{"none"}
+	}
+	lines = append(lines, fmt.Sprintf("Commands: %s", strings.Join(commands, ", ")))
+	return executor, strings.Join(lines, "\n"), nil, nil, nil
+}
+
+// Whoami
+
+func (w *Whoami) Name() string {
+	return ""
+}
+
+func (w *Whoami) Commands() []common.Command {
+	return w.commands
+}
+
+func NewWhoami(options WhoamiOptions, observability *common.Observability, processors *common.Processors) *Whoami {
+
+	if utils.IsEmpty(options.Command) {
+		return nil
+	}
+
+	w := &Whoami{
+		options:    options,
+		processors: processors,
+		logger:     observability.Logs(),
+	}
+	w.commands = []common.Command{
+		&WhoamiCommand{processor: w},
+	}
+	return w
+}
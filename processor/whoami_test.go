@@ -0,0 +1,72 @@
+package processor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/devopsext/chatops/common"
+	sreCommon "github.com/devopsext/sre/common"
+	"github.com/stretchr/testify/require"
+)
+
+// testExplainerBot explains permissions as bots with permissions do
+type testExplainerBot struct {
+	testBot
+	explained []string
+}
+
+func (b *testExplainerBot) UserGroups(user common.User) []string {
+	return []string{"sre-team"}
+}
+
+func (b *testExplainerBot) Explain(user common.User, channel, command string) string {
+	b.explained = append(b.explained, channel+" "+command)
+	return "allowed by role sre, rule allow *"
+}
+
+func testWhoami() *WhoamiCommand {
+
+	obs := common.NewObservability(sreCommon.NewLogs(), sreCommon.NewMetrics())
+	processors := common.NewProcessors()
+	processors.Add(NewRunbooks(RunbooksOptions{Name: "runbook"}, obs, nil))
+	processors.Add(NewWhoami(WhoamiOptions{Command: "whoami"}, obs, processors))
+	return processors.Items()[1].Commands()[0].(*WhoamiCommand)
+}
+
+func TestWhoami(t *testing.T) {
+
+	wc := testWhoami()
+	bot := &testExplainerBot{}
+	message := &testMessage{id: "1", channel: "C1", user: common.NewGenericUser("U1", "john", "UTC", []string{"runbook/history", "fake"})}
+
+	_, text, _, _, err := wc.Execute(bot, message, common.ExecuteParams{}, nil)
+	require.NoError(t, err)
+	require.Contains(t, text, "*john* `U1` on test")
+	require.Contains(t, text, "Groups: sre-team")
+	require.True(t, strings.HasSuffix(text, "Commands: `runbook/history`"), "only existing commands must be shown")
+	require.Contains(t, text, "Time zone: UTC")
+
+	tests := []struct {
+		name    string
+		command string
+		text    string
+	}{
+		{"typed command", "runbook history", "`runbook/history` is allowed by role sre, rule allow *"},
+		{"permission command", "runbook/history", "`runbook/history` is allowed by role sre, rule allow *"},
+		{"command without permissions", "whoami", "`whoami` is allowed to everyone"},
+		{"unknown command", "k8s pods", "`k8s pods` is not a command"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, text, _, _, err := wc.Execute(bot, message, common.ExecuteParams{"command": tt.command}, nil)
+			require.NoError(t, err)
+			require.Equal(t, tt.text, text)
+		})
+	}
+	require.Equal(t, []string{"C1 runbook/history", "C1 runbook/history"}, bot.explained)
+
+	_, text, _, _, err = wc.Execute(&testBot{}, message, common.ExecuteParams{"command": "runbook history"}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "`runbook/history` can't be explained by test", text)
+}
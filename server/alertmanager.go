@@ -0,0 +1,391 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/devopsext/chatops/common"
+	"github.com/devopsext/utils"
+	"github.com/jellydator/ttlcache/v3"
+)
+
+// AlertmanagerAlert and AlertmanagerMessage follow Alertmanager webhook payload
+type AlertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+type AlertmanagerMessage struct {
+	Version           string               `json:"version"`
+	GroupKey          string               `json:"groupKey"`
+	TruncatedAlerts   int                  `json:"truncatedAlerts"`
+	Status            string               `json:"status"`
+	Receiver          string               `json:"receiver"`
+	GroupLabels       map[string]string    `json:"groupLabels"`
+	CommonLabels      map[string]string    `json:"commonLabels"`
+	CommonAnnotations map[string]string    `json:"commonAnnotations"`
+	ExternalURL       string               `json:"externalURL"`
+	Alerts            []*AlertmanagerAlert `json:"alerts"`
+}
+
+// AlertmanagerRoute maps alert groups to a command, bot, channel, command, params and resolved are templates of the message.
+// Repeat interval should be at least repeat_interval of Alertmanager, so firing alerts don't start the command again.
+type AlertmanagerRoute struct {
+	Name           string
+	Receiver       string
+	Match          map[string]string
+	MatchRe        map[string]string `yaml:"matchRe"`
+	Bot            string
+	Channel        string
+	Command        string
+	Params         map[string]string
+	User           string
+	Resolved       string
+	Continue       bool
+	RepeatInterval string `yaml:"repeatInterval"`
+	matchRe        map[string]*regexp.Regexp
+	repeatInterval time.Duration
+}
+
+type AlertmanagerConfig struct {
+	Routes []*AlertmanagerRoute
+}
+
+type Alertmanager struct {
+	routes []*AlertmanagerRoute
+	// fingerprints of firing alerts per route, they outlive tags of messages which are gone with bot cache
+	fired *ttlcache.Cache[string, string]
+}
+
+type AlertmanagerResponse struct {
+	Messages []string `json:"messages"`
+}
+
+const (
+	AlertmanagerStatusResolved = "resolved"
+
+	// message of alert group is tagged with group, resolved messages are tagged once more, as tags can't be removed
+	alertmanagerGroupTag    = "alertmanager_group"
+	alertmanagerResolvedTag = "alertmanager_resolved"
+	alertmanagerResolved    = "Resolved: {{ .CommonLabels.alertname }}"
+	// default repeat_interval of Alertmanager
+	alertmanagerRepeatInterval = 4 * time.Hour
+)
+
+func (ar *AlertmanagerRoute) matches(m *AlertmanagerMessage) bool {
+
+	if !utils.IsEmpty(ar.Receiver) && ar.Receiver != m.Receiver {
+		return false
+	}
+	for k, v := range ar.Match {
+		if m.CommonLabels[k] != v {
+			return false
+		}
+	}
+	for k, re := range ar.matchRe {
+		if !re.MatchString(m.CommonLabels[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// group identifies message of alert group per route
+func (ar *AlertmanagerRoute) group(m *AlertmanagerMessage) string {
+
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s\n%s", ar.Name, m.GroupKey)))
+	return hex.EncodeToString(h[:16])
+}
+
+func (ar *AlertmanagerRoute) fingerprint(alert *AlertmanagerAlert) string {
+	return fmt.Sprintf("%s/%s", ar.Name, alert.Fingerprint)
+}
+
+// firedMessages are messages of the route posted for firing alerts of the message
+func (a *Alertmanager) firedMessages(route *AlertmanagerRoute, m *AlertmanagerMessage) map[string]string {
+
+	r := make(map[string]string)
+	for _, alert := range m.Alerts {
+		if utils.IsEmpty(alert.Fingerprint) {
+			continue
+		}
+		if item := a.fired.Get(route.fingerprint(alert)); item != nil {
+			key := item.Value()
+			r[key] = key[strings.LastIndex(key, "/")+1:]
+		}
+	}
+	return r
+}
+
+// remember keeps firing alerts for two repeat intervals, so repeated notification comes before they are gone
+func (a *Alertmanager) remember(route *AlertmanagerRoute, m *AlertmanagerMessage, key string) {
+
+	for _, alert := range m.Alerts {
+		if utils.IsEmpty(alert.Fingerprint) || alert.Status == AlertmanagerStatusResolved {
+			continue
+		}
+		a.fired.Set(route.fingerprint(alert), key, 2*route.repeatInterval)
+	}
+}
+
+func (a *Alertmanager) forget(route *AlertmanagerRoute, m *AlertmanagerMessage) {
+
+	for _, alert := range m.Alerts {
+		if !utils.IsEmpty(alert.Fingerprint) {
+			a.fired.Delete(route.fingerprint(alert))
+		}
+	}
+}
+
+func (a *Alertmanager) Stop() {
+	if a != nil {
+		a.fired.Stop()
+	}
+}
+
+func (a *Alertmanager) Enabled() bool {
+	return a != nil && len(a.routes) > 0
+}
+
+// Routes returns routes which match the message, until the one which doesn't continue
+func (a *Alertmanager) Routes(m *AlertmanagerMessage) []*AlertmanagerRoute {
+
+	r := []*AlertmanagerRoute{}
+	if a == nil {
+		return r
+	}
+	for _, route := range a.routes {
+		if !route.matches(m) {
+			continue
+		}
+		r = append(r, route)
+		if !route.Continue {
+			break
+		}
+	}
+	return r
+}
+
+func NewAlertmanager(routes string) (*Alertmanager, error) {
+
+	var config AlertmanagerConfig
+	_, err := common.LoadYaml(routes, &config)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load alertmanager routes: %s", err)
+	}
+
+	for i, route := range config.Routes {
+		if route == nil || utils.IsEmpty(route.Name) {
+			return nil, fmt.Errorf("alertmanager route %d has no name", i)
+		}
+		if utils.IsEmpty(route.Bot) || utils.IsEmpty(route.Channel) || utils.IsEmpty(route.Command) {
+			return nil, fmt.Errorf("alertmanager route %s needs bot, channel and command", route.Name)
+		}
+		route.matchRe = make(map[string]*regexp.Regexp)
+		for k, v := range route.MatchRe {
+			re, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", v))
+			if err != nil {
+				return nil, fmt.Errorf("alertmanager route %s has invalid regex for %s: %s", route.Name, k, err)
+			}
+			route.matchRe[k] = re
+		}
+		route.repeatInterval = alertmanagerRepeatInterval
+		if !utils.IsEmpty(route.RepeatInterval) {
+			route.repeatInterval, err = time.ParseDuration(route.RepeatInterval)
+			if err != nil || route.repeatInterval <= 0 {
+				return nil, fmt.Errorf("alertmanager route %s has invalid repeat interval %s", route.Name, route.RepeatInterval)
+			}
+		}
+	}
+
+	a := &Alertmanager{
+		routes: config.Routes,
+		fired:  ttlcache.New[string, string](),
+	}
+	go a.fired.Start()
+	return a, nil
+}
+
+// activeAlertMessages are messages of the group which aren't resolved yet
+func (s *HttpServer) activeAlertMessages(bot, group string) (map[string]string, error) {
+
+	r, err := s.executor.FindMessagesByTag(bot, alertmanagerGroupTag, group)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		r = make(map[string]string)
+	}
+	resolved, err := s.executor.FindMessagesByTag(bot, alertmanagerResolvedTag, group)
+	if err != nil {
+		return nil, err
+	}
+	for k := range resolved {
+		delete(r, k)
+	}
+	return r, nil
+}
+
+func (s *HttpServer) resolveAlert(route *AlertmanagerRoute, m *AlertmanagerMessage, bot, group string, messages map[string]string) ([]string, error) {
+
+	text := route.Resolved
+	if utils.IsEmpty(text) {
+		text = alertmanagerResolved
+	}
+	text = common.Render(text, m, s.obs)
+
+	r := []string{}
+	for key, ID := range messages {
+
+		channel := strings.TrimSuffix(key, fmt.Sprintf("/%s", ID))
+
+		// reply is updated, as it's the message with actions, command message if reply is unknown
+		updateChannel, updateID := channel, ID
+		if result, err := s.executor.GetMessageResult(bot, ID); err == nil && result != nil && !utils.IsEmpty(result.ID) {
+			updateChannel, updateID = result.Channel, result.ID
+		}
+		if err := s.executor.UpdateMessage(bot, updateChannel, updateID, text); err != nil {
+			return r, err
+		}
+		if err := s.executor.TagMessage(bot, channel, ID, map[string]string{alertmanagerResolvedTag: group}); err != nil {
+			return r, err
+		}
+		r = append(r, updateID)
+	}
+	s.alertmanager.forget(route, m)
+	return r, nil
+}
+
+func (s *HttpServer) fireAlert(route *AlertmanagerRoute, m *AlertmanagerMessage, id *HttpIdentity, bot, command, group string) (string, error) {
+
+	channel := common.Render(route.Channel, m, s.obs)
+
+	var params common.ExecuteParams
+	if len(route.Params) > 0 {
+		params = make(common.ExecuteParams)
+		for k, v := range route.Params {
+			params[k] = common.Render(v, m, s.obs)
+		}
+	}
+
+	user := route.User
+	if utils.IsEmpty(user) && id != nil {
+		user = id.User
+	}
+
+	msg, err := s.executor.ExecuteCommand(bot, channel, command, user, params)
+	if err != nil {
+		return "", err
+	}
+	if msg == nil {
+		return "", fmt.Errorf("command %s produced no message", common.GetCommandName(command))
+	}
+
+	// command message is tagged, as reply might not be known yet, reply is found once group is resolved
+	err = s.executor.TagMessage(bot, channel, msg.ID(), map[string]string{alertmanagerGroupTag: group})
+	if err != nil {
+		return "", err
+	}
+	s.alertmanager.remember(route, m, fmt.Sprintf("%s/%s", channel, msg.ID()))
+
+	result, err := s.executor.GetMessageResult(bot, msg.ID())
+	if err != nil || result == nil || utils.IsEmpty(result.ID) {
+		return msg.ID(), nil
+	}
+	return result.ID, nil
+}
+
+// postAlertmanager receives Alertmanager webhooks, each alert group has one message per route
+func (s *HttpServer) postAlertmanager(w http.ResponseWriter, r *http.Request) {
+	s.incRequests(r.Method, r.URL.Path, "")
+
+	if r.Method != http.MethodPost {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.alertmanager.Enabled() {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "alertmanager routes are not configured", http.StatusNotFound)
+		return
+	}
+
+	var m AlertmanagerMessage
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil || utils.IsEmpty(m.GroupKey) {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "invalid alertmanager message", http.StatusBadRequest)
+		return
+	}
+
+	id := HttpIdentityFromContext(r.Context())
+	resp := AlertmanagerResponse{Messages: []string{}}
+
+	for _, route := range s.alertmanager.Routes(&m) {
+
+		bot := common.Render(route.Bot, &m, s.obs)
+		group := route.group(&m)
+
+		messages, err := s.activeAlertMessages(bot, group)
+		if err != nil {
+			s.obs.Error("[API] Alertmanager route %s failed: %v", route.Name, err)
+			s.incErrors(r.Method, r.URL.Path, "")
+			s.writeErrorWithMetrics(w, r, "", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for k, v := range s.alertmanager.firedMessages(route, &m) {
+			messages[k] = v
+		}
+
+		if m.Status == AlertmanagerStatusResolved {
+			ids, err := s.resolveAlert(route, &m, bot, group, messages)
+			resp.Messages = append(resp.Messages, ids...)
+			if err != nil {
+				s.obs.Error("[API] Alertmanager route %s couldn't resolve group %s: %v", route.Name, m.GroupKey, err)
+				s.incErrors(r.Method, r.URL.Path, "")
+				s.writeErrorWithMetrics(w, r, "", err.Error(), http.StatusInternalServerError)
+				return
+			}
+			continue
+		}
+
+		// group is notified again while it's firing, message is already there
+		if len(messages) > 0 {
+			for key, ID := range messages {
+				s.alertmanager.remember(route, &m, key)
+				resp.Messages = append(resp.Messages, ID)
+			}
+			continue
+		}
+
+		command := common.Render(route.Command, &m, s.obs)
+		if !common.CommandInSlice(command, s.allowedCmds(id)) {
+			s.obs.Error("[API] Alertmanager route %s command is not allowed: identity=%s, command=%s", route.Name, s.identityName(id), command)
+			s.incErrors(r.Method, r.URL.Path, common.GetCommandName(command))
+			s.writeErrorWithMetrics(w, r, common.GetCommandName(command), "command not allowed", http.StatusForbidden)
+			return
+		}
+
+		ID, err := s.fireAlert(route, &m, id, bot, command, group)
+		if err != nil {
+			s.obs.Error("[API] Alertmanager route %s couldn't post group %s: %v", route.Name, m.GroupKey, err)
+			s.incErrors(r.Method, r.URL.Path, "")
+			s.writeErrorWithMetrics(w, r, "", err.Error(), executeErrorStatus(err))
+			return
+		}
+		s.obs.Info("[API] Alertmanager route %s posted group %s: identity=%s, message ID: %s", route.Name, m.GroupKey, s.identityName(id), ID)
+		resp.Messages = append(resp.Messages, ID)
+	}
+	s.writeJSONWithMetrics(w, r, "", resp, http.StatusOK)
+}
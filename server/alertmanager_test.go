@@ -0,0 +1,160 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/devopsext/chatops/common"
+)
+
+const testAlertmanagerRoutes = `
+routes:
+  - name: k8s
+    matchRe:
+      alertname: Kube.*
+    bot: Slack
+    channel: "{{ .CommonLabels.channel }}"
+    command: alert/show
+    params:
+      namespace: "{{ .CommonLabels.namespace }}"
+    user: alertmanager
+    resolved: "{{ .CommonLabels.alertname }} is resolved"
+  - name: other
+    match:
+      severity: info
+    bot: Slack
+    channel: C2
+    command: deploy
+`
+
+func newTestAlertmanagerMessage(status string) *AlertmanagerMessage {
+	return &AlertmanagerMessage{
+		Version:      "4",
+		GroupKey:     `{}:{alertname="KubePodCrashLooping"}`,
+		Status:       status,
+		Receiver:     "chatops",
+		CommonLabels: map[string]string{"alertname": "KubePodCrashLooping", "namespace": "prod", "channel": "C1"},
+		Alerts:       []*AlertmanagerAlert{{Status: status, Labels: map[string]string{"pod": "api-1"}, Fingerprint: "f1"}},
+	}
+}
+
+func TestPostAlertmanager(t *testing.T) {
+	mockBot := NewMockBot("Slack")
+	mockBot.messageResult = &common.MessageResult{Channel: "C1", ID: "reply-1"}
+	bots := common.NewBots()
+	bots.Add(mockBot)
+
+	server := newTestServerWithOptions(bots, HttpServerOptions{AllowedCmds: []string{"alert/show"}, Alertmanager: testAlertmanagerRoutes})
+	defer server.Stop()
+
+	send := func(m *AlertmanagerMessage) AlertmanagerResponse {
+		body, _ := json.Marshal(m)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/alertmanager", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		server.postAlertmanager(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+		}
+		var resp AlertmanagerResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp
+	}
+
+	resp := send(newTestAlertmanagerMessage("firing"))
+	if len(resp.Messages) != 1 || resp.Messages[0] != "reply-1" {
+		t.Fatalf("expected reply to be posted, got %v", resp.Messages)
+	}
+	channel, cmd := mockBot.GetLastCommand()
+	if channel != "C1" || cmd != "alert/show" || mockBot.lastParams["namespace"] != "prod" {
+		t.Errorf("unexpected command %s in %s with %v", cmd, channel, mockBot.lastParams)
+	}
+	if mockBot.lastUser == nil || mockBot.lastUser.ID() != "alertmanager" {
+		t.Errorf("expected command to be executed by alertmanager user")
+	}
+
+	// repeated notification doesn't post one more message
+	mockBot.Reset()
+	send(newTestAlertmanagerMessage("firing"))
+	if mockBot.WasCommandCalled() {
+		t.Error("expected firing group not to be posted again")
+	}
+
+	// tags are gone with bot cache, fingerprints are still known
+	mockBot.mu.Lock()
+	mockBot.tags = nil
+	mockBot.mu.Unlock()
+	send(newTestAlertmanagerMessage("firing"))
+	if mockBot.WasCommandCalled() {
+		t.Error("expected firing alert not to be posted again once tags are gone")
+	}
+
+	resp = send(newTestAlertmanagerMessage(AlertmanagerStatusResolved))
+	if len(resp.Messages) != 1 || mockBot.updates["C1/reply-1"] != "KubePodCrashLooping is resolved" {
+		t.Errorf("expected message to be resolved, got %v and %v", resp.Messages, mockBot.updates)
+	}
+
+	// group fires again after it's resolved
+	send(newTestAlertmanagerMessage("firing"))
+	if !mockBot.WasCommandCalled() {
+		t.Error("expected new message for group which fires again")
+	}
+}
+
+func TestPostAlertmanagerErrors(t *testing.T) {
+	bots := common.NewBots()
+	bots.Add(NewMockBot("Slack"))
+
+	notConfigured := newTestServer(bots)
+	// route command isn't allowed
+	configured := newTestServerWithOptions(bots, HttpServerOptions{Alertmanager: testAlertmanagerRoutes})
+
+	tests := []struct {
+		name           string
+		server         *HttpServer
+		body           string
+		expectedStatus int
+	}{
+		{"not configured", notConfigured, `{"groupKey":"g"}`, http.StatusNotFound},
+		{"invalid message", configured, `{"status":"firing"}`, http.StatusBadRequest},
+		{"command not allowed", configured, `{"groupKey":"g","status":"firing","commonLabels":{"alertname":"KubeDown"}}`, http.StatusForbidden},
+		{"no routes", configured, `{"groupKey":"g","status":"firing","commonLabels":{"alertname":"Other"}}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/alertmanager", bytes.NewReader([]byte(tt.body)))
+			rec := httptest.NewRecorder()
+
+			tt.server.postAlertmanager(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestAlertmanagerInvalidRoutes(t *testing.T) {
+	tests := []struct {
+		name   string
+		routes string
+	}{
+		{"no name", "routes:\n  - bot: Slack"},
+		{"no command", "routes:\n  - name: x\n    bot: Slack\n    channel: C1"},
+		{"invalid regex", "routes:\n  - name: x\n    bot: Slack\n    channel: C1\n    command: c\n    matchRe:\n      a: '('"},
+		{"invalid repeat interval", "routes:\n  - name: x\n    bot: Slack\n    channel: C1\n    command: c\n    repeatInterval: soon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewAlertmanager(tt.routes); err == nil {
+				t.Errorf("expected error for routes %q", tt.routes)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/devopsext/chatops/common"
+	"github.com/devopsext/utils"
+)
+
+type ApprovalRequest struct {
+	Bot      string `json:"bot"`
+	ID       string `json:"id"`       // ID of the message which waits for approval
+	Decision string `json:"decision"` // approve or reject
+	Reason   string `json:"reason,omitempty"`
+	UserID   string `json:"user_id,omitempty"` // approver is user of the identity, other users are refused
+}
+
+type ApprovalResponse struct {
+	ID     string               `json:"id"`
+	Status common.MessageStatus `json:"status"`
+}
+
+const (
+	ApprovalDecisionApprove = "approve"
+	ApprovalDecisionReject  = "reject"
+)
+
+func (s *HttpServer) findApproval(bot, ID string) (*common.PendingApproval, error) {
+
+	approvals, err := s.executor.PendingApprovals(bot)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range approvals {
+		if a.ID == ID {
+			return a, nil
+		}
+	}
+	return nil, nil
+}
+
+// getApprovals lists messages of the bot which wait for approval
+func (s *HttpServer) getApprovals(w http.ResponseWriter, r *http.Request) {
+	s.incRequests(r.Method, r.URL.Path, "")
+
+	if r.Method != http.MethodGet {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bot := r.URL.Query().Get("bot")
+	if bot == "" {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "bot query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	approvals, err := s.executor.PendingApprovals(bot)
+	if err != nil {
+		s.obs.Error("[API] Failed to list approvals: %v", err)
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSONWithMetrics(w, r, "", approvals, http.StatusOK)
+}
+
+// postApproval approves or rejects message as approval buttons do, approver is the user of identity
+func (s *HttpServer) postApproval(w http.ResponseWriter, r *http.Request) {
+	s.incRequests(r.Method, r.URL.Path, "")
+
+	if r.Method != http.MethodPost {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ApprovalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Bot == "" || req.ID == "" {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "bot and id are required", http.StatusBadRequest)
+		return
+	}
+
+	if req.Decision != ApprovalDecisionApprove && req.Decision != ApprovalDecisionReject {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "decision must be approve or reject", http.StatusBadRequest)
+		return
+	}
+
+	id := HttpIdentityFromContext(r.Context())
+
+	// approver is never taken from the request, otherwise anyone could approve own requests as another user
+	if id == nil || utils.IsEmpty(id.User) {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "approval needs identity with user", http.StatusForbidden)
+		return
+	}
+	if req.UserID != "" && req.UserID != id.User {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "identity can approve only as its user", http.StatusForbidden)
+		return
+	}
+	req.UserID = id.User
+
+	approval, err := s.findApproval(req.Bot, req.ID)
+	if err != nil {
+		s.obs.Error("[API] Failed to find approval: %v", err)
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if approval == nil {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", common.ErrApprovalNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	// approval without command, e.g. of runbook step, can't be matched to allowed commands, so it's denied
+	cmd := common.GetCommandName(approval.Command)
+	if !common.CommandInSlice(approval.Command, s.allowedCmds(id)) {
+		s.obs.Error("[API] Approval of command is not allowed: identity=%s, command=%s", s.identityName(id), approval.Command)
+		s.incErrors(r.Method, r.URL.Path, cmd)
+		s.writeErrorWithMetrics(w, r, cmd, "command not allowed", http.StatusForbidden)
+		return
+	}
+
+	s.obs.Info("[API] Approval decision: identity=%s, bot=%s, id=%s, decision=%s, user=%s", s.identityName(id), req.Bot, req.ID, req.Decision, req.UserID)
+
+	err = s.executor.Approve(req.Bot, req.ID, req.Decision == ApprovalDecisionApprove, req.UserID, req.Reason)
+	if err != nil {
+		s.obs.Error("[API] Approval decision failed: %v", err)
+		s.incErrors(r.Method, r.URL.Path, cmd)
+
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, common.ErrApprovalNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, common.ErrApprovalNotPending):
+			status = http.StatusConflict
+		case errors.Is(err, common.ErrApprovalSelf):
+			status = http.StatusForbidden
+		}
+		s.writeErrorWithMetrics(w, r, cmd, err.Error(), status)
+		return
+	}
+
+	status, err := s.executor.GetMessageStatus(req.Bot, req.ID)
+	if err != nil {
+		s.obs.Error("[API] Failed to get message status: %v", err)
+		s.incErrors(r.Method, r.URL.Path, cmd)
+		s.writeErrorWithMetrics(w, r, cmd, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSONWithMetrics(w, r, cmd, ApprovalResponse{ID: req.ID, Status: status}, http.StatusOK)
+}
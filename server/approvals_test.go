@@ -0,0 +1,217 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/devopsext/chatops/common"
+)
+
+func newTestApprovalBot() *MockBot {
+	mockBot := NewMockBot("Slack")
+	mockBot.approvals = []*common.PendingApproval{
+		{ID: "1", Channel: "C1", Command: "deploy app", User: "U1"},
+		{ID: "2", Channel: "C1", Command: "deploy own", User: "ci-bot"},
+		{ID: "3", Channel: "C1", Command: "release", User: "U1"},
+		{ID: "4", Channel: "C1", User: "U1"},
+	}
+	return mockBot
+}
+
+func TestGetApprovals(t *testing.T) {
+	bots := common.NewBots()
+	bots.Add(newTestApprovalBot())
+	server := newTestServer(bots)
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedCount  int
+	}{
+		{"pending approvals", "/api/v1/approvals?bot=Slack", http.StatusOK, 4},
+		{"bot is missing", "/api/v1/approvals", http.StatusBadRequest, 0},
+		{"unknown bot", "/api/v1/approvals?bot=Telegram", http.StatusInternalServerError, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			server.getApprovals(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var approvals []*common.PendingApproval
+			if err := json.NewDecoder(rec.Body).Decode(&approvals); err != nil {
+				t.Fatalf("failed to decode approvals: %v", err)
+			}
+			if len(approvals) != tt.expectedCount {
+				t.Errorf("expected %d approvals, got %d", tt.expectedCount, len(approvals))
+			}
+		})
+	}
+}
+
+func TestPostApproval(t *testing.T) {
+	mockBot := newTestApprovalBot()
+	bots := common.NewBots()
+	bots.Add(mockBot)
+
+	server := newTestServerWithOptions(bots, HttpServerOptions{Identities: testIdentities})
+	defer server.Stop()
+	handler := server.authenticated(server.postApproval)
+
+	tests := []struct {
+		name           string
+		body           ApprovalRequest
+		expectedStatus int
+	}{
+		{"approve", ApprovalRequest{Bot: "Slack", ID: "1", Decision: ApprovalDecisionApprove, Reason: "change 42"}, http.StatusOK},
+		{"already decided", ApprovalRequest{Bot: "Slack", ID: "1", Decision: ApprovalDecisionReject}, http.StatusNotFound},
+		{"own request", ApprovalRequest{Bot: "Slack", ID: "2", Decision: ApprovalDecisionApprove}, http.StatusForbidden},
+		{"command not allowed", ApprovalRequest{Bot: "Slack", ID: "3", Decision: ApprovalDecisionApprove}, http.StatusForbidden},
+		{"as another user", ApprovalRequest{Bot: "Slack", ID: "3", Decision: ApprovalDecisionApprove, UserID: "U2"}, http.StatusForbidden},
+		{"approval without command", ApprovalRequest{Bot: "Slack", ID: "4", Decision: ApprovalDecisionReject}, http.StatusForbidden},
+		{"invalid decision", ApprovalRequest{Bot: "Slack", ID: "3", Decision: "maybe"}, http.StatusBadRequest},
+		{"id is missing", ApprovalRequest{Bot: "Slack", Decision: ApprovalDecisionReject}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.body)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/approval", bytes.NewReader(body))
+			req.Header.Set("Authorization", "Bearer ci-token")
+			rec := httptest.NewRecorder()
+
+			handler(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	if d := mockBot.decisions["1"]; d != "approved by ci-bot: change 42" {
+		t.Errorf("unexpected decision %q", d)
+	}
+	for _, id := range []string{"2", "4"} {
+		if _, ok := mockBot.decisions[id]; ok {
+			t.Errorf("approval %s must not be decided", id)
+		}
+	}
+}
+
+func TestPostApprovalWithoutUser(t *testing.T) {
+	mockBot := newTestApprovalBot()
+	bots := common.NewBots()
+	bots.Add(mockBot)
+	server := newTestServerWithAllowedCmds(bots, []string{"deploy"})
+
+	// without auth approver would be whoever the caller claims to be
+	for _, userID := range []string{"", "U2"} {
+		body, _ := json.Marshal(ApprovalRequest{Bot: "Slack", ID: "1", Decision: ApprovalDecisionReject, UserID: userID})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/approval", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		server.postApproval(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("user %q: expected status %d, got %d", userID, http.StatusForbidden, rec.Code)
+		}
+	}
+
+	if _, ok := mockBot.decisions["1"]; ok {
+		t.Error("approval without identity user must not be decided")
+	}
+}
+
+func TestDeleteMessage(t *testing.T) {
+	mockBot := newTestApprovalBot()
+	mockBot.running = []*MockRun{{id: "10", command: "deploy app", user: "ci-bot"}, {id: "12", command: "deploy app", user: "U1"}, {id: "13", command: "release", user: "ci-bot"}}
+	bots := common.NewBots()
+	bots.Add(mockBot)
+
+	server := newTestServerWithOptions(bots, HttpServerOptions{Identities: testIdentities})
+	defer server.Stop()
+	handler := server.authenticated(server.deleteMessage)
+
+	tests := []struct {
+		name           string
+		id             string
+		url            string
+		expectedStatus int
+	}{
+		{"running", "10", "/api/v1/message/10?bot=Slack", http.StatusOK},
+		{"already cancelled", "10", "/api/v1/message/10?bot=Slack", http.StatusConflict},
+		{"waiting for approval", "1", "/api/v1/message/1?bot=Slack", http.StatusOK},
+		{"command not allowed", "3", "/api/v1/message/3?bot=Slack", http.StatusForbidden},
+		{"running command not allowed", "13", "/api/v1/message/13?bot=Slack", http.StatusForbidden},
+		{"running command of another user", "12", "/api/v1/message/12?bot=Slack", http.StatusForbidden},
+		{"bot is missing", "10", "/api/v1/message/10", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, tt.url, nil)
+			req.SetPathValue("id", tt.id)
+			req.Header.Set("Authorization", "Bearer ci-token")
+			rec := httptest.NewRecorder()
+
+			handler(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			var resp GetMessageStatusResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.ID != tt.id || resp.Status != common.MessageStatusCancelled {
+				t.Errorf("unexpected response %+v", resp)
+			}
+		})
+	}
+
+	if by := mockBot.cancelled["1"]; by != "ci-bot" {
+		t.Errorf("approval is cancelled by %q", by)
+	}
+	for _, id := range []string{"3", "12", "13"} {
+		if _, ok := mockBot.cancelled[id]; ok {
+			t.Errorf("message %s must not be cancelled", id)
+		}
+	}
+}
+
+func TestDeleteMessageWithoutUser(t *testing.T) {
+	mockBot := newTestApprovalBot()
+	mockBot.running = []*MockRun{{id: "10", command: "deploy app", user: "U1"}}
+	bots := common.NewBots()
+	bots.Add(mockBot)
+	server := newTestServerWithAllowedCmds(bots, []string{"deploy"})
+
+	// without user bot would cancel command on its own behalf
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/message/10?bot=Slack", nil)
+	req.SetPathValue("id", "10")
+	rec := httptest.NewRecorder()
+
+	server.deleteMessage(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+	if _, ok := mockBot.cancelled["10"]; ok {
+		t.Error("command must not be cancelled")
+	}
+}
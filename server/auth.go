@@ -0,0 +1,233 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devopsext/chatops/common"
+	"github.com/devopsext/utils"
+	"github.com/jellydator/ttlcache/v3"
+)
+
+// HttpIdentity is a caller of the API, it's authenticated by token, HMAC key and secret or client certificate subjects
+type HttpIdentity struct {
+	Name        string
+	Token       string
+	Key         string
+	Secret      string
+	Subjects    []string
+	User        string
+	AllowedCmds []string `yaml:"allowedCmds"`
+}
+
+type HttpAuthConfig struct {
+	Identities []*HttpIdentity
+}
+
+type HttpAuth struct {
+	identities []*HttpIdentity
+	window     time.Duration
+	signatures *ttlcache.Cache[string, bool]
+}
+
+type httpIdentityKey struct{}
+
+const (
+	HttpAuthHeaderKey       = "X-Chatops-Key"
+	HttpAuthHeaderTimestamp = "X-Chatops-Timestamp"
+	HttpAuthHeaderSignature = "X-Chatops-Signature"
+
+	httpAuthBearerPrefix    = "Bearer "
+	httpAuthSignaturePrefix = "sha256="
+	httpAuthDefaultWindow   = 5 * time.Minute
+)
+
+// HttpSignature signs timestamp, method, request URI and body, so signed request can't be used for another endpoint
+func HttpSignature(secret, timestamp, method, uri string, body []byte) string {
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(fmt.Sprintf("%s\n%s\n%s\n", timestamp, method, uri)))
+	mac.Write(body)
+	return fmt.Sprintf("%s%s", httpAuthSignaturePrefix, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// HttpIdentityFromContext returns identity of authenticated request or nil
+func HttpIdentityFromContext(ctx context.Context) *HttpIdentity {
+
+	id, _ := ctx.Value(httpIdentityKey{}).(*HttpIdentity)
+	return id
+}
+
+func (ha *HttpAuth) Enabled() bool {
+	return ha != nil && len(ha.identities) > 0
+}
+
+func (ha *HttpAuth) byToken(token string) *HttpIdentity {
+
+	for _, id := range ha.identities {
+		if utils.IsEmpty(id.Token) {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(id.Token), []byte(token)) == 1 {
+			return id
+		}
+	}
+	return nil
+}
+
+func (ha *HttpAuth) byKey(key string) *HttpIdentity {
+
+	for _, id := range ha.identities {
+		if !utils.IsEmpty(id.Key) && id.Key == key {
+			return id
+		}
+	}
+	return nil
+}
+
+// certificate subjects are its CN and SANs
+func (ha *HttpAuth) certSubjects(cert *x509.Certificate) []string {
+
+	r := []string{}
+	if !utils.IsEmpty(cert.Subject.CommonName) {
+		r = append(r, cert.Subject.CommonName)
+	}
+	r = append(r, cert.DNSNames...)
+	r = append(r, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		r = append(r, u.String())
+	}
+	return r
+}
+
+func (ha *HttpAuth) byCertificate(cert *x509.Certificate) *HttpIdentity {
+
+	subjects := ha.certSubjects(cert)
+	for _, id := range ha.identities {
+		for _, s := range id.Subjects {
+			if slices.Contains(subjects, s) {
+				return id
+			}
+		}
+	}
+	return nil
+}
+
+func (ha *HttpAuth) verifySignature(r *http.Request) (*HttpIdentity, error) {
+
+	id := ha.byKey(r.Header.Get(HttpAuthHeaderKey))
+	if id == nil || utils.IsEmpty(id.Secret) {
+		return nil, fmt.Errorf("unknown key")
+	}
+
+	timestamp := r.Header.Get(HttpAuthHeaderTimestamp)
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp")
+	}
+	diff := time.Since(time.Unix(ts, 0))
+	if diff > ha.window || diff < -ha.window {
+		return nil, fmt.Errorf("timestamp is out of window")
+	}
+
+	var body []byte
+	if r.Body != nil {
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read body")
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	signature := r.Header.Get(HttpAuthHeaderSignature)
+	expected := HttpSignature(id.Secret, timestamp, r.Method, r.URL.RequestURI(), body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+
+	// signature can be used once within the window
+	if _, found := ha.signatures.GetOrSet(signature, true); found {
+		return nil, fmt.Errorf("signature is already used")
+	}
+	return id, nil
+}
+
+// Authenticate returns identity of the request, verified client certificate goes first, then signature and token
+func (ha *HttpAuth) Authenticate(r *http.Request) (*HttpIdentity, error) {
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.PeerCertificates) > 0 {
+		if id := ha.byCertificate(r.TLS.PeerCertificates[0]); id != nil {
+			return id, nil
+		}
+	}
+
+	if !utils.IsEmpty(r.Header.Get(HttpAuthHeaderSignature)) {
+		return ha.verifySignature(r)
+	}
+
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, httpAuthBearerPrefix) {
+		return nil, fmt.Errorf("no credentials")
+	}
+	id := ha.byToken(strings.TrimSpace(strings.TrimPrefix(header, httpAuthBearerPrefix)))
+	if id == nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return id, nil
+}
+
+func (ha *HttpAuth) Stop() {
+	if ha.signatures != nil {
+		ha.signatures.Stop()
+	}
+}
+
+func NewHttpAuth(identities, window string) (*HttpAuth, error) {
+
+	var config HttpAuthConfig
+	_, err := common.LoadYaml(identities, &config)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load identities: %s", err)
+	}
+
+	w := httpAuthDefaultWindow
+	if !utils.IsEmpty(window) {
+		w, err = time.ParseDuration(window)
+		if err != nil {
+			return nil, fmt.Errorf("invalid replay window %s: %s", window, err)
+		}
+	}
+
+	for i, id := range config.Identities {
+		if id == nil || utils.IsEmpty(id.Name) {
+			return nil, fmt.Errorf("identity %d has no name", i)
+		}
+		if utils.IsEmpty(id.Token) && (utils.IsEmpty(id.Key) || utils.IsEmpty(id.Secret)) && len(id.Subjects) == 0 {
+			return nil, fmt.Errorf("identity %s needs token, key and secret or subjects", id.Name)
+		}
+	}
+
+	ha := &HttpAuth{
+		identities: config.Identities,
+		window:     w,
+	}
+	if !ha.Enabled() {
+		return ha, nil
+	}
+
+	ha.signatures = ttlcache.New(ttlcache.WithTTL[string, bool](2 * w))
+	go ha.signatures.Start()
+	return ha, nil
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/devopsext/chatops/common"
+)
+
+const testIdentities = `
+identities:
+  - name: ci
+    token: ci-token
+    user: ci-bot
+    allowedCmds: [deploy]
+  - name: scheduler
+    key: scheduler-key
+    secret: scheduler-secret
+  - name: gitlab
+    subjects: [gitlab-runner.example.com]
+    allowedCmds: [release]
+`
+
+func newTestAuthServer(t *testing.T) (*HttpServer, *MockBot) {
+	mockBot := NewMockBot("Slack")
+	bots := common.NewBots()
+	bots.Add(mockBot)
+
+	server := newTestServerWithOptions(bots, HttpServerOptions{
+		Listen:       ":0",
+		AllowedCmds:  []string{"help"},
+		Identities:   testIdentities,
+		ReplayWindow: "1m",
+	})
+	t.Cleanup(server.Stop)
+	return server, mockBot
+}
+
+func newTestMessageRequest(command string) (*http.Request, []byte) {
+	body, _ := json.Marshal(CreateMessageRequest{Bot: "Slack", Channel: "C1", Command: command})
+	return httptest.NewRequest(http.MethodPost, "/api/v1/message", bytes.NewReader(body)), body
+}
+
+func signTestRequest(req *http.Request, body []byte, secret string, ts time.Time) {
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	req.Header.Set(HttpAuthHeaderKey, "scheduler-key")
+	req.Header.Set(HttpAuthHeaderTimestamp, timestamp)
+	req.Header.Set(HttpAuthHeaderSignature, HttpSignature(secret, timestamp, req.Method, req.URL.RequestURI(), body))
+}
+
+func TestAuthToken(t *testing.T) {
+	server, mockBot := newTestAuthServer(t)
+	handler := server.authenticated(server.createMessage)
+
+	tests := []struct {
+		name           string
+		token          string
+		command        string
+		expectedStatus int
+	}{
+		{"valid token", "ci-token", "deploy app", http.StatusCreated},
+		{"command of other identity", "ci-token", "help", http.StatusForbidden},
+		{"invalid token", "wrong", "deploy app", http.StatusUnauthorized},
+		{"no token", "", "deploy app", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := newTestMessageRequest(tt.command)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+
+			handler(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	// identity user is used when request has no user
+	if mockBot.lastUser == nil || mockBot.lastUser.ID() != "ci-bot" {
+		t.Errorf("expected command to be executed by ci-bot, got %v", mockBot.lastUser)
+	}
+}
+
+func TestAuthIdentityUser(t *testing.T) {
+	server, mockBot := newTestAuthServer(t)
+	handler := server.authenticated(server.createMessage)
+
+	for _, tt := range []struct {
+		userID         string
+		expectedStatus int
+	}{
+		{"U2", http.StatusForbidden},
+		{"ci-bot", http.StatusCreated},
+	} {
+		body, _ := json.Marshal(CreateMessageRequest{Bot: "Slack", Channel: "C1", Command: "deploy app", UserID: tt.userID})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/message", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer ci-token")
+		rec := httptest.NewRecorder()
+
+		handler(rec, req)
+
+		if rec.Code != tt.expectedStatus {
+			t.Errorf("user %s: expected status %d, got %d: %s", tt.userID, tt.expectedStatus, rec.Code, rec.Body.String())
+		}
+	}
+
+	// identity bound to a user can't execute commands as another one
+	if mockBot.lastUser == nil || mockBot.lastUser.ID() != "ci-bot" {
+		t.Errorf("expected command to be executed by ci-bot, got %v", mockBot.lastUser)
+	}
+}
+
+func TestAuthSignature(t *testing.T) {
+	server, _ := newTestAuthServer(t)
+	handler := server.authenticated(server.createMessage)
+
+	send := func(req *http.Request) int {
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	req, body := newTestMessageRequest("help")
+	signTestRequest(req, body, "scheduler-secret", time.Now())
+	if code := send(req); code != http.StatusCreated {
+		t.Fatalf("expected signed request to be accepted, got %d", code)
+	}
+
+	// the same signature can't be replayed
+	replay, _ := newTestMessageRequest("help")
+	replay.Header = req.Header.Clone()
+	if code := send(replay); code != http.StatusUnauthorized {
+		t.Errorf("expected replay to be rejected, got %d", code)
+	}
+
+	stale, body := newTestMessageRequest("help")
+	signTestRequest(stale, body, "scheduler-secret", time.Now().Add(-2*time.Minute))
+	if code := send(stale); code != http.StatusUnauthorized {
+		t.Errorf("expected stale request to be rejected, got %d", code)
+	}
+
+	wrong, body := newTestMessageRequest("help")
+	signTestRequest(wrong, body, "other-secret", time.Now())
+	if code := send(wrong); code != http.StatusUnauthorized {
+		t.Errorf("expected request with wrong secret to be rejected, got %d", code)
+	}
+
+	// body is changed after signing
+	tampered, _ := newTestMessageRequest("release")
+	_, body = newTestMessageRequest("help")
+	signTestRequest(tampered, body, "scheduler-secret", time.Now())
+	if code := send(tampered); code != http.StatusUnauthorized {
+		t.Errorf("expected tampered request to be rejected, got %d", code)
+	}
+}
+
+func TestAuthDisabled(t *testing.T) {
+	server := newTestServerWithAllowedCmds(common.NewBots(), nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/runbook/status?id=run-1", nil)
+	rec := httptest.NewRecorder()
+
+	server.authenticated(server.getRunbookStatus)(rec, req)
+
+	// no identities keeps API open, so request reaches the handler
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
+
+func TestAuthInvalidIdentities(t *testing.T) {
+	tests := []struct {
+		name       string
+		identities string
+	}{
+		{"no name", "identities:\n  - token: x"},
+		{"no credentials", "identities:\n  - name: x"},
+		{"key without secret", "identities:\n  - name: x\n    key: k"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewHttpServer(HttpServerOptions{Identities: tt.identities}, newTestObservability(), common.NewBots())
+			if err == nil {
+				t.Errorf("expected error for identities %q", tt.identities)
+			}
+		})
+	}
+}
+
+func TestAuthClientCertificate(t *testing.T) {
+	server, _ := newTestAuthServer(t)
+	handler := server.authenticated(server.createMessage)
+
+	tests := []struct {
+		name           string
+		cert           *x509.Certificate
+		verified       bool
+		command        string
+		expectedStatus int
+	}{
+		{"SAN matches", &x509.Certificate{Subject: pkix.Name{CommonName: "runner"}, DNSNames: []string{"gitlab-runner.example.com"}}, true, "release", http.StatusCreated},
+		{"CN matches", &x509.Certificate{Subject: pkix.Name{CommonName: "gitlab-runner.example.com"}}, true, "release", http.StatusCreated},
+		{"command of other identity", &x509.Certificate{Subject: pkix.Name{CommonName: "gitlab-runner.example.com"}}, true, "deploy", http.StatusForbidden},
+		{"unknown subject", &x509.Certificate{Subject: pkix.Name{CommonName: "unknown"}}, true, "release", http.StatusUnauthorized},
+		{"not verified", &x509.Certificate{Subject: pkix.Name{CommonName: "gitlab-runner.example.com"}}, false, "release", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := newTestMessageRequest(tt.command)
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{tt.cert}}
+			if tt.verified {
+				req.TLS.VerifiedChains = [][]*x509.Certificate{{tt.cert}}
+			}
+			rec := httptest.NewRecorder()
+
+			handler(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
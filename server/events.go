@@ -0,0 +1,198 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devopsext/chatops/common"
+	"github.com/devopsext/utils"
+)
+
+const (
+	httpEventsBuffer    = 100
+	httpEventsKeepAlive = 30 * time.Second
+	httpCallbackTimeout = 10 * time.Second
+	// approvals might take long, but callbacks can't wait forever
+	httpCallbackTTL = 24 * time.Hour
+	// status is checked in case final event is missed, e.g. message is gone from bot cache
+	httpCallbackCheckInterval = time.Minute
+)
+
+func (s *HttpServer) allowedCallbackHost(host string) bool {
+
+	host = strings.ToLower(host)
+	for _, h := range s.options.CallbackHosts {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if utils.IsEmpty(h) {
+			continue
+		}
+		if h == host {
+			return true
+		}
+		if strings.HasPrefix(h, "*.") && strings.HasSuffix(host, h[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *HttpServer) validCallbackURL(v string) error {
+
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || utils.IsEmpty(u.Host) {
+		return fmt.Errorf("callback_url must be http or https URL")
+	}
+	// otherwise callbacks could reach internal services
+	if !s.allowedCallbackHost(u.Hostname()) {
+		return fmt.Errorf("callback_url host %s is not allowed", u.Hostname())
+	}
+	return nil
+}
+
+// postCallback sends event to callback URL, it's signed if identity has a secret
+func (s *HttpServer) postCallback(callbackURL string, e *common.MessageEvent, id *HttpIdentity) error {
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if id != nil && !utils.IsEmpty(id.Secret) {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(HttpAuthHeaderTimestamp, timestamp)
+		req.Header.Set(HttpAuthHeaderSignature, HttpSignature(id.Secret, timestamp, req.Method, req.URL.RequestURI(), body))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("callback responded with %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// notifyCallback posts status changes of the message until its status is final
+func (s *HttpServer) notifyCallback(events <-chan *common.MessageEvent, unsubscribe func(), bot, messageID, callbackURL string, id *HttpIdentity) {
+
+	defer unsubscribe()
+
+	timer := time.NewTimer(httpCallbackTTL)
+	defer timer.Stop()
+
+	ticker := time.NewTicker(httpCallbackCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-timer.C:
+			s.obs.Error("[API] Callback for message %s is expired", messageID)
+			return
+		case <-ticker.C:
+			status, _ := s.executor.GetMessageStatus(bot, messageID)
+			if !status.Final() {
+				continue
+			}
+			if err := s.postCallback(callbackURL, common.NewMessageEvent(bot, messageID, "", status), id); err != nil {
+				s.obs.Error("[API] Callback for message %s failed: %v", messageID, err)
+			}
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if e.Bot != bot || e.ID != messageID {
+				continue
+			}
+			if err := s.postCallback(callbackURL, e, id); err != nil {
+				s.obs.Error("[API] Callback for message %s failed: %v", messageID, err)
+			}
+			if e.Status.Final() {
+				return
+			}
+		}
+	}
+}
+
+// getMessageEvents streams status changes as Server-Sent Events, they can be filtered by bot and message ID
+func (s *HttpServer) getMessageEvents(w http.ResponseWriter, r *http.Request) {
+	s.incRequests(r.Method, r.URL.Path, "")
+
+	if r.Method != http.MethodGet {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	me := s.executor.MessageEvents()
+	if me == nil {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "message events are not tracked", http.StatusInternalServerError)
+		return
+	}
+
+	bot := r.URL.Query().Get("bot")
+	messageID := r.URL.Query().Get("id")
+
+	events, unsubscribe := me.Subscribe(httpEventsBuffer)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	s.incResponses(r.Method, r.URL.Path, "", http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(httpEventsKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if (bot != "" && e.Bot != bot) || (messageID != "" && e.ID != messageID) {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devopsext/chatops/common"
+)
+
+func TestCreateMessageCallback(t *testing.T) {
+	events := make(chan *common.MessageEvent, 10)
+	signatures := make(chan string, 10)
+	callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e common.MessageEvent
+		json.NewDecoder(r.Body).Decode(&e)
+		events <- &e
+		signatures <- r.Header.Get(HttpAuthHeaderSignature)
+	}))
+	defer callback.Close()
+
+	bots := common.NewBots()
+	mockBot := NewMockBot("Slack")
+	mockBot.events = bots.MessageEvents()
+	bots.Add(mockBot)
+
+	server := newTestServerWithOptions(bots, HttpServerOptions{AllowedCmds: []string{"deploy"}, CallbackHosts: []string{"127.0.0.1"}})
+	defer server.Stop()
+
+	body, _ := json.Marshal(CreateMessageRequest{Bot: "Slack", Channel: "C1", Command: "deploy", UserID: "u1", CallbackURL: callback.URL})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/message", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	server.createMessage(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, rec.Code, rec.Body.String())
+	}
+	var resp CreateMessageResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+
+	for _, status := range []common.MessageStatus{common.MessageStatusPending, common.MessageStatusDelivered} {
+		select {
+		case e := <-events:
+			if e.ID != resp.ID || e.Status != status {
+				t.Errorf("expected %s event for %s, got %+v", status, resp.ID, e)
+			}
+			// anonymous request has no secret to sign callbacks with
+			if s := <-signatures; s != "" {
+				t.Errorf("expected unsigned callback, got %s", s)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected %s event to be posted", status)
+		}
+	}
+}
+
+func TestCreateMessageInvalidCallback(t *testing.T) {
+	bots := common.NewBots()
+	bots.Add(NewMockBot("Slack"))
+	server := newTestServerWithAllowedCmds(bots, []string{"deploy"})
+
+	body, _ := json.Marshal(CreateMessageRequest{Bot: "Slack", Channel: "C1", Command: "deploy", CallbackURL: "ftp://host/x"})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/message", bytes.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	server.createMessage(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestCreateMessageCallbackHosts(t *testing.T) {
+	bots := common.NewBots()
+	bots.Add(NewMockBot("Slack"))
+	server := newTestServerWithOptions(bots, HttpServerOptions{AllowedCmds: []string{"deploy"}, CallbackHosts: []string{"*.example.com"}})
+	defer server.Stop()
+
+	for url, expected := range map[string]int{
+		"https://hooks.example.com/x":   http.StatusCreated,
+		"https://example.com.evil.io/x": http.StatusBadRequest,
+		"http://169.254.169.254/latest": http.StatusBadRequest,
+	} {
+		body, _ := json.Marshal(CreateMessageRequest{Bot: "Slack", Channel: "C1", Command: "deploy", CallbackURL: url})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/message", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		server.createMessage(rec, req)
+
+		if rec.Code != expected {
+			t.Errorf("expected status %d for %s, got %d: %s", expected, url, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestGetMessageEvents(t *testing.T) {
+	bots := common.NewBots()
+	server := newTestServer(bots)
+	defer server.Stop()
+
+	ts := httptest.NewServer(http.HandlerFunc(server.getMessageEvents))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?bot=Slack&id=m1")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected event stream, got %s", ct)
+	}
+
+	// handler subscribes before headers are sent, so events aren't lost
+	bots.MessageEvents().Publish(common.NewMessageEvent("Slack", "m2", "C1", common.MessageStatusDelivered))
+	bots.MessageEvents().Publish(common.NewMessageEvent("Slack", "m1", "C1", common.MessageStatusWaitingApproval))
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var e common.MessageEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+			t.Fatalf("failed to decode event: %v", err)
+		}
+		if e.ID != "m1" || e.Status != common.MessageStatusWaitingApproval {
+			t.Errorf("unexpected event %+v", e)
+		}
+		return
+	}
+}
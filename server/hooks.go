@@ -0,0 +1,252 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/devopsext/chatops/common"
+	"github.com/devopsext/chatops/processor"
+	toolsRender "github.com/devopsext/tools/render"
+	"github.com/devopsext/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// HttpHook turns webhook of other system into a command, template renders YAML of HttpHookCommand
+// from name, body, headers and query of the request. Hook without secret is authenticated as other API calls.
+type HttpHook struct {
+	Name     string
+	Secret   string
+	Header   string
+	HMAC     bool `yaml:"hmac"`
+	Template string
+	template *toolsRender.TextTemplate
+}
+
+type HttpHooksConfig struct {
+	Hooks []*HttpHook
+}
+
+type HttpHooks struct {
+	hooks map[string]*HttpHook
+}
+
+type HttpHookCommand struct {
+	Bot     string
+	Channel string
+	Command string
+	User    string
+	Params  map[string]interface{}
+}
+
+const (
+	HttpHookHeaderSecret = "X-Chatops-Hook-Secret"
+
+	httpHookMaxBody = 1 << 20
+)
+
+// verify checks secret in the header, or HMAC of the body like GitHub does with X-Hub-Signature-256
+func (hh *HttpHook) verify(r *http.Request, body []byte) bool {
+
+	header := hh.Header
+	if utils.IsEmpty(header) {
+		header = HttpHookHeaderSecret
+	}
+	value := strings.TrimSpace(r.Header.Get(header))
+	if utils.IsEmpty(value) {
+		return false
+	}
+
+	if hh.HMAC {
+		mac := hmac.New(sha256.New, []byte(hh.Secret))
+		mac.Write(body)
+		expected := hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(strings.TrimPrefix(value, httpAuthSignaturePrefix)), []byte(expected))
+	}
+
+	value = strings.TrimPrefix(value, httpAuthBearerPrefix)
+	return subtle.ConstantTimeCompare([]byte(value), []byte(hh.Secret)) == 1
+}
+
+func (hh *HttpHook) command(r *http.Request, body []byte) (*HttpHookCommand, error) {
+
+	var data interface{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &data); err != nil {
+			return nil, fmt.Errorf("body is not JSON: %s", err)
+		}
+	}
+
+	headers := make(map[string]string)
+	for k := range r.Header {
+		headers[k] = r.Header.Get(k)
+	}
+	query := make(map[string]string)
+	for k := range r.URL.Query() {
+		query[k] = r.URL.Query().Get(k)
+	}
+
+	obj := map[string]interface{}{
+		"name":    hh.Name,
+		"body":    data,
+		"headers": headers,
+		"query":   query,
+	}
+
+	b, err := hh.template.RenderObject(obj)
+	if err != nil {
+		return nil, fmt.Errorf("template error: %s", common.TemplateShortError(err))
+	}
+
+	var c HttpHookCommand
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("template result is not YAML: %s", err)
+	}
+	return &c, nil
+}
+
+func (hs *HttpHooks) Find(name string) *HttpHook {
+	if hs == nil {
+		return nil
+	}
+	return hs.hooks[name]
+}
+
+func NewHttpHooks(hooks string, observability *common.Observability) (*HttpHooks, error) {
+
+	var config HttpHooksConfig
+	_, err := common.LoadYaml(hooks, &config)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load hooks: %s", err)
+	}
+
+	hs := &HttpHooks{hooks: make(map[string]*HttpHook)}
+	for i, hook := range config.Hooks {
+		if hook == nil || utils.IsEmpty(hook.Name) {
+			return nil, fmt.Errorf("hook %d has no name", i)
+		}
+		if _, ok := hs.hooks[hook.Name]; ok {
+			return nil, fmt.Errorf("hook %s is defined twice", hook.Name)
+		}
+		if utils.IsEmpty(hook.Template) {
+			return nil, fmt.Errorf("hook %s has no template", hook.Name)
+		}
+		if hook.HMAC && utils.IsEmpty(hook.Secret) {
+			return nil, fmt.Errorf("hook %s needs secret for HMAC", hook.Name)
+		}
+
+		// template has functions of command templates, ones which need bot or message fail as hook has none
+		hook.template, err = processor.NewExecutorTemplate(fmt.Sprintf("hook-%s", hook.Name), hook.Template, &processor.DefaultExecutor{}, observability)
+		if err != nil {
+			return nil, fmt.Errorf("hook %s has invalid template: %s", hook.Name, err)
+		}
+		hs.hooks[hook.Name] = hook
+	}
+	return hs, nil
+}
+
+func (s *HttpServer) runHook(w http.ResponseWriter, r *http.Request, hook *HttpHook) {
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, httpHookMaxBody))
+	if err != nil {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "couldn't read body", http.StatusBadRequest)
+		return
+	}
+
+	if !utils.IsEmpty(hook.Secret) && !hook.verify(r, body) {
+		s.obs.Error("[API] Hook %s has invalid secret from %s", hook.Name, r.RemoteAddr)
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	c, err := hook.command(r, body)
+	if err != nil {
+		s.obs.Error("[API] Hook %s failed: %v", hook.Name, err)
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// template decides that there is nothing to do
+	if utils.IsEmpty(strings.TrimSpace(c.Command)) {
+		s.obs.Debug("[API] Hook %s has no command", hook.Name)
+		s.incResponses(r.Method, r.URL.Path, "", http.StatusNoContent)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	cmd := common.GetCommandName(c.Command)
+	id := HttpIdentityFromContext(r.Context())
+
+	if !common.CommandInSlice(c.Command, s.allowedCmds(id)) {
+		s.obs.Error("[API] Hook %s command is not allowed: identity=%s, command=%s", hook.Name, s.identityName(id), c.Command)
+		s.incErrors(r.Method, r.URL.Path, cmd)
+		s.writeErrorWithMetrics(w, r, cmd, "command not allowed", http.StatusForbidden)
+		return
+	}
+
+	if utils.IsEmpty(c.Bot) || utils.IsEmpty(c.Channel) {
+		s.incErrors(r.Method, r.URL.Path, cmd)
+		s.writeErrorWithMetrics(w, r, cmd, "bot and channel are required", http.StatusBadRequest)
+		return
+	}
+
+	if utils.IsEmpty(c.User) && id != nil {
+		c.User = id.User
+	}
+
+	s.obs.Info("[API] Hook %s is executing command: identity=%s, bot=%s, channel=%s, command=%s, user=%s", hook.Name, s.identityName(id), c.Bot, c.Channel, c.Command, c.User)
+
+	var params common.ExecuteParams
+	if len(c.Params) > 0 {
+		params = c.Params
+	}
+
+	msg, err := s.executor.ExecuteCommand(c.Bot, c.Channel, c.Command, c.User, params)
+	if err != nil {
+		s.obs.Error("[API] Hook %s command execution failed: %v", hook.Name, err)
+		s.incErrors(r.Method, r.URL.Path, cmd)
+		s.writeErrorWithMetrics(w, r, cmd, err.Error(), executeErrorStatus(err))
+		return
+	}
+
+	if msg == nil {
+		s.writeJSONWithMetrics(w, r, cmd, ErrorResponse{Error: "command produced no message"}, http.StatusOK)
+		return
+	}
+	s.writeJSONWithMetrics(w, r, cmd, CreateMessageResponse{ID: msg.ID()}, http.StatusCreated)
+}
+
+// postHook runs hook by its name, hooks with secret don't need API credentials, as other systems can't send them
+func (s *HttpServer) postHook(w http.ResponseWriter, r *http.Request) {
+	s.incRequests(r.Method, r.URL.Path, "")
+
+	if r.Method != http.MethodPost {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hook := s.hooks.Find(r.PathValue("name"))
+	if hook == nil {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "hook not found", http.StatusNotFound)
+		return
+	}
+
+	run := func(w http.ResponseWriter, r *http.Request) {
+		s.runHook(w, r, hook)
+	}
+	if utils.IsEmpty(hook.Secret) {
+		run = s.authenticated(run)
+	}
+	run(w, r)
+}
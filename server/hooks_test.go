@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/devopsext/chatops/common"
+)
+
+const testHooks = `
+hooks:
+  - name: github
+    secret: github-secret
+    header: X-Hub-Signature-256
+    hmac: true
+    template: |
+      {{ if eq .body.action "published" }}
+      bot: Slack
+      channel: C1
+      command: release
+      params:
+        tag: {{ .body.release.tag_name }}
+      {{ end }}
+  - name: grafana
+    secret: grafana-secret
+    header: Authorization
+    template: |
+      bot: Slack
+      channel: {{ .query.channel }}
+      command: deploy
+  - name: open
+    template: |
+      bot: Slack
+      channel: C1
+      command: release
+`
+
+func TestPostHook(t *testing.T) {
+	mockBot := NewMockBot("Slack")
+	bots := common.NewBots()
+	bots.Add(mockBot)
+
+	server := newTestServerWithOptions(bots, HttpServerOptions{AllowedCmds: []string{"release"}, Hooks: testHooks, Identities: testIdentities})
+	defer server.Stop()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/hooks/{name}", server.postHook)
+
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, []byte("github-secret"))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	published := `{"action":"published","release":{"tag_name":"v1.2.0"}}`
+	edited := `{"action":"edited","release":{"tag_name":"v1.2.0"}}`
+
+	tests := []struct {
+		name           string
+		url            string
+		body           string
+		headers        map[string]string
+		expectedStatus int
+	}{
+		{"signed", "/api/v1/hooks/github", published, map[string]string{"X-Hub-Signature-256": sign(published)}, http.StatusCreated},
+		{"nothing to do", "/api/v1/hooks/github", edited, map[string]string{"X-Hub-Signature-256": sign(edited)}, http.StatusNoContent},
+		{"wrong signature", "/api/v1/hooks/github", published, map[string]string{"X-Hub-Signature-256": sign(edited)}, http.StatusUnauthorized},
+		{"not JSON", "/api/v1/hooks/github", "x", map[string]string{"X-Hub-Signature-256": sign("x")}, http.StatusBadRequest},
+		{"command not allowed", "/api/v1/hooks/grafana?channel=C2", "{}", map[string]string{"Authorization": "Bearer grafana-secret"}, http.StatusForbidden},
+		{"no secret", "/api/v1/hooks/grafana", "{}", nil, http.StatusUnauthorized},
+		{"hook without secret needs identity", "/api/v1/hooks/open", "{}", nil, http.StatusUnauthorized},
+		{"hook without secret with identity", "/api/v1/hooks/open", "{}", map[string]string{"Authorization": "Bearer ci-token"}, http.StatusForbidden},
+		{"unknown hook", "/api/v1/hooks/jira", "{}", nil, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.url, bytes.NewReader([]byte(tt.body)))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	mockBot.Reset()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/hooks/github", bytes.NewReader([]byte(published)))
+	req.Header.Set("X-Hub-Signature-256", sign(published))
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	channel, cmd := mockBot.GetLastCommand()
+	if channel != "C1" || cmd != "release" || mockBot.lastParams["tag"] != "v1.2.0" {
+		t.Errorf("unexpected command %s in %s with %v", cmd, channel, mockBot.lastParams)
+	}
+}
+
+func TestHooksInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		hooks string
+	}{
+		{"no name", "hooks:\n  - template: x"},
+		{"no template", "hooks:\n  - name: x"},
+		{"twice", "hooks:\n  - name: x\n    template: x\n  - name: x\n    template: y"},
+		{"hmac without secret", "hooks:\n  - name: x\n    template: x\n    hmac: true"},
+		{"invalid template", "hooks:\n  - name: x\n    template: '{{ .x'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewHttpHooks(tt.hooks, newTestObservability()); err == nil {
+				t.Errorf("expected error for hooks %q", tt.hooks)
+			}
+		})
+	}
+}
+
+func TestHooksExecutorFunctions(t *testing.T) {
+	// unknown functions would fail to parse
+	hooks := "hooks:\n  - name: x\n    template: '{{ if isCancelled }}{{ findMessagesByTag \"k\" \"v\" }}{{ end }}'"
+	if _, err := NewHttpHooks(hooks, newTestObservability()); err != nil {
+		t.Errorf("expected hook with chatops functions, got %v", err)
+	}
+}
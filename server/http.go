@@ -1,10 +1,18 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"slices"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/devopsext/chatops/common"
 	sre "github.com/devopsext/sre/common"
@@ -13,13 +21,31 @@ import (
 type HttpServerOptions struct {
 	Listen      string
 	AllowedCmds []string
+	Identities  string
+	// hosts which callbacks can be posted to, *.example.com matches subdomains, no callbacks if empty
+	CallbackHosts []string
+	ReplayWindow  string
+	TLSCert       string
+	TLSKey        string
+	TLSClientCA   string
+	Alertmanager  string
+	Hooks         string
 }
 
+const (
+	httpMaxWait      = 5 * time.Minute
+	httpWaitInterval = 200 * time.Millisecond
+)
+
 type CreateMessageRequest struct {
 	Bot     string `json:"bot"`     // bot name (e.g., "Slack")
 	Channel string `json:"channel"` // target channel
 	Command string `json:"command"` // command to execute (no leading slash)
 	UserID  string `json:"user_id"` // user triggering the command (UID or email for slack)
+	// params are set instead of form fields, they're checked against command fields
+	Params map[string]interface{} `json:"params,omitempty"`
+	// status changes of the message are posted to callback URL
+	CallbackURL string `json:"callback_url,omitempty"`
 }
 
 type CreateMessageResponse struct {
@@ -31,16 +57,45 @@ type GetMessageStatusResponse struct {
 	Status common.MessageStatus `json:"status"`
 }
 
+type MessageResultAttachment struct {
+	Title string                `json:"title,omitempty"`
+	Text  string                `json:"text,omitempty"`
+	Type  common.AttachmentType `json:"type,omitempty"`
+	Data  []byte                `json:"data,omitempty"` // base64 encoded
+}
+
+type MessageResultAction struct {
+	Name  string `json:"name"`
+	Label string `json:"label,omitempty"`
+	Style string `json:"style,omitempty"`
+}
+
+type MessageResultResponse struct {
+	ID          string                     `json:"id"`
+	Status      common.MessageStatus       `json:"status"`
+	Text        string                     `json:"text,omitempty"`
+	Attachments []*MessageResultAttachment `json:"attachments,omitempty"`
+	Actions     []*MessageResultAction     `json:"actions,omitempty"`
+	Error       string                     `json:"error,omitempty"`
+}
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
 type HttpServer struct {
-	options  HttpServerOptions
-	obs      *common.Observability
-	executor common.CommandExecutor
-	server   *http.Server
-	meter    *sre.Metrics
+	options      HttpServerOptions
+	obs          *common.Observability
+	executor     common.CommandExecutor
+	server       *http.Server
+	meter        *sre.Metrics
+	auth         *HttpAuth
+	tls          *tls.Config
+	client       *http.Client
+	alertmanager *Alertmanager
+	hooks        *HttpHooks
+	ctx          context.Context
+	cancel       context.CancelFunc
 }
 
 func (s *HttpServer) incRequests(method, url, cmd string) {
@@ -80,6 +135,136 @@ func (s *HttpServer) incResponses(method, url, cmd string, statusCode int) {
 	s.meter.Counter("http", "in_responses_total", "Count of all HTTP responses", labels, "server", "http").Inc()
 }
 
+// authenticated lets requests through only if they have valid credentials, when identities are configured
+func (s *HttpServer) authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if !s.auth.Enabled() {
+			next(w, r)
+			return
+		}
+
+		id, err := s.auth.Authenticate(r)
+		if err != nil {
+			s.obs.Error("[API] Unauthorized request %s %s from %s: %v", r.Method, r.URL.Path, r.RemoteAddr, err)
+			s.incErrors(r.Method, r.URL.Path, "")
+			s.writeErrorWithMetrics(w, r, "", "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), httpIdentityKey{}, id)))
+	}
+}
+
+// allowedCmds of identity replace server ones
+func (s *HttpServer) allowedCmds(id *HttpIdentity) []string {
+
+	if id != nil && len(id.AllowedCmds) > 0 {
+		return id.AllowedCmds
+	}
+	return s.options.AllowedCmds
+}
+
+func (s *HttpServer) identityName(id *HttpIdentity) string {
+
+	if id == nil {
+		return "anonymous"
+	}
+	return id.Name
+}
+
+// wait is limited, so requests don't hang until server timeouts
+func (s *HttpServer) waitDuration(r *http.Request) (time.Duration, error) {
+
+	v := r.URL.Query().Get("wait")
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("wait query parameter must be a positive duration")
+	}
+	if d > httpMaxWait {
+		d = httpMaxWait
+	}
+	return d, nil
+}
+
+// waitResult polls message result until its status is final, wait is over or request is gone
+func (s *HttpServer) waitResult(ctx context.Context, bot, id string, wait time.Duration) (*common.MessageResult, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	ticker := time.NewTicker(httpWaitInterval)
+	defer ticker.Stop()
+
+	for {
+		result, err := s.executor.GetMessageResult(bot, id)
+		if err != nil {
+			return nil, err
+		}
+		if result != nil && result.Final() {
+			return result, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *HttpServer) resultResponse(id string, result *common.MessageResult) MessageResultResponse {
+
+	resp := MessageResultResponse{
+		ID:     id,
+		Status: common.MessageStatusNotFound,
+	}
+	if result == nil {
+		return resp
+	}
+
+	resp.Status = result.Status
+	resp.Text = result.Text
+	resp.Error = result.Error
+	for _, a := range result.Attachments {
+		if a == nil {
+			continue
+		}
+		resp.Attachments = append(resp.Attachments, &MessageResultAttachment{
+			Title: a.Title,
+			Text:  a.Text,
+			Type:  a.Type,
+			Data:  a.Data,
+		})
+	}
+	for _, a := range result.Actions {
+		if a == nil {
+			continue
+		}
+		resp.Actions = append(resp.Actions, &MessageResultAction{
+			Name:  a.Name(),
+			Label: a.Label(),
+			Style: a.Style(),
+		})
+	}
+	return resp
+}
+
+// executeErrorStatus maps errors of command execution, params don't match fields or policy doesn't permit them or freezes them
+func executeErrorStatus(err error) int {
+
+	var pe *common.ParamsError
+	switch {
+	case errors.As(err, &pe):
+		return http.StatusBadRequest
+	case errors.Is(err, common.ErrCommandNotPermitted), errors.Is(err, common.ErrCommandFrozen):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
 func (s *HttpServer) createMessage(w http.ResponseWriter, r *http.Request) {
 
 	if r.Method != http.MethodPost {
@@ -88,6 +273,13 @@ func (s *HttpServer) createMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	wait, err := s.waitDuration(r)
+	if err != nil {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var req CreateMessageRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		s.incErrors(r.Method, r.URL.Path, "")
@@ -96,7 +288,10 @@ func (s *HttpServer) createMessage(w http.ResponseWriter, r *http.Request) {
 	}
 	s.incRequests(r.Method, r.URL.Path, common.GetCommandName(req.Command))
 
-	if !common.CommandInSlice(req.Command, s.options.AllowedCmds) {
+	id := HttpIdentityFromContext(r.Context())
+
+	if !common.CommandInSlice(req.Command, s.allowedCmds(id)) {
+		s.obs.Error("[API] Command is not allowed: identity=%s, command=%s", s.identityName(id), req.Command)
 		s.incErrors(r.Method, r.URL.Path, common.GetCommandName(req.Command))
 		s.writeErrorWithMetrics(w, r, common.GetCommandName(req.Command), "command not allowed", http.StatusForbidden)
 		return
@@ -108,23 +303,72 @@ func (s *HttpServer) createMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	s.obs.Info("[API] Executing command: bot=%s, channel=%s, command=%s, user=%s", req.Bot, req.Channel, req.Command, req.UserID)
+	if req.CallbackURL != "" {
+		if err := s.validCallbackURL(req.CallbackURL); err != nil {
+			s.incErrors(r.Method, r.URL.Path, common.GetCommandName(req.Command))
+			s.writeErrorWithMetrics(w, r, common.GetCommandName(req.Command), err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// otherwise identity could execute commands as another user
+	if id != nil && id.User != "" {
+		if req.UserID != "" && req.UserID != id.User {
+			s.incErrors(r.Method, r.URL.Path, common.GetCommandName(req.Command))
+			s.writeErrorWithMetrics(w, r, common.GetCommandName(req.Command), "identity can execute commands only as its user", http.StatusForbidden)
+			return
+		}
+		req.UserID = id.User
+	}
+
+	// subscribe before execution, as statuses are changed while command is executed
+	var events <-chan *common.MessageEvent
+	unsubscribe := func() {}
+	if me := s.executor.MessageEvents(); req.CallbackURL != "" && me != nil {
+		events, unsubscribe = me.Subscribe(httpEventsBuffer)
+	}
 
-	msg, err := s.executor.ExecuteCommand(req.Bot, req.Channel, req.Command, req.UserID)
+	s.obs.Info("[API] Executing command: identity=%s, bot=%s, channel=%s, command=%s, user=%s", s.identityName(id), req.Bot, req.Channel, req.Command, req.UserID)
+
+	msg, err := s.executor.ExecuteCommand(req.Bot, req.Channel, req.Command, req.UserID, req.Params)
 	if err != nil {
+		unsubscribe()
 		s.obs.Error("[API] Command execution failed: %v", err)
 		s.incErrors(r.Method, r.URL.Path, common.GetCommandName(req.Command))
-		s.writeErrorWithMetrics(w, r, common.GetCommandName(req.Command), err.Error(), http.StatusInternalServerError)
+		s.writeErrorWithMetrics(w, r, common.GetCommandName(req.Command), err.Error(), executeErrorStatus(err))
 		return
 	}
 
 	if msg == nil {
+		unsubscribe()
 		s.obs.Info("[API] Command produced no trackable message")
 		s.writeJSONWithMetrics(w, r, common.GetCommandName(req.Command), ErrorResponse{Error: "command produced no message"}, http.StatusOK)
 		return
 	}
 
-	s.obs.Info("[API] Command executed, message ID: %s", msg.ID())
+	s.obs.Info("[API] Command executed: identity=%s, command=%s, message ID: %s", s.identityName(id), req.Command, msg.ID())
+
+	if events != nil {
+		go s.notifyCallback(events, unsubscribe, req.Bot, msg.ID(), req.CallbackURL, id)
+	}
+
+	if wait > 0 {
+		result, err := s.waitResult(r.Context(), req.Bot, msg.ID(), wait)
+		if err != nil {
+			s.obs.Error("[API] Failed to get message result: %v", err)
+			s.incErrors(r.Method, r.URL.Path, common.GetCommandName(req.Command))
+			s.writeErrorWithMetrics(w, r, common.GetCommandName(req.Command), err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// command is still running or waiting for approval, so caller should poll it
+		status := http.StatusOK
+		if result == nil || !result.Final() {
+			status = http.StatusAccepted
+		}
+		s.writeJSONWithMetrics(w, r, common.GetCommandName(req.Command), s.resultResponse(msg.ID(), result), status)
+		return
+	}
 
 	resp := CreateMessageResponse{ID: msg.ID()}
 	s.writeJSONWithMetrics(w, r, common.GetCommandName(req.Command), resp, http.StatusCreated)
@@ -168,6 +412,198 @@ func (s *HttpServer) getMessageStatus(w http.ResponseWriter, r *http.Request) {
 	s.writeJSONWithMetrics(w, r, "", resp, http.StatusOK)
 }
 
+func (s *HttpServer) getMessageResult(w http.ResponseWriter, r *http.Request) {
+	s.incRequests(r.Method, r.URL.Path, "")
+
+	if r.Method != http.MethodGet {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bot := r.URL.Query().Get("bot")
+	id := r.URL.Query().Get("id")
+
+	if bot == "" || id == "" {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "bot and id query parameters are required", http.StatusBadRequest)
+		return
+	}
+
+	result, err := s.executor.GetMessageResult(bot, id)
+	if err != nil {
+		s.obs.Error("[API] Failed to get message result: %v", err)
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if result == nil {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "message not found", http.StatusNotFound)
+		return
+	}
+	s.writeJSONWithMetrics(w, r, "", s.resultResponse(id, result), http.StatusOK)
+}
+
+// deleteMessage cancels command of the message which is running or waits for approval
+func (s *HttpServer) deleteMessage(w http.ResponseWriter, r *http.Request) {
+	s.incRequests(r.Method, r.URL.Path, "")
+
+	if r.Method != http.MethodDelete {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bot := r.URL.Query().Get("bot")
+	ID := r.PathValue("id")
+
+	if bot == "" {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "bot query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	id := HttpIdentityFromContext(r.Context())
+
+	// bot checks user is requester or approver, so it can't be anyone else
+	if id == nil || id.User == "" {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "cancel needs identity with user", http.StatusForbidden)
+		return
+	}
+
+	result, err := s.executor.GetMessageResult(bot, ID)
+	if err != nil {
+		s.obs.Error("[API] Failed to get message result: %v", err)
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if result == nil {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", common.ErrMessageNotFound.Error(), http.StatusNotFound)
+		return
+	}
+
+	// identities can cancel only commands they can run, whatever state the message is in
+	cmd := common.GetCommandName(result.Command)
+	if !common.CommandInSlice(result.Command, s.allowedCmds(id)) {
+		s.obs.Error("[API] Cancel of command is not allowed: identity=%s, command=%s", s.identityName(id), result.Command)
+		s.incErrors(r.Method, r.URL.Path, cmd)
+		s.writeErrorWithMetrics(w, r, cmd, "command not allowed", http.StatusForbidden)
+		return
+	}
+
+	s.obs.Info("[API] Cancel message: identity=%s, bot=%s, id=%s, user=%s", s.identityName(id), bot, ID, id.User)
+
+	err = s.executor.Cancel(bot, ID, id.User)
+	if err != nil {
+		s.obs.Error("[API] Cancel message failed: %v", err)
+		s.incErrors(r.Method, r.URL.Path, cmd)
+
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, common.ErrMessageNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, common.ErrMessageNotCancellable):
+			status = http.StatusConflict
+		case errors.Is(err, common.ErrCancelNotPermitted):
+			status = http.StatusForbidden
+		}
+		s.writeErrorWithMetrics(w, r, cmd, err.Error(), status)
+		return
+	}
+	s.writeJSONWithMetrics(w, r, cmd, GetMessageStatusResponse{ID: ID, Status: common.MessageStatusCancelled}, http.StatusOK)
+}
+
+func (s *HttpServer) getRunbookStatus(w http.ResponseWriter, r *http.Request) {
+	s.incRequests(r.Method, r.URL.Path, "")
+
+	if r.Method != http.MethodGet {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "id query parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	run, err := s.executor.GetRunbookRun(id)
+	if err != nil {
+		s.obs.Error("[API] Failed to get runbook run: %v", err)
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if run == nil {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "runbook run not found", http.StatusNotFound)
+		return
+	}
+	s.writeJSONWithMetrics(w, r, "", run, http.StatusOK)
+}
+
+func (s *HttpServer) getRunbookRuns(w http.ResponseWriter, r *http.Request) {
+	s.incRequests(r.Method, r.URL.Path, "")
+
+	if r.Method != http.MethodGet {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 0 {
+			s.incErrors(r.Method, r.URL.Path, "")
+			s.writeErrorWithMetrics(w, r, "", "limit query parameter must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+
+	runs, err := s.executor.ListRunbookRuns(r.URL.Query().Get("name"), limit)
+	if err != nil {
+		s.obs.Error("[API] Failed to list runbook runs: %v", err)
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.writeJSONWithMetrics(w, r, "", runs, http.StatusOK)
+}
+
+func (s *HttpServer) getCommands(w http.ResponseWriter, r *http.Request) {
+	s.incRequests(r.Method, r.URL.Path, "")
+
+	if r.Method != http.MethodGet {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	commands, err := s.executor.ListCommands()
+	if err != nil {
+		s.obs.Error("[API] Failed to list commands: %v", err)
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	group := r.URL.Query().Get("group")
+	if group != "" {
+		commands = slices.DeleteFunc(commands, func(c *common.CommandInfo) bool { return c.Group != group })
+	}
+	s.writeJSONWithMetrics(w, r, "", commands, http.StatusOK)
+}
+
 func (s *HttpServer) writeJSON(w http.ResponseWriter, data any, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -188,6 +624,40 @@ func (s *HttpServer) writeErrorWithMetrics(w http.ResponseWriter, r *http.Reques
 	s.writeError(w, message, status)
 }
 
+func (s *HttpServer) TLS() bool {
+	return s.options.TLSCert != "" && s.options.TLSKey != ""
+}
+
+// tlsConfig verifies client certificates against CA bundle, certificates are required if there is no other way to authenticate
+func (s *HttpServer) tlsConfig() (*tls.Config, error) {
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if s.options.TLSClientCA == "" {
+		return config, nil
+	}
+	if !s.TLS() {
+		return nil, fmt.Errorf("client CA requires TLS cert and key")
+	}
+
+	pem, err := os.ReadFile(s.options.TLSClientCA)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", s.options.TLSClientCA)
+	}
+	config.ClientCAs = pool
+
+	config.ClientAuth = tls.RequireAndVerifyClientCert
+	if s.auth.Enabled() {
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
 func (s *HttpServer) Start(wg *sync.WaitGroup) {
 	if s.options.Listen == "" {
 		return
@@ -196,18 +666,32 @@ func (s *HttpServer) Start(wg *sync.WaitGroup) {
 	wg.Add(1)
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/api/v1/message", s.createMessage)
-	mux.HandleFunc("/api/v1/message/status", s.getMessageStatus)
+	for _, route := range s.routes() {
+		handler := route.handler
+		if !route.public {
+			handler = s.authenticated(handler)
+		}
+		mux.HandleFunc(route.path, handler)
+	}
 
 	s.server = &http.Server{
-		Addr:    s.options.Listen,
-		Handler: mux,
+		Addr:      s.options.Listen,
+		Handler:   mux,
+		TLSConfig: s.tls,
 	}
 
 	go func() {
 		defer wg.Done()
-		s.obs.Info("HTTP server starting on %s", s.options.Listen)
-		if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+
+		var err error
+		if s.TLS() {
+			s.obs.Info("HTTPS server starting on %s", s.options.Listen)
+			err = s.server.ListenAndServeTLS(s.options.TLSCert, s.options.TLSKey)
+		} else {
+			s.obs.Info("HTTP server starting on %s", s.options.Listen)
+			err = s.server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			s.obs.Error("HTTP server error: %v", err)
 		}
 	}()
@@ -218,13 +702,46 @@ func (s *HttpServer) Stop() {
 		s.obs.Info("HTTP server stopping...")
 		s.server.Close()
 	}
+	if s.auth != nil {
+		s.auth.Stop()
+	}
+	s.alertmanager.Stop()
+	s.cancel()
 }
 
-func NewHttpServer(options HttpServerOptions, obs *common.Observability, executor common.CommandExecutor) *HttpServer {
-	return &HttpServer{
+func NewHttpServer(options HttpServerOptions, obs *common.Observability, executor common.CommandExecutor) (*HttpServer, error) {
+
+	auth, err := NewHttpAuth(options.Identities, options.ReplayWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &HttpServer{
 		options:  options,
 		obs:      obs,
 		executor: executor,
 		meter:    obs.Metrics(),
+		auth:     auth,
+		client:   &http.Client{Timeout: httpCallbackTimeout},
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	s.alertmanager, err = NewAlertmanager(options.Alertmanager)
+	if err != nil {
+		s.Stop()
+		return nil, err
+	}
+
+	s.hooks, err = NewHttpHooks(options.Hooks, obs)
+	if err != nil {
+		s.Stop()
+		return nil, err
+	}
+
+	s.tls, err = s.tlsConfig()
+	if err != nil {
+		s.Stop()
+		return nil, err
 	}
+	return s, nil
 }
@@ -22,9 +22,23 @@ They do NOT test:
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -65,12 +79,28 @@ type MockBot struct {
 	lastChannel   string
 	lastCommand   string
 	lastUser      common.User
+	lastParams    common.ExecuteParams
 	commandErr    error
 	commandDelay  time.Duration
 	messageStatus common.MessageStatus
+	messageResult *common.MessageResult
+	events        *common.MessageEvents
+	tags          map[string]map[string]string
+	updates       map[string]string
+	approvals     []*common.PendingApproval
+	decisions     map[string]string
+	running       []*MockRun
+	cancelled     map[string]string
 	mu            sync.Mutex
 }
 
+// MockRun is running command of the message
+type MockRun struct {
+	id      string
+	command string
+	user    string
+}
+
 func NewMockBot(name string) *MockBot {
 	return &MockBot{name: name, messageStatus: common.MessageStatusDelivered}
 }
@@ -87,22 +117,22 @@ func (b *MockBot) ClearActions(channel, ID string) error
 func (b *MockBot) PostMessage(channel string, message string, attachments []*common.Attachment, actions []common.Action, user common.User, parent common.Message, response common.Response) (string, error) {
 	return "", nil
 }
-func (b *MockBot) DeleteMessage(channel, ID string) error                      { return nil }
-func (b *MockBot) ReadMessage(channel, ID, threadID string) (string, error)    { return "", nil }
-func (b *MockBot) ReadThread(channel, threadID string) ([]string, error)       { return nil, nil }
-func (b *MockBot) UpdateMessage(channel, ID, message string) error             { return nil }
-func (b *MockBot) TagMessage(channel, ID string, tags map[string]string) error { return nil }
-func (b *MockBot) FindMessagesByTag(tagKey, tagValue string) map[string]string { return nil }
+func (b *MockBot) DeleteMessage(channel, ID string) error                   { return nil }
+func (b *MockBot) ReadMessage(channel, ID, threadID string) (string, error) { return "", nil }
+func (b *MockBot) ReadThread(channel, threadID string) ([]string, error)    { return nil, nil }
 func (b *MockBot) SendImage(channelID, threadTS string, fileContent []byte, filename, initialComment string) error {
 	return nil
 }
 func (b *MockBot) AddDivider(channel, ID string) error { return nil }
+func (b *MockBot) AskApproval(channel, message string, approval common.Approval, user common.User, parent common.Message, callback common.ApprovalFunc) (string, error) {
+	return "", nil
+}
 func (b *MockBot) LookupUser(identifier string) common.User {
 	// Return a mock user with all commands allowed for testing
 	return common.NewGenericUser(identifier, identifier, "", nil)
 }
 
-func (b *MockBot) Command(channel, text string, user common.User, parent common.Message, response common.Response) (common.Message, error) {
+func (b *MockBot) Command(channel, text string, params common.ExecuteParams, user common.User, parent common.Message, response common.Response) (common.Message, error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -114,6 +144,7 @@ func (b *MockBot) Command(channel, text string, user common.User, parent common.
 	b.lastChannel = channel
 	b.lastCommand = text
 	b.lastUser = user
+	b.lastParams = params
 
 	if b.commandErr != nil {
 		return nil, b.commandErr
@@ -126,9 +157,118 @@ func (b *MockBot) Command(channel, text string, user common.User, parent common.
 		caller:    user,
 		channelID: channel,
 	}
+	b.events.Publish(common.NewMessageEvent(b.name, msg.id, channel, common.MessageStatusPending))
+	b.events.Publish(common.NewMessageEvent(b.name, msg.id, channel, b.messageStatus))
 	return msg, nil
 }
 
+func (b *MockBot) UpdateMessage(channel, ID, message string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.updates == nil {
+		b.updates = make(map[string]string)
+	}
+	b.updates[channel+"/"+ID] = message
+	return nil
+}
+
+func (b *MockBot) PendingApprovals() []*common.PendingApproval {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*common.PendingApproval{}, b.approvals...)
+}
+
+// Approve records decisions as "approved by user: reason", requester can't approve own request
+func (b *MockBot) Approve(messageID string, approved bool, user common.User, reason string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, a := range b.approvals {
+		if a.ID != messageID {
+			continue
+		}
+		if a.User == user.ID() {
+			return common.ErrApprovalSelf
+		}
+		if b.decisions == nil {
+			b.decisions = make(map[string]string)
+		}
+		decision := "rejected"
+		if approved {
+			decision = "approved"
+		}
+		b.decisions[messageID] = fmt.Sprintf("%s by %s: %s", decision, user.ID(), reason)
+		b.approvals = append(b.approvals[:i], b.approvals[i+1:]...)
+		return nil
+	}
+	return common.ErrApprovalNotFound
+}
+
+// Cancel records who cancelled running messages and approvals, other known messages are finished.
+// Running command can be cancelled only by requester.
+func (b *MockBot) Cancel(messageID string, user common.User) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	by := ""
+	if user != nil {
+		by = user.ID()
+	}
+	cancel := func() {
+		if b.cancelled == nil {
+			b.cancelled = make(map[string]string)
+		}
+		b.cancelled[messageID] = by
+	}
+
+	for i, a := range b.approvals {
+		if a.ID == messageID {
+			b.approvals = append(b.approvals[:i], b.approvals[i+1:]...)
+			cancel()
+			return nil
+		}
+	}
+	if _, ok := b.cancelled[messageID]; ok {
+		return common.ErrMessageNotCancellable
+	}
+	// cancelled run is kept, as bots know command of the message after it's finished
+	if i := slices.IndexFunc(b.running, func(r *MockRun) bool { return r.id == messageID }); i >= 0 {
+		if user != nil && user.ID() != b.running[i].user {
+			return common.ErrCancelNotPermitted
+		}
+		cancel()
+		return nil
+	}
+	return common.ErrMessageNotFound
+}
+
+func (b *MockBot) TagMessage(channel, ID string, tags map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tags == nil {
+		b.tags = make(map[string]map[string]string)
+	}
+	key := channel + "/" + ID
+	if b.tags[key] == nil {
+		b.tags[key] = make(map[string]string)
+	}
+	for k, v := range tags {
+		b.tags[key][k] = v
+	}
+	return nil
+}
+
+func (b *MockBot) FindMessagesByTag(tagKey, tagValue string) map[string]string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r := make(map[string]string)
+	for key, tags := range b.tags {
+		if tags[tagKey] == tagValue {
+			r[key] = key[strings.LastIndex(key, "/")+1:]
+		}
+	}
+	return r
+}
+
 // GetMessageStatus returns the mock message status
 func (b *MockBot) GetMessageStatus(messageID string) (common.MessageStatus, error) {
 	b.mu.Lock()
@@ -136,6 +276,28 @@ func (b *MockBot) GetMessageStatus(messageID string) (common.MessageStatus, erro
 	return b.messageStatus, nil
 }
 
+// GetMessageResult returns the mock message status with the mock result
+func (b *MockBot) GetMessageResult(messageID string) (*common.MessageResult, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	r := &common.MessageResult{}
+	if b.messageResult != nil {
+		*r = *b.messageResult
+	}
+	r.Status = b.messageStatus
+	for _, a := range b.approvals {
+		if a.ID == messageID {
+			r.Command = a.Command
+		}
+	}
+	for _, run := range b.running {
+		if run.id == messageID {
+			r.Command = run.command
+		}
+	}
+	return r, nil
+}
+
 func (b *MockBot) GetLastCommand() (string, string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -155,6 +317,7 @@ func (b *MockBot) Reset() {
 	b.lastChannel = ""
 	b.lastCommand = ""
 	b.lastUser = nil
+	b.lastParams = nil
 }
 
 // MockObservability implements minimal observability for testing
@@ -173,11 +336,15 @@ func newTestServer(executor common.CommandExecutor) *HttpServer {
 }
 
 func newTestServerWithAllowedCmds(executor common.CommandExecutor, allowedCmds []string) *HttpServer {
-	return NewHttpServer(
-		HttpServerOptions{Listen: ":0", AllowedCmds: allowedCmds},
-		newTestObservability(),
-		executor,
-	)
+	return newTestServerWithOptions(executor, HttpServerOptions{Listen: ":0", AllowedCmds: allowedCmds})
+}
+
+func newTestServerWithOptions(executor common.CommandExecutor, options HttpServerOptions) *HttpServer {
+	server, err := NewHttpServer(options, newTestObservability(), executor)
+	if err != nil {
+		panic(err)
+	}
+	return server
 }
 
 // TestCreateMessage tests HTTP endpoint validation and routing.
@@ -549,6 +716,130 @@ func TestCreateMessageCommandExecution(t *testing.T) {
 	}
 }
 
+func TestCreateMessageWithParams(t *testing.T) {
+	mockBot := NewMockBot("Slack")
+	bots := common.NewBots()
+	bots.Add(mockBot)
+
+	server := newTestServerWithAllowedCmds(bots, []string{"deploy"})
+
+	tests := []struct {
+		name           string
+		commandErr     error
+		expectedStatus int
+	}{
+		{"params are passed", nil, http.StatusCreated},
+		{"invalid params", &common.ParamsError{Errors: []string{"env is required"}}, http.StatusBadRequest},
+		{"params are not permitted", fmt.Errorf("%w: deploy", common.ErrCommandNotPermitted), http.StatusForbidden},
+		{"execution error", errors.New("failed"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBot.commandErr = tt.commandErr
+
+			body := []byte(`{"bot":"Slack","channel":"C1","command":"deploy","user_id":"u1","params":{"env":"prod","regions":["eu","us"]}}`)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/message", bytes.NewReader(body))
+			rec := httptest.NewRecorder()
+
+			server.createMessage(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if mockBot.lastParams["env"] != "prod" {
+				t.Errorf("expected params to reach the bot, got %v", mockBot.lastParams)
+			}
+		})
+	}
+}
+
+func TestCreateMessageWait(t *testing.T) {
+	mockBot := NewMockBot("Slack")
+	mockBot.messageResult = &common.MessageResult{
+		Text:        "deployed",
+		Attachments: []*common.Attachment{{Title: "log", Data: []byte("ok"), Type: common.AttachmentTypeText}},
+	}
+	bots := common.NewBots()
+	bots.Add(mockBot)
+
+	server := newTestServerWithAllowedCmds(bots, []string{"deploy"})
+
+	tests := []struct {
+		name           string
+		wait           string
+		status         common.MessageStatus
+		expectedStatus int
+	}{
+		{"command finished", "1s", common.MessageStatusDelivered, http.StatusOK},
+		{"command failed", "1s", common.MessageStatusFailed, http.StatusOK},
+		{"waiting for approval", "300ms", common.MessageStatusWaitingApproval, http.StatusAccepted},
+		{"invalid wait", "soon", common.MessageStatusDelivered, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBot.messageStatus = tt.status
+
+			body, _ := json.Marshal(CreateMessageRequest{Bot: "Slack", Channel: "C1", Command: "deploy", UserID: "u1"})
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/message?wait="+tt.wait, bytes.NewReader(body))
+			rec := httptest.NewRecorder()
+
+			server.createMessage(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if rec.Code == http.StatusBadRequest {
+				return
+			}
+
+			var resp MessageResultResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.ID == "" || resp.Status != tt.status || resp.Text != "deployed" {
+				t.Errorf("unexpected response %+v", resp)
+			}
+			if len(resp.Attachments) != 1 || string(resp.Attachments[0].Data) != "ok" {
+				t.Errorf("expected attachment data to be returned, got %+v", resp.Attachments)
+			}
+		})
+	}
+}
+
+func TestGetMessageResult(t *testing.T) {
+	mockBot := NewMockBot("Slack")
+	mockBot.messageResult = &common.MessageResult{Text: "done"}
+	bots := common.NewBots()
+	bots.Add(mockBot)
+
+	server := newTestServerWithAllowedCmds(bots, nil)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{"result", "?bot=Slack&id=1", http.StatusOK},
+		{"no id", "?bot=Slack", http.StatusBadRequest},
+		{"unknown bot", "?bot=Telegram&id=1", http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/message/result"+tt.query, nil)
+			rec := httptest.NewRecorder()
+
+			server.getMessageResult(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
 func TestGetMessageStatus(t *testing.T) {
 	mockBot := NewMockBot("Slack")
 	bots := common.NewBots()
@@ -626,6 +917,200 @@ func TestGetMessageStatusMissingID(t *testing.T) {
 	}
 }
 
+func TestGetRunbookStatus(t *testing.T) {
+	store, err := common.NewRunbookStore("", 0)
+	if err != nil {
+		t.Fatalf("failed to create runbook store: %v", err)
+	}
+	store.Save(&common.RunbookRun{
+		ID:     "run-1",
+		Name:   "deploy",
+		Status: common.RunbookStatusRunning,
+		Steps: map[string]*common.RunbookRunStep{
+			"build": {ID: "build", Status: common.RunbookStatusDone},
+		},
+	})
+
+	bots := common.NewBots()
+	bots.SetRunbookStore(store)
+	server := newTestServer(bots)
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+	}{
+		{"existing run", "/api/v1/runbook/status?id=run-1", http.StatusOK},
+		{"unknown run", "/api/v1/runbook/status?id=run-2", http.StatusNotFound},
+		{"missing id", "/api/v1/runbook/status", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			server.getRunbookStatus(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var run common.RunbookRun
+			if err := json.NewDecoder(rec.Body).Decode(&run); err != nil {
+				t.Fatalf("failed to decode runbook run: %v", err)
+			}
+			if run.Status != common.RunbookStatusRunning {
+				t.Errorf("expected status %q, got %q", common.RunbookStatusRunning, run.Status)
+			}
+			if run.Steps["build"] == nil || run.Steps["build"].Status != common.RunbookStatusDone {
+				t.Errorf("expected step build to be done, got %+v", run.Steps["build"])
+			}
+		})
+	}
+}
+
+func TestGetRunbookStatusNotTracked(t *testing.T) {
+	server := newTestServer(common.NewBots())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/runbook/status?id=run-1", nil)
+	rec := httptest.NewRecorder()
+
+	server.getRunbookStatus(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
+
+func TestGetRunbookRuns(t *testing.T) {
+	store, err := common.NewRunbookStore("", 0)
+	if err != nil {
+		t.Fatalf("failed to create runbook store: %v", err)
+	}
+	now := time.Now()
+	store.Save(&common.RunbookRun{ID: "run-1", Name: "deploy", Status: common.RunbookStatusDone, Started: now.Add(-2 * time.Minute)})
+	store.Save(&common.RunbookRun{ID: "run-2", Name: "restart", Status: common.RunbookStatusFailed, Started: now.Add(-time.Minute)})
+	store.Save(&common.RunbookRun{ID: "run-3", Name: "deploy", Status: common.RunbookStatusRunning, Started: now})
+
+	bots := common.NewBots()
+	bots.SetRunbookStore(store)
+	server := newTestServer(bots)
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedIDs    []string
+	}{
+		{"all runs", "/api/v1/runbook/runs", http.StatusOK, []string{"run-3", "run-2", "run-1"}},
+		{"by name", "/api/v1/runbook/runs?name=deploy", http.StatusOK, []string{"run-3", "run-1"}},
+		{"with limit", "/api/v1/runbook/runs?limit=1", http.StatusOK, []string{"run-3"}},
+		{"invalid limit", "/api/v1/runbook/runs?limit=x", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			server.getRunbookRuns(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+
+			var runs []*common.RunbookRun
+			if err := json.NewDecoder(rec.Body).Decode(&runs); err != nil {
+				t.Fatalf("failed to decode runbook runs: %v", err)
+			}
+			ids := []string{}
+			for _, run := range runs {
+				ids = append(ids, run.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.expectedIDs, ",") {
+				t.Errorf("expected runs %v, got %v", tt.expectedIDs, ids)
+			}
+		})
+	}
+}
+
+func writeTestCA(t *testing.T) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "chatops-test-ca"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatalf("failed to write CA: %v", err)
+	}
+	return path
+}
+
+func TestTLSConfig(t *testing.T) {
+	ca := writeTestCA(t)
+	invalid := filepath.Join(t.TempDir(), "invalid.pem")
+	os.WriteFile(invalid, []byte("not a certificate"), 0644)
+
+	tests := []struct {
+		name               string
+		options            HttpServerOptions
+		expectError        bool
+		expectedClientAuth tls.ClientAuthType
+	}{
+		{"plain HTTP", HttpServerOptions{}, false, tls.NoClientCert},
+		{"TLS only", HttpServerOptions{TLSCert: "server.crt", TLSKey: "server.key"}, false, tls.NoClientCert},
+		{"client CA without TLS", HttpServerOptions{TLSClientCA: ca}, true, tls.NoClientCert},
+		{"client certificates are required", HttpServerOptions{TLSCert: "server.crt", TLSKey: "server.key", TLSClientCA: ca}, false, tls.RequireAndVerifyClientCert},
+		{"client certificates with identities", HttpServerOptions{TLSCert: "server.crt", TLSKey: "server.key", TLSClientCA: ca,
+			Identities: "identities:\n  - name: ci\n    token: x"}, false, tls.VerifyClientCertIfGiven},
+		{"invalid client CA", HttpServerOptions{TLSCert: "server.crt", TLSKey: "server.key", TLSClientCA: invalid}, true, tls.NoClientCert},
+		{"missing client CA", HttpServerOptions{TLSCert: "server.crt", TLSKey: "server.key", TLSClientCA: ca + ".missing"}, true, tls.NoClientCert},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := NewHttpServer(tt.options, newTestObservability(), common.NewBots())
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer server.Stop()
+
+			if server.tls.MinVersion != tls.VersionTLS12 {
+				t.Errorf("expected TLS 1.2 as min version, got %x", server.tls.MinVersion)
+			}
+			if server.tls.ClientAuth != tt.expectedClientAuth {
+				t.Errorf("expected client auth %v, got %v", tt.expectedClientAuth, server.tls.ClientAuth)
+			}
+		})
+	}
+}
+
 // Note: The MockBot doesn't validate command names, so these test HTTP routing only.
 var chatopsTemplateCommands = []string{
 	// Root commands
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devopsext/chatops/common"
+)
+
+// httpRoute is registered in the mux and described in OpenAPI document, so both can't differ
+type httpRoute struct {
+	path        string
+	method      string
+	summary     string
+	handler     http.HandlerFunc
+	public      bool // route checks caller itself or doesn't need one
+	query       []httpRouteParam
+	request     any
+	response    any
+	status      int
+	contentType string
+}
+
+type httpRouteParam struct {
+	name        string
+	description string
+	required    bool
+}
+
+type httpOpenAPI struct {
+	schemas map[string]any
+}
+
+const (
+	httpOpenAPIVersion = "3.1.0"
+	httpOpenAPIRef     = "#/components/schemas/"
+)
+
+func (s *HttpServer) routes() []*httpRoute {
+
+	botID := []httpRouteParam{
+		{name: "bot", description: "Bot name", required: true},
+		{name: "id", description: "Message ID", required: true},
+	}
+
+	return []*httpRoute{
+		{path: "/api/v1/message", method: http.MethodPost, summary: "Execute command, wait for its result optionally",
+			handler: s.createMessage, request: CreateMessageRequest{}, response: CreateMessageResponse{}, status: http.StatusCreated,
+			query: []httpRouteParam{{name: "wait", description: "Duration to wait for the result, 200 is returned with final result, 202 otherwise"}}},
+		{path: "/api/v1/message/status", method: http.MethodGet, summary: "Get message status",
+			handler: s.getMessageStatus, query: botID, response: GetMessageStatusResponse{}, status: http.StatusOK},
+		{path: "/api/v1/message/result", method: http.MethodGet, summary: "Get message status and output",
+			handler: s.getMessageResult, query: botID, response: MessageResultResponse{}, status: http.StatusOK},
+		{path: "/api/v1/message/{id}", method: http.MethodDelete, summary: "Cancel command which is running or waits for approval",
+			handler: s.deleteMessage, response: GetMessageStatusResponse{}, status: http.StatusOK,
+			query: []httpRouteParam{{name: "bot", description: "Bot name", required: true}}},
+		{path: "/api/v1/message/events", method: http.MethodGet, summary: "Stream message status changes as Server-Sent Events",
+			handler: s.getMessageEvents, response: common.MessageEvent{}, status: http.StatusOK, contentType: "text/event-stream",
+			query: []httpRouteParam{{name: "bot", description: "Bot name"}, {name: "id", description: "Message ID"}}},
+		{path: "/api/v1/approvals", method: http.MethodGet, summary: "List messages which wait for approval",
+			handler: s.getApprovals, response: []*common.PendingApproval{}, status: http.StatusOK,
+			query: []httpRouteParam{{name: "bot", description: "Bot name", required: true}}},
+		{path: "/api/v1/approval", method: http.MethodPost, summary: "Approve or reject message on behalf of identity user",
+			handler: s.postApproval, request: ApprovalRequest{}, response: ApprovalResponse{}, status: http.StatusOK},
+		{path: "/api/v1/alertmanager", method: http.MethodPost, summary: "Receive Alertmanager webhook",
+			handler: s.postAlertmanager, request: AlertmanagerMessage{}, response: AlertmanagerResponse{}, status: http.StatusOK},
+		{path: "/api/v1/hooks/{name}", method: http.MethodPost, summary: "Run hook, hooks with secret don't need credentials",
+			handler: s.postHook, public: true, request: map[string]any{}, response: CreateMessageResponse{}, status: http.StatusCreated},
+		{path: "/api/v1/commands", method: http.MethodGet, summary: "List commands",
+			handler: s.getCommands, response: []*common.CommandInfo{}, status: http.StatusOK,
+			query: []httpRouteParam{{name: "group", description: "Command group"}}},
+		{path: "/api/v1/runbook/status", method: http.MethodGet, summary: "Get runbook run",
+			handler: s.getRunbookStatus, response: common.RunbookRun{}, status: http.StatusOK,
+			query: []httpRouteParam{{name: "id", description: "Run ID", required: true}}},
+		{path: "/api/v1/runbook/runs", method: http.MethodGet, summary: "List runbook runs, newest first",
+			handler: s.getRunbookRuns, response: []*common.RunbookRun{}, status: http.StatusOK,
+			query: []httpRouteParam{{name: "name", description: "Runbook name"}, {name: "limit", description: "Number of runs"}}},
+		{path: "/api/v1/openapi.json", method: http.MethodGet, summary: "Get OpenAPI document",
+			handler: s.getOpenAPI, public: true, response: map[string]any{}, status: http.StatusOK},
+	}
+}
+
+// schema of Go type follows its JSON encoding, named structs are put into components
+func (o *httpOpenAPI) schema(t reflect.Type) map[string]any {
+
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return map[string]any{"type": "string", "format": "date-time"}
+	case reflect.TypeOf(time.Duration(0)):
+		return map[string]any{"type": "integer"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": o.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": o.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return o.object(t)
+		}
+		if _, ok := o.schemas[t.Name()]; !ok {
+			o.schemas[t.Name()] = map[string]any{} // recursive types refer to themselves
+			o.schemas[t.Name()] = o.object(t)
+		}
+		return map[string]any{"$ref": httpOpenAPIRef + t.Name()}
+	}
+	return map[string]any{}
+}
+
+func (o *httpOpenAPI) object(t reflect.Type) map[string]any {
+
+	properties := make(map[string]any)
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name := f.Name
+		omit := false
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			items := strings.Split(tag, ",")
+			if items[0] != "" {
+				name = items[0]
+			}
+			omit = strings.Contains(tag, ",omitempty")
+		}
+		properties[name] = o.schema(f.Type)
+		if !omit {
+			required = append(required, name)
+		}
+	}
+
+	r := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		r["required"] = required
+	}
+	return r
+}
+
+func (o *httpOpenAPI) content(contentType string, obj any) map[string]any {
+
+	return map[string]any{
+		contentType: map[string]any{"schema": o.schema(reflect.TypeOf(obj))},
+	}
+}
+
+func (o *httpOpenAPI) operation(route *httpRoute, security []map[string][]string) map[string]any {
+
+	contentType := route.contentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	op := map[string]any{
+		"summary": route.summary,
+		"responses": map[string]any{
+			strconv.Itoa(route.status): map[string]any{
+				"description": http.StatusText(route.status),
+				"content":     o.content(contentType, route.response),
+			},
+			"default": map[string]any{
+				"description": "Error",
+				"content":     o.content("application/json", ErrorResponse{}),
+			},
+		},
+	}
+
+	params := []map[string]any{}
+	for _, segment := range strings.Split(route.path, "/") {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		params = append(params, map[string]any{
+			"name": strings.Trim(segment, "{}"), "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+		})
+	}
+	for _, p := range route.query {
+		params = append(params, map[string]any{
+			"name": p.name, "in": "query", "description": p.description, "required": p.required,
+			"schema": map[string]any{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if route.request != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  o.content("application/json", route.request),
+		}
+	}
+	if !route.public && len(security) > 0 {
+		op["security"] = security
+	}
+	return op
+}
+
+// OpenAPI describes routes of the server, security is there only if identities are configured
+func (s *HttpServer) OpenAPI() map[string]any {
+
+	o := &httpOpenAPI{schemas: make(map[string]any)}
+
+	security := []map[string][]string{}
+	schemes := map[string]any{}
+	if s.auth.Enabled() {
+		schemes["token"] = map[string]any{"type": "http", "scheme": "bearer"}
+		schemes["signature"] = map[string]any{
+			"type": "apiKey", "in": "header", "name": HttpAuthHeaderKey,
+			"description": "Request is signed with " + HttpAuthHeaderTimestamp + " and " + HttpAuthHeaderSignature + " headers",
+		}
+		security = append(security, map[string][]string{"token": {}}, map[string][]string{"signature": {}})
+		if s.TLS() {
+			schemes["certificate"] = map[string]any{"type": "mutualTLS"}
+			security = append(security, map[string][]string{"certificate": {}})
+		}
+	}
+
+	paths := make(map[string]map[string]any)
+	for _, route := range s.routes() {
+		if paths[route.path] == nil {
+			paths[route.path] = make(map[string]any)
+		}
+		paths[route.path][strings.ToLower(route.method)] = o.operation(route, security)
+	}
+
+	components := map[string]any{"schemas": o.schemas}
+	if len(schemes) > 0 {
+		components["securitySchemes"] = schemes
+	}
+
+	return map[string]any{
+		"openapi":    httpOpenAPIVersion,
+		"info":       map[string]any{"title": "Chatops API", "version": "v1"},
+		"paths":      paths,
+		"components": components,
+	}
+}
+
+func (s *HttpServer) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	s.incRequests(r.Method, r.URL.Path, "")
+
+	if r.Method != http.MethodGet {
+		s.incErrors(r.Method, r.URL.Path, "")
+		s.writeErrorWithMetrics(w, r, "", "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.writeJSONWithMetrics(w, r, "", s.OpenAPI(), http.StatusOK)
+}
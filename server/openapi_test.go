@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/devopsext/chatops/common"
+	"github.com/devopsext/chatops/processor"
+)
+
+func TestGetCommands(t *testing.T) {
+	processors := common.NewProcessors()
+	processors.Add(processor.NewRunbooks(processor.RunbooksOptions{Name: "runbook"}, newTestObservability(), nil))
+
+	bots := common.NewBots()
+	bots.SetProcessors(processors)
+	server := newTestServer(bots)
+
+	count := len(processors.CommandInfos())
+	if count == 0 {
+		t.Fatal("expected runbook commands")
+	}
+
+	tests := []struct {
+		name          string
+		url           string
+		expectedCount int
+	}{
+		{"all commands", "/api/v1/commands", count},
+		{"by group", "/api/v1/commands?group=runbook", count},
+		{"unknown group", "/api/v1/commands?group=k8s", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			rec := httptest.NewRecorder()
+
+			server.getCommands(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+			}
+			var commands []*common.CommandInfo
+			if err := json.NewDecoder(rec.Body).Decode(&commands); err != nil {
+				t.Fatalf("failed to decode commands: %v", err)
+			}
+			if len(commands) != tt.expectedCount {
+				t.Errorf("expected %d commands, got %d", tt.expectedCount, len(commands))
+			}
+			for _, c := range commands {
+				if c.Group != "runbook" || c.Command != "runbook "+c.Name {
+					t.Errorf("unexpected command %+v", c)
+				}
+			}
+		})
+	}
+}
+
+func TestGetCommandsNotKnown(t *testing.T) {
+	server := newTestServer(common.NewBots())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/commands", nil)
+	rec := httptest.NewRecorder()
+
+	server.getCommands(rec, req)
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, rec.Code)
+	}
+}
+
+func TestGetOpenAPI(t *testing.T) {
+	server := newTestServerWithOptions(common.NewBots(), HttpServerOptions{Identities: testIdentities})
+	defer server.Stop()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil)
+	rec := httptest.NewRecorder()
+
+	server.getOpenAPI(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	var doc struct {
+		OpenAPI    string                               `json:"openapi"`
+		Paths      map[string]map[string]map[string]any `json:"paths"`
+		Components struct {
+			Schemas         map[string]any `json:"schemas"`
+			SecuritySchemes map[string]any `json:"securitySchemes"`
+		} `json:"components"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatalf("failed to decode document: %v", err)
+	}
+
+	for _, route := range server.routes() {
+		op, ok := doc.Paths[route.path][strings.ToLower(route.method)]
+		if !ok {
+			t.Errorf("route %s %s is not described", route.method, route.path)
+			continue
+		}
+		if _, secured := op["security"]; secured == route.public {
+			t.Errorf("route %s has unexpected security", route.path)
+		}
+	}
+
+	for _, name := range []string{"CreateMessageRequest", "MessageResultResponse", "CommandInfo", "RunbookRun", "ErrorResponse"} {
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("schema %s is missing", name)
+		}
+	}
+	if _, ok := doc.Components.SecuritySchemes["token"]; !ok {
+		t.Error("token security scheme is missing")
+	}
+}